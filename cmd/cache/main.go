@@ -1,16 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"os/signal"
 	"runtime"
 	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/KyberNetwork/cache/ethereum"
 	"github.com/KyberNetwork/cache/fetcher"
 	"github.com/KyberNetwork/cache/http"
+	"github.com/KyberNetwork/cache/logger"
+	"github.com/KyberNetwork/cache/metrics"
 	"github.com/KyberNetwork/cache/node"
 	persister "github.com/KyberNetwork/cache/persister"
 
@@ -52,6 +60,15 @@ func cmdMain(ctx *cli.Context) error {
 	if err != nil {
 		log.Fatal(err)
 	}
+	metricsSink := metrics.NewSinkFromEnv()
+	metrics.SetDefault(metricsSink)
+	snapshotLogger, err := metrics.NewSnapshotLoggerFromEnv(metricsSink, logger.Default())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if snapshotLogger != nil {
+		defer snapshotLogger.Close()
+	}
 	nodeMiddleware, err := node.NewNodeMiddleware()
 	if err != nil {
 		log.Fatal(err)
@@ -75,6 +92,8 @@ func cmdMain(ctx *cli.Context) error {
 	runFetchData(persisterIns, fetchMaxGasPrice, fertcherIns, 60)
 
 	runFetchData(persisterIns, fetchGasPrice, fertcherIns, 30)
+	// fee history comes from node cache, which caches it for FEE_HISTORY_INTERVAL
+	runFetchData(persisterIns, fetchEIP1559GasPrice(nodeMiddleware), fertcherIns, 15)
 
 	runFetchData(persisterIns, fetchRateUSD, fertcherIns, 300)
 
@@ -82,11 +101,66 @@ func cmdMain(ctx *cli.Context) error {
 
 	go fetchRate(persisterIns, fertcherIns)
 
-	server := http.NewHTTPServer(":3001", persisterIns, fertcherIns, nodeMiddleware)
-	server.Run(kyberENV)
+	serverOpts, err := serverOptionsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	shutdownConfig, err := shutdownConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("WARMUP_WAIT")); err == nil && seconds > 0 {
+		waitCtx, cancel := context.WithTimeout(context.Background(), time.Duration(seconds)*time.Second)
+		if err := nodeMiddleware.WaitReady(waitCtx); err != nil {
+			log.Printf("node cache is not warm after %ds, serving anyway: %v", seconds, err)
+		}
+		cancel()
+	}
+	server := http.NewHTTPServer(":3001", persisterIns, fertcherIns, nodeMiddleware, serverOpts...)
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- server.Run(kyberENV)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-runErr:
+		// e.g. the port is already in use, nothing to drain
+		return err
+	case <-signals:
+	}
+	log.Println("shutting down")
+	if err := http.Shutdown(context.Background(), server, shutdownConfig); err != nil {
+		log.Printf("shutdown failed: %s", err)
+		return err
+	}
 	return nil
 }
 
+// shutdownConfigFromEnv SHUTDOWN_ORDER is a comma separated list of readiness, http and node,
+// SHUTDOWN_READINESS_DELAY, SHUTDOWN_DRAIN_TIMEOUT and SHUTDOWN_NODE_TIMEOUT are in seconds
+func shutdownConfigFromEnv() (http.ShutdownConfig, error) {
+	config := http.DefaultShutdownConfig()
+	if value := os.Getenv("SHUTDOWN_ORDER"); value != "" {
+		order, err := http.ParseShutdownOrder(value)
+		if err != nil {
+			return config, err
+		}
+		config.Order = order
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("SHUTDOWN_READINESS_DELAY")); err == nil && seconds >= 0 {
+		config.ReadinessDelay = time.Duration(seconds) * time.Second
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("SHUTDOWN_DRAIN_TIMEOUT")); err == nil && seconds > 0 {
+		config.DrainTimeout = time.Duration(seconds) * time.Second
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("SHUTDOWN_NODE_TIMEOUT")); err == nil && seconds > 0 {
+		config.NodeTimeout = time.Duration(seconds) * time.Second
+	}
+	return config, nil
+}
+
 func runFetchData(persister persister.Persister, fn fetcherFunc, fertcherIns *fetcher.Fetcher, interval time.Duration) {
 	ticker := time.NewTicker(interval * time.Second)
 	go func() {
@@ -107,6 +181,18 @@ func fetchGasPrice(persister persister.Persister, fetcher *fetcher.Fetcher) {
 	persister.SaveGasPrice(gasPrice)
 }
 
+func fetchEIP1559GasPrice(nodeMiddleware *node.NodeMiddleware) fetcherFunc {
+	return func(persister persister.Persister, fetcher *fetcher.Fetcher) {
+		gasPrice, err := fetcher.GetEIP1559GasPrice(nodeMiddleware)
+		if err != nil {
+			log.Print(err)
+			persister.SetNewEIP1559GasPrice(false)
+			return
+		}
+		persister.SaveEIP1559GasPrice(gasPrice)
+	}
+}
+
 func fetchMaxGasPrice(persister persister.Persister, fetcher *fetcher.Fetcher) {
 	gasPrice, err := fetcher.GetMaxGasPrice()
 	if err != nil {
@@ -182,3 +268,98 @@ func fetchRate(persister persister.Persister, fetcher *fetcher.Fetcher) {
 		<-ticker.C
 	}
 }
+
+// serverOptionsFromEnv ACCESS_LOG is a file path or "-" for stdout,
+// ACCESS_LOG_ONLY=true replaces the default request logger by the access log,
+// COMPRESSION_LEVEL (1-9) enables gzip responses of at least COMPRESSION_MIN_SIZE bytes, HEAD_REQUESTS=false disables HEAD on read endpoints,
+// UNCHANGED_AS_SUCCESS=true answers success:true with changed:false when data is not fresh,
+// RATE_LIMIT (requests per second per client IP) with RATE_LIMIT_BURST enables rate limiting,
+// X-Forwarded-For is only trusted from RATE_LIMIT_TRUSTED_PROXIES
+func serverOptionsFromEnv() ([]http.ServerOption, error) {
+	opts := []http.ServerOption{}
+	if origins := os.Getenv("CORS_ORIGINS"); origins != "" {
+		config := http.CORSConfig{
+			Origins:     splitList(origins),
+			Methods:     splitList(os.Getenv("CORS_METHODS")),
+			Headers:     splitList(os.Getenv("CORS_HEADERS")),
+			Credentials: os.Getenv("CORS_CREDENTIALS") != "false",
+		}
+		if err := config.Validate(); err != nil {
+			return nil, fmt.Errorf("CORS_ORIGINS: %v", err)
+		}
+		opts = append(opts, http.WithCORS(config))
+	}
+	if value := os.Getenv("RATE_LIMIT"); value != "" {
+		limit, err := rateLimitFromEnv(value)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, http.WithRateLimit(limit, nil))
+		if value := os.Getenv("RATE_LIMIT_TRUSTED_PROXIES"); value != "" {
+			proxies, err := http.ParseTrustedProxies(value)
+			if err != nil {
+				return nil, fmt.Errorf("RATE_LIMIT_TRUSTED_PROXIES: %v", err)
+			}
+			opts = append(opts, http.WithTrustedProxies(proxies))
+		}
+	}
+	if os.Getenv("UNCHANGED_AS_SUCCESS") == "true" {
+		opts = append(opts, http.WithUnchangedAsSuccess())
+	}
+	if os.Getenv("HEAD_REQUESTS") == "false" {
+		opts = append(opts, http.WithoutHeadRequests())
+	}
+	if level := os.Getenv("COMPRESSION_LEVEL"); level != "" {
+		compressionLevel, err := strconv.Atoi(level)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, http.WithCompression(compressionLevel))
+		if minSize, err := strconv.Atoi(os.Getenv("COMPRESSION_MIN_SIZE")); err == nil && minSize >= 0 {
+			opts = append(opts, http.WithCompressionMinSize(minSize))
+		}
+	}
+	switch path := os.Getenv("ACCESS_LOG"); path {
+	case "":
+		return opts, nil
+	case "-":
+		opts = append(opts, http.WithAccessLog(os.Stdout))
+	default:
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, http.WithAccessLog(f))
+	}
+	if os.Getenv("ACCESS_LOG_ONLY") == "true" {
+		opts = append(opts, http.WithoutDefaultLogger())
+	}
+	return opts, nil
+}
+
+// splitList split a comma separated list, dropping empty items
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// rateLimitFromEnv RATE_LIMIT_BURST defaults to the rate rounded up, at least 1
+func rateLimitFromEnv(value string) (http.RateLimit, error) {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate <= 0 {
+		return http.RateLimit{}, fmt.Errorf("RATE_LIMIT must be a positive number, got %q", value)
+	}
+	limit := http.RateLimit{Rate: rate, Burst: int(math.Ceil(rate))}
+	if burst := os.Getenv("RATE_LIMIT_BURST"); burst != "" {
+		limit.Burst, err = strconv.Atoi(burst)
+		if err != nil || limit.Burst <= 0 {
+			return http.RateLimit{}, fmt.Errorf("RATE_LIMIT_BURST must be a positive integer, got %q", burst)
+		}
+	}
+	return limit, nil
+}
@@ -31,7 +31,20 @@ type Rate struct {
 	Dest    string `json:"dest"`
 	Rate    string `json:"rate"`
 	Minrate string `json:"minRate"`
-}
+	// Liquidity ETH volume of the pair in last 24h, only used for filtering
+	Liquidity float64 `json:"-"`
+	// Provider where the rate comes from, one of RateProvider*
+	Provider string `json:"-"`
+}
+
+const (
+	// RateProviderMarket rate of the tracker market API
+	RateProviderMarket = "market"
+	// RateProviderNetwork expected rate of the network contract
+	RateProviderNetwork = "network"
+	// RateProviderWrapper expected rate of the wrapper contract
+	RateProviderWrapper = "wrapper"
+)
 
 type GasPrice struct {
 	Fast     string `json:"fast"`
@@ -40,6 +53,26 @@ type GasPrice struct {
 	Default  string `json:"default"`
 }
 
+// FeeHistory result of eth_feeHistory, values are in wei
+type FeeHistory struct {
+	BaseFeePerGas []*big.Int
+	Reward        [][]*big.Int
+}
+
+// FeeRecommendation EIP-1559 fee fields of a priority tier, in gwei
+type FeeRecommendation struct {
+	MaxFeePerGas         string `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas"`
+}
+
+// EIP1559GasPrice fee recommendations base on the next block base fee, in gwei
+type EIP1559GasPrice struct {
+	BaseFee  string            `json:"baseFee"`
+	Slow     FeeRecommendation `json:"slow"`
+	Standard FeeRecommendation `json:"standard"`
+	Fast     FeeRecommendation `json:"fast"`
+}
+
 type Token struct {
 	Name       string `json:"name"`
 	Symbol     string `json:"symbol"`
@@ -3,10 +3,12 @@ package bfetcher
 import (
 	"context"
 	"log"
+	"math/big"
 	"time"
 
 	// "strconv"
 
+	"github.com/KyberNetwork/cache/ethereum"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/rpc"
 )
@@ -81,6 +83,36 @@ func (self *BlockchainFetcher) GetLatestBlock() (string, error) {
 	return blockNum.ToInt().String(), nil
 }
 
+type feeHistoryResult struct {
+	BaseFeePerGas []*hexutil.Big   `json:"baseFeePerGas"`
+	Reward        [][]*hexutil.Big `json:"reward"`
+}
+
+func (self *BlockchainFetcher) GetFeeHistory(blockCount int, percentiles []float64) (*ethereum.FeeHistory, error) {
+	var result feeHistoryResult
+	ctx, cancel := context.WithTimeout(context.Background(), self.timeout)
+	defer cancel()
+	err := self.client.CallContext(ctx, &result, "eth_feeHistory", hexutil.Uint(blockCount), "latest", percentiles)
+	if err != nil {
+		return nil, err
+	}
+	feeHistory := &ethereum.FeeHistory{
+		BaseFeePerGas: make([]*big.Int, 0, len(result.BaseFeePerGas)),
+		Reward:        make([][]*big.Int, 0, len(result.Reward)),
+	}
+	for _, baseFee := range result.BaseFeePerGas {
+		feeHistory.BaseFeePerGas = append(feeHistory.BaseFeePerGas, baseFee.ToInt())
+	}
+	for _, blockReward := range result.Reward {
+		rewards := make([]*big.Int, 0, len(blockReward))
+		for _, reward := range blockReward {
+			rewards = append(rewards, reward.ToInt())
+		}
+		feeHistory.Reward = append(feeHistory.Reward, rewards)
+	}
+	return feeHistory, nil
+}
+
 type TopicParam struct {
 	FromBlock string   `json:"fromBlock"`
 	ToBlock   string   `json:"toBlock"`
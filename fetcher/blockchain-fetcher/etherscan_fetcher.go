@@ -74,6 +74,10 @@ func (self *Etherscan) GetLatestBlock() (string, error) {
 	return num.String(), nil
 }
 
+func (self *Etherscan) GetFeeHistory(blockCount int, percentiles []float64) (*ethereum.FeeHistory, error) {
+	return nil, errors.New("not support this func")
+}
+
 func (self *Etherscan) GetTypeName() string {
 	return self.TypeName
 }
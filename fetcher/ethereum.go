@@ -159,10 +159,11 @@ func (self *Ethereum) ExtractRateData(result string, sourceSymbol, destSymbol st
 	}
 
 	return ethereum.Rate{
-		Source:  sourceSymbol,
-		Dest:    destSymbol,
-		Rate:    rateNetwork.ExpectedRate.String(),
-		Minrate: rateNetwork.SlippageRate.String(),
+		Source:   sourceSymbol,
+		Dest:     destSymbol,
+		Rate:     rateNetwork.ExpectedRate.String(),
+		Minrate:  rateNetwork.SlippageRate.String(),
+		Provider: ethereum.RateProviderNetwork,
 	}, nil
 }
 
@@ -193,7 +194,11 @@ func (self *Ethereum) ExtractRateDataWrapper(result string, sourceArr, destAddr
 		rate := rateWapper.ExpectedRate[i]
 		minRate := rateWapper.SlippageRate[i]
 		rateReturn = append(rateReturn, ethereum.Rate{
-			source, dest, rate.String(), minRate.String(),
+			Source:   source,
+			Dest:     dest,
+			Rate:     rate.String(),
+			Minrate:  minRate.String(),
+			Provider: ethereum.RateProviderWrapper,
 		})
 	}
 	return rateReturn, nil
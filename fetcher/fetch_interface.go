@@ -1,6 +1,7 @@
 package fetcher
 
 import (
+	"github.com/KyberNetwork/cache/ethereum"
 	bFetcher "github.com/KyberNetwork/cache/fetcher/blockchain-fetcher"
 )
 
@@ -12,6 +13,7 @@ type RateUSD struct {
 type FetcherInterface interface {
 	EthCall(string, string) (string, error)
 	GetLatestBlock() (string, error)
+	GetFeeHistory(blockCount int, percentiles []float64) (*ethereum.FeeHistory, error)
 	// GetEvents(string, string, string, string) (*[]ethereum.EventRaw, error)
 
 	// GetRateUsd([]string) ([]io.ReadCloser, error)
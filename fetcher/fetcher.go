@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"log"
+	"math/big"
 	"sync"
 
 	"time"
@@ -20,8 +21,16 @@ const (
 
 	timeW8Req         = 500
 	timeW8CheckStatus = 3 * time.Second
+
+	feeHistoryBlocks = 10
 )
 
+// reward percentiles of slow, standard and fast tiers
+var feeHistoryPercentiles = []float64{10, 50, 90}
+
+// ErrTokenNotFound returned when a token symbol is not in the token list
+var ErrTokenNotFound = errors.New("Token is not existed")
+
 type Connection struct {
 	Endpoint string `json:"endPoint"`
 	Type     string `json:"type"`
@@ -281,6 +290,81 @@ func (self *Fetcher) GetGasPrice() (*ethereum.GasPrice, error) {
 	return result, nil
 }
 
+// FeeHistorySource serve eth_feeHistory, e.g. the node cache
+type FeeHistorySource interface {
+	FeeHistory(blockCount int, percentiles []float64) (*ethereum.FeeHistory, error)
+}
+
+// GetEIP1559GasPrice recommend EIP-1559 fees from the fee history of source,
+// the nodes of the fetcher are only called when source fails
+func (self *Fetcher) GetEIP1559GasPrice(source FeeHistorySource) (*ethereum.EIP1559GasPrice, error) {
+	feeHistory, err := source.FeeHistory(feeHistoryBlocks, feeHistoryPercentiles)
+	if err == nil {
+		var gasPrice *ethereum.EIP1559GasPrice
+		if gasPrice, err = calculateEIP1559GasPrice(feeHistory); err == nil {
+			return gasPrice, nil
+		}
+	}
+	log.Print(err)
+	for _, fetIns := range self.fetIns {
+		feeHistory, err := fetIns.GetFeeHistory(feeHistoryBlocks, feeHistoryPercentiles)
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		gasPrice, err := calculateEIP1559GasPrice(feeHistory)
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		return gasPrice, nil
+	}
+	return nil, errors.New("Cannot get fee history")
+}
+
+func calculateEIP1559GasPrice(feeHistory *ethereum.FeeHistory) (*ethereum.EIP1559GasPrice, error) {
+	if len(feeHistory.BaseFeePerGas) == 0 || len(feeHistory.Reward) == 0 {
+		return nil, errors.New("fee history is empty")
+	}
+	// the last base fee is the one of the next block
+	baseFee := feeHistory.BaseFeePerGas[len(feeHistory.BaseFeePerGas)-1]
+
+	tiers := make([]ethereum.FeeRecommendation, len(feeHistoryPercentiles))
+	for i := range feeHistoryPercentiles {
+		sum := big.NewInt(0)
+		count := int64(0)
+		for _, rewards := range feeHistory.Reward {
+			if i < len(rewards) {
+				sum.Add(sum, rewards[i])
+				count++
+			}
+		}
+		if count == 0 {
+			return nil, errors.New("fee history has no reward")
+		}
+		priorityFee := sum.Div(sum, big.NewInt(count))
+		// leave room for base fee to double before the tx is included
+		maxFee := new(big.Int).Mul(baseFee, big.NewInt(2))
+		maxFee.Add(maxFee, priorityFee)
+		tiers[i] = ethereum.FeeRecommendation{
+			MaxFeePerGas:         weiToGwei(maxFee),
+			MaxPriorityFeePerGas: weiToGwei(priorityFee),
+		}
+	}
+
+	return &ethereum.EIP1559GasPrice{
+		BaseFee:  weiToGwei(baseFee),
+		Slow:     tiers[0],
+		Standard: tiers[1],
+		Fast:     tiers[2],
+	}, nil
+}
+
+// weiToGwei format wei in gwei with 9 decimals, so fees of a few wei on low-fee chains are kept
+func weiToGwei(wei *big.Int) string {
+	return new(big.Rat).SetFrac(wei, big.NewInt(1e9)).FloatString(9)
+}
+
 func (self *Fetcher) GetMaxGasPrice() (string, error) {
 	dataAbi, err := self.ethereum.EncodeMaxGasPrice()
 	if err != nil {
@@ -353,9 +437,8 @@ func (self *Fetcher) GetTokenBySymbol(symbol string) (*ethereum.Token, error) {
 			return &token, nil
 		}
 	}
-	err := errors.New("Token is not existed")
-	log.Println(err)
-	return nil, err
+	log.Println(ErrTokenNotFound)
+	return nil, ErrTokenNotFound
 }
 
 func (self *Fetcher) FetchRate() ([]ethereum.Rate, error) {
@@ -0,0 +1,106 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/KyberNetwork/cache/ethereum"
+	"github.com/stretchr/testify/assert"
+)
+
+func gwei(values ...int64) []*big.Int {
+	result := make([]*big.Int, 0, len(values))
+	for _, value := range values {
+		result = append(result, new(big.Int).Mul(big.NewInt(value), big.NewInt(1e9)))
+	}
+	return result
+}
+
+func TestCalculateEIP1559GasPrice(t *testing.T) {
+	tests := []struct {
+		name       string
+		feeHistory ethereum.FeeHistory
+		expected   *ethereum.EIP1559GasPrice
+		err        bool
+	}{
+		{name: "no base fee", feeHistory: ethereum.FeeHistory{Reward: [][]*big.Int{gwei(1, 2, 3)}}, err: true},
+		{name: "no reward", feeHistory: ethereum.FeeHistory{BaseFeePerGas: gwei(1)}, err: true},
+		{name: "empty rewards", feeHistory: ethereum.FeeHistory{BaseFeePerGas: gwei(1), Reward: [][]*big.Int{{}, {}}}, err: true},
+		{
+			name:       "average of blocks, max fee leaves room for base fee to double",
+			feeHistory: ethereum.FeeHistory{BaseFeePerGas: gwei(1, 2), Reward: [][]*big.Int{gwei(1, 2, 3), gwei(3, 4, 5)}},
+			expected: &ethereum.EIP1559GasPrice{
+				BaseFee:  "2.000000000",
+				Slow:     ethereum.FeeRecommendation{MaxFeePerGas: "6.000000000", MaxPriorityFeePerGas: "2.000000000"},
+				Standard: ethereum.FeeRecommendation{MaxFeePerGas: "7.000000000", MaxPriorityFeePerGas: "3.000000000"},
+				Fast:     ethereum.FeeRecommendation{MaxFeePerGas: "8.000000000", MaxPriorityFeePerGas: "4.000000000"},
+			},
+		},
+		{
+			name:       "zero base fee",
+			feeHistory: ethereum.FeeHistory{BaseFeePerGas: gwei(0), Reward: [][]*big.Int{gwei(1, 2, 3)}},
+			expected: &ethereum.EIP1559GasPrice{
+				BaseFee:  "0.000000000",
+				Slow:     ethereum.FeeRecommendation{MaxFeePerGas: "1.000000000", MaxPriorityFeePerGas: "1.000000000"},
+				Standard: ethereum.FeeRecommendation{MaxFeePerGas: "2.000000000", MaxPriorityFeePerGas: "2.000000000"},
+				Fast:     ethereum.FeeRecommendation{MaxFeePerGas: "3.000000000", MaxPriorityFeePerGas: "3.000000000"},
+			},
+		},
+		{
+			name:       "low-fee chain keeps tips of a few wei",
+			feeHistory: ethereum.FeeHistory{BaseFeePerGas: []*big.Int{big.NewInt(7)}, Reward: [][]*big.Int{{big.NewInt(1), big.NewInt(2), big.NewInt(1500)}}},
+			expected: &ethereum.EIP1559GasPrice{
+				BaseFee:  "0.000000007",
+				Slow:     ethereum.FeeRecommendation{MaxFeePerGas: "0.000000015", MaxPriorityFeePerGas: "0.000000001"},
+				Standard: ethereum.FeeRecommendation{MaxFeePerGas: "0.000000016", MaxPriorityFeePerGas: "0.000000002"},
+				Fast:     ethereum.FeeRecommendation{MaxFeePerGas: "0.000001514", MaxPriorityFeePerGas: "0.000001500"},
+			},
+		},
+	}
+	for _, test := range tests {
+		gasPrice, err := calculateEIP1559GasPrice(&test.feeHistory)
+		if test.err {
+			assert.NotNil(t, err, test.name)
+			continue
+		}
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, test.expected, gasPrice, test.name)
+	}
+}
+
+type feeHistorySource struct {
+	feeHistory *ethereum.FeeHistory
+	err        error
+}
+
+func (s feeHistorySource) FeeHistory(blockCount int, percentiles []float64) (*ethereum.FeeHistory, error) {
+	return s.feeHistory, s.err
+}
+
+func TestGetEIP1559GasPrice(t *testing.T) {
+	fetcher := &Fetcher{}
+	gasPrice, err := fetcher.GetEIP1559GasPrice(feeHistorySource{feeHistory: &ethereum.FeeHistory{BaseFeePerGas: gwei(1), Reward: [][]*big.Int{gwei(1, 2, 3)}}})
+	assert.Nil(t, err)
+	assert.Equal(t, "1.000000000", gasPrice.BaseFee)
+
+	// without other nodes to fall back to
+	_, err = fetcher.GetEIP1559GasPrice(feeHistorySource{err: errors.New("node is down")})
+	assert.NotNil(t, err)
+}
+
+func TestRateLiquidity(t *testing.T) {
+	var rate TokenRate
+	assert.Nil(t, json.Unmarshal([]byte(`{"base_symbol":"KNC","quote_symbol":"ETH","current_bid":0.002,"current_ask":0.0025,"eth_24h_volume":123.5}`), &rate))
+
+	buy := getRateBuy(rate)
+	assert.Equal(t, "ETH", buy.Source)
+	assert.Equal(t, 123.5, buy.Liquidity)
+	sell := getRateSell(rate)
+	assert.Equal(t, "KNC", sell.Source)
+	assert.Equal(t, 123.5, sell.Liquidity)
+
+	rate.RateBuy = 0
+	assert.Equal(t, 123.5, getRateBuy(rate).Liquidity)
+}
@@ -159,6 +159,7 @@ type TokenRate struct {
 	QuoteSymbol string  `json:"quote_symbol"`
 	RateSell    float64 `json:"current_bid"`
 	RateBuy     float64 `json:"current_ask"`
+	ETHVolume   float64 `json:"eth_24h_volume"`
 }
 
 type MarketData struct {
@@ -199,10 +200,12 @@ func (self *HTTPFetcher) GetRate() ([]ethereum.Rate, error) {
 func getRateBuy(rate TokenRate) ethereum.Rate {
 	if rate.RateBuy == 0 {
 		return ethereum.Rate{
-			Source:  rate.QuoteSymbol,
-			Dest:    rate.BaseSymbol,
-			Rate:    "0",
-			Minrate: "0",
+			Source:    rate.QuoteSymbol,
+			Dest:      rate.BaseSymbol,
+			Rate:      "0",
+			Minrate:   "0",
+			Liquidity: rate.ETHVolume,
+			Provider:  ethereum.RateProviderMarket,
 		}
 	}
 	rateBuy := 1 / rate.RateBuy
@@ -212,10 +215,12 @@ func getRateBuy(rate TokenRate) ethereum.Rate {
 	minRateBig := common.ToWei(minRate, 18)
 
 	return ethereum.Rate{
-		Source:  rate.QuoteSymbol,
-		Dest:    rate.BaseSymbol,
-		Rate:    rateBig.String(),
-		Minrate: minRateBig.String(),
+		Source:    rate.QuoteSymbol,
+		Dest:      rate.BaseSymbol,
+		Rate:      rateBig.String(),
+		Minrate:   minRateBig.String(),
+		Liquidity: rate.ETHVolume,
+		Provider:  ethereum.RateProviderMarket,
 	}
 }
 
@@ -224,10 +229,12 @@ func getRateSell(rate TokenRate) ethereum.Rate {
 	minRateBig := common.ToWei(rate.RateSell*0.97, 18)
 
 	return ethereum.Rate{
-		Source:  rate.BaseSymbol,
-		Dest:    rate.QuoteSymbol,
-		Rate:    rateBig.String(),
-		Minrate: minRateBig.String(),
+		Source:    rate.BaseSymbol,
+		Dest:      rate.QuoteSymbol,
+		Rate:      rateBig.String(),
+		Minrate:   minRateBig.String(),
+		Liquidity: rate.ETHVolume,
+		Provider:  ethereum.RateProviderMarket,
 	}
 }
 
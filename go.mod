@@ -7,6 +7,7 @@ require (
 	github.com/aristanetworks/goarista v0.0.0-20200521140103-6c3304613b30 // indirect
 	github.com/btcsuite/btcd v0.0.0-20180129053456-9aa9e79ebf7f // indirect
 	github.com/certifi/gocertifi v0.0.0-20180118203423-deb3ae2ef261 // indirect
+	github.com/cespare/xxhash/v2 v2.1.1
 	github.com/deckarep/golang-set v1.7.1 // indirect
 	github.com/ethereum/go-ethereum v1.8.27
 	github.com/getsentry/raven-go v0.0.0-20180121060056-563b81fc02b7
@@ -14,8 +15,10 @@ require (
 	github.com/gin-contrib/sentry v0.0.0-20170917021533-5806d6ecb7b2
 	github.com/gin-contrib/sse v0.0.0-20170109093832-22d885f9ecc7 // indirect
 	github.com/gin-gonic/gin v1.1.5-0.20180126034611-783c7ee9c14e
+	github.com/google/uuid v1.0.0
 	github.com/mattn/go-isatty v0.0.4 // indirect
 	github.com/pborman/uuid v1.2.0 // indirect
+	github.com/prometheus/client_golang v1.7.1
 	github.com/rcrowley/go-metrics v0.0.0-20200313005456-10cdbea86bc0 // indirect
 	github.com/rjeczalik/notify v0.9.2 // indirect
 	github.com/rs/cors v1.3.0 // indirect
@@ -23,6 +26,8 @@ require (
 	github.com/syndtr/goleveldb v1.0.0 // indirect
 	github.com/ugorji/go v0.0.0-20180112141927-9831f2c3ac10 // indirect
 	golang.org/x/crypto v0.0.0-20200510223506-06a226fb4e37 // indirect
+	golang.org/x/net v0.0.0-20200226121028-0de0cce0169b
+	golang.org/x/sync v0.0.0-20200625203802-6e8e738ad208
 	golang.org/x/tools v0.0.0-20200527183253-8e7acdbce89d // indirect
 	gopkg.in/fatih/set.v0 v0.2.1 // indirect
 	gopkg.in/go-playground/validator.v8 v8.18.2 // indirect
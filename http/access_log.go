@@ -0,0 +1,50 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KyberNetwork/cache/node"
+	"github.com/gin-gonic/gin"
+)
+
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessLogger write one line per request in Combined Log Format,
+// followed by the cache status of proxied node requests
+func accessLogger(w io.Writer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		size := "-"
+		if c.Writer.Size() > 0 {
+			size = strconv.Itoa(c.Writer.Size())
+		}
+		fmt.Fprintf(w, "%s - - [%s] \"%s %s %s\" %d %s \"%s\" \"%s\" \"%s\"\n",
+			c.ClientIP(),
+			start.Format(clfTimeFormat),
+			c.Request.Method,
+			c.Request.RequestURI,
+			c.Request.Proto,
+			c.Writer.Status(),
+			size,
+			clfField(c.Request.Referer()),
+			clfField(c.Request.UserAgent()),
+			clfField(c.GetString(node.CacheStatusContextKey)),
+		)
+	}
+}
+
+// clfEscaper escape quotes so a field can not end its quoted string early
+var clfEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func clfField(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return clfEscaper.Replace(value)
+}
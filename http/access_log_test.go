@@ -0,0 +1,41 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/KyberNetwork/cache/node"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLogger(t *testing.T) {
+	var buf bytes.Buffer
+	r := gin.New()
+	r.Use(accessLogger(&buf))
+	r.POST("/node", func(c *gin.Context) {
+		c.Set(node.CacheStatusContextKey, "HIT")
+		c.String(http.StatusOK, "hello")
+	})
+	r.GET("/empty", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest("POST", "/node?x=1", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("Referer", "https://wallet.example/")
+	req.Header.Set("User-Agent", `agent "1.0"`)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	line := regexp.MustCompile(`^10\.0\.0\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "POST /node\?x=1 HTTP/1\.1" 200 5 "https://wallet\.example/" "agent \\"1\.0\\"" "HIT"\n$`)
+	assert.Regexp(t, line, buf.String())
+
+	buf.Reset()
+	req = httptest.NewRequest("GET", "/empty", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	line = regexp.MustCompile(`^10\.0\.0\.2 - - \[[^\]]+\] "GET /empty HTTP/1\.1" 204 - "-" "-" "-"\n$`)
+	assert.Regexp(t, line, buf.String())
+}
@@ -0,0 +1,115 @@
+package http
+
+import (
+	"crypto/subtle"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const adminTokenHeader = "X-Admin-Token"
+
+// adminAuth only allow requests carrying the configured admin token in X-Admin-Token,
+// it is not read from the query so it never ends up in request logs
+func adminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(adminTokenHeader)), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(
+				http.StatusUnauthorized,
+				gin.H{"success": false, "error": "unauthorized"},
+			)
+			return
+		}
+		c.Next()
+	}
+}
+
+func (self *HTTPServer) GetProxyAudit(c *gin.Context) {
+	audit, enabled := self.node.ProxyAudit()
+	if !enabled {
+		self.writeJSON(
+			c,
+			http.StatusNotFound,
+			gin.H{"success": false, "error": "proxy audit is disabled"},
+		)
+		return
+	}
+	self.writeJSON(
+		c,
+		http.StatusOK,
+		gin.H{"success": true, "data": audit},
+	)
+}
+
+func (self *HTTPServer) ExplainProxyRequest(c *gin.Context) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		self.writeJSON(
+			c,
+			http.StatusBadRequest,
+			gin.H{"success": false, "error": err.Error()},
+		)
+		return
+	}
+	explain, err := self.node.Explain(body)
+	if err != nil {
+		self.writeJSON(
+			c,
+			http.StatusBadRequest,
+			gin.H{"success": false, "error": err.Error()},
+		)
+		return
+	}
+	self.writeJSON(
+		c,
+		http.StatusOK,
+		gin.H{"success": true, "data": explain},
+	)
+}
+
+func (self *HTTPServer) GetNodeInfo(c *gin.Context) {
+	self.writeJSON(
+		c,
+		http.StatusOK,
+		gin.H{"success": true, "data": self.node.NodeInfo()},
+	)
+}
+
+func (self *HTTPServer) GetWarmup(c *gin.Context) {
+	self.writeJSON(
+		c,
+		http.StatusOK,
+		gin.H{"success": true, "data": self.node.WarmupProgress()},
+	)
+}
+
+func (self *HTTPServer) GetBundle(c *gin.Context) {
+	self.writeJSON(
+		c,
+		http.StatusOK,
+		gin.H{"success": true, "data": self.node.Bundle()},
+	)
+}
+
+// RefreshNodeCache refresh the cached method of ?method, or all of them, and report failures
+func (self *HTTPServer) RefreshNodeCache(c *gin.Context) {
+	result, err := self.node.Refresh(c.Query("method"))
+	if err != nil {
+		self.writeJSON(
+			c,
+			http.StatusBadRequest,
+			gin.H{"success": false, "error": err.Error()},
+		)
+		return
+	}
+	status := http.StatusOK
+	if len(result.Failed) > 0 {
+		status = http.StatusBadGateway
+	}
+	self.writeJSON(
+		c,
+		status,
+		gin.H{"success": len(result.Failed) == 0, "data": result},
+	)
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/KyberNetwork/cache/node"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestNodeMiddleware(t *testing.T) (*node.NodeMiddleware, func()) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	os.Setenv("NODE_ENDPOINT", upstream.URL)
+	defer os.Unsetenv("NODE_ENDPOINT")
+	nodeMiddleware, err := node.NewNodeMiddleware()
+	assert.Nil(t, err)
+	return nodeMiddleware, func() {
+		nodeMiddleware.Close()
+		upstream.Close()
+	}
+}
+
+func TestGetProxyAudit(t *testing.T) {
+	nodeMiddleware, closeNode := newTestNodeMiddleware(t)
+	defer closeNode()
+	server := &HTTPServer{r: gin.New(), node: nodeMiddleware}
+	server.r.GET("/node/proxyAudit", adminAuth("secret"), server.GetProxyAudit)
+
+	req := httptest.NewRequest("GET", "/node/proxyAudit", nil)
+	req.Header.Set(adminTokenHeader, "secret")
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"success":false,"error":"proxy audit is disabled"}`, w.Body.String())
+
+	os.Setenv("PROXY_AUDIT", "true")
+	defer os.Unsetenv("PROXY_AUDIT")
+	nodeMiddleware, closeNode = newTestNodeMiddleware(t)
+	defer closeNode()
+	server = &HTTPServer{r: gin.New(), node: nodeMiddleware}
+	server.r.POST("/node", server.PostNodeRequest)
+	server.r.GET("/node/proxyAudit", adminAuth("secret"), server.GetProxyAudit)
+
+	for _, address := range []string{"0x1", "0x2", "0x1"} {
+		body := `{"jsonrpc":"2.0","id":1,"method":"eth_getCode","params":["` + address + `","latest"]}`
+		w = httptest.NewRecorder()
+		server.r.ServeHTTP(w, httptest.NewRequest("POST", "/node", strings.NewReader(body)))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/node/proxyAudit", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"success":true,"data":[{"method":"eth_getCode","count":3,"uniqueParams":2}]}`, w.Body.String())
+}
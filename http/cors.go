@@ -0,0 +1,52 @@
+package http
+
+import (
+	"time"
+
+	"github.com/gin-contrib/cors"
+)
+
+var (
+	defaultCORSMethods = []string{"DELETE", "GET", "OPTIONS", "PATCH", "POST", "PUT"}
+	defaultCORSHeaders = []string{"accept", "accept-encoding", "authorization", "content-type", "dnt", "origin", "user-agent", "x-csrftoken", "x-requested-with", "alchemy-web3-version", "x-request-id", "cache-control"}
+)
+
+// CORSConfig allowlist of cross-origin requests, empty Methods or Headers keep the default ones
+type CORSConfig struct {
+	Origins     []string
+	Methods     []string
+	Headers     []string
+	Credentials bool
+}
+
+// Validate check the config can be used, origins must be "*" or start with http:// or https://
+func (config CORSConfig) Validate() error {
+	return config.corsConfig().Validate()
+}
+
+func (config CORSConfig) corsConfig() cors.Config {
+	corsConfig := defaultCORSConfig()
+	corsConfig.AllowAllOrigins = false
+	corsConfig.AllowOrigins = config.Origins
+	if len(config.Methods) > 0 {
+		corsConfig.AllowMethods = config.Methods
+	}
+	if len(config.Headers) > 0 {
+		corsConfig.AllowHeaders = config.Headers
+	}
+	corsConfig.AllowCredentials = config.Credentials
+	return corsConfig
+}
+
+// defaultCORSConfig allow every origin, used when no allowlist is given
+func defaultCORSConfig() cors.Config {
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowAllOrigins = true
+	corsConfig.AllowMethods = defaultCORSMethods
+	corsConfig.AllowHeaders = defaultCORSHeaders
+	corsConfig.ExposeHeaders = []string{"X-Request-ID"}
+	corsConfig.AllowCredentials = true
+
+	corsConfig.MaxAge = 5 * time.Minute
+	return corsConfig
+}
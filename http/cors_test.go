@@ -0,0 +1,62 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSAllowlist(t *testing.T) {
+	config := CORSConfig{Origins: []string{"https://wallet.example.com"}}
+	assert.Nil(t, config.Validate())
+	r := gin.New()
+	r.Use(cors.New(config.corsConfig()))
+	r.GET("/rate", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	req := httptest.NewRequest("GET", "/rate", nil)
+	req.Header.Set("Origin", "https://wallet.example.com")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "https://wallet.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Credentials"))
+
+	req = httptest.NewRequest("GET", "/rate", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	assert.NotNil(t, CORSConfig{Origins: []string{"wallet.example.com"}}.Validate())
+}
+
+func TestCORSNodeRoute(t *testing.T) {
+	nodeMiddleware, closeNode := newTestNodeMiddleware(t)
+	defer closeNode()
+	server := &HTTPServer{r: gin.New(), node: nodeMiddleware}
+	config := CORSConfig{Origins: []string{"https://wallet.example.com"}, Credentials: true}
+	server.r.Use(cors.New(config.corsConfig()))
+	server.r.POST("/node", server.PostNodeRequest)
+
+	send := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/node", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	// only the allowlisted origin is echoed, never *
+	w := send("https://wallet.example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://wallet.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+
+	w = send("https://evil.example.com")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultErrorLogCacheSeconds = 2
+	defaultErrorLogRoute        = "/debug/errorLog"
+	defaultErrorLogPath         = "error.log"
+
+	// defaultErrorLogLines lines returned when ?lines is not set
+	defaultErrorLogLines = 1000
+	maxErrorLogLines     = 10000
+	errorLogChunkBytes   = 4096
+)
+
+type errorLogEntry struct {
+	data     []byte
+	lines    int // requested lines, data has fewer when the file does
+	expireAt time.Time
+}
+
+// errorLogCache share concurrent reads of the tail of the error log and keep the
+// longest recent one in memory for a short time, shorter tails are sliced from it
+type errorLogCache struct {
+	path  string
+	mu    sync.Mutex
+	group singleflight.Group
+	ttl   time.Duration
+	entry errorLogEntry
+}
+
+func newErrorLogCache(path string, ttl time.Duration) *errorLogCache {
+	return &errorLogCache{path: path, ttl: ttl}
+}
+
+// tail last lines of the error log
+func (self *errorLogCache) tail(lines int) ([]byte, error) {
+	self.mu.Lock()
+	entry := self.entry
+	self.mu.Unlock()
+	if self.ttl > 0 && entry.lines >= lines && time.Now().Before(entry.expireAt) {
+		if start := tailStart(entry.data, lines); start >= 0 {
+			return entry.data[start:], nil
+		}
+		return entry.data, nil
+	}
+
+	result, err, _ := self.group.Do(strconv.Itoa(lines), func() (interface{}, error) {
+		f, err := os.Open(self.path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		data, err := tailLines(f, lines)
+		if err != nil {
+			return nil, err
+		}
+		// a longer tail which is still fresh is kept
+		now := time.Now()
+		self.mu.Lock()
+		if lines >= self.entry.lines || !now.Before(self.entry.expireAt) {
+			self.entry = errorLogEntry{data: data, lines: lines, expireAt: now.Add(self.ttl)}
+		}
+		self.mu.Unlock()
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]byte), nil
+}
+
+// open the error log to stream it whole
+func (self *errorLogCache) open() (*os.File, error) {
+	return os.Open(self.path)
+}
+
+// tailLines read the last n lines of f backwards from its end, chunk by chunk
+func tailLines(f *os.File, n int) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	pos := info.Size()
+	var data []byte
+	for pos > 0 {
+		size := int64(errorLogChunkBytes)
+		if pos < size {
+			size = pos
+		}
+		pos -= size
+		chunk := make([]byte, size, int64(len(data))+size)
+		if _, err := f.ReadAt(chunk, pos); err != nil {
+			return nil, err
+		}
+		data = append(chunk, data...)
+		if start := tailStart(data, n); start >= 0 {
+			return data[start:], nil
+		}
+	}
+	return data, nil
+}
+
+// tailStart index of the first byte of the last n lines of data, -1 when data has fewer lines.
+// A newline ending data does not start a new line
+func tailStart(data []byte, n int) int {
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end--
+	}
+	for i := end - 1; i >= 0; i-- {
+		if data[i] == '\n' {
+			n--
+			if n == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,87 @@
+package http
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorLogCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errorlog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "error.log")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("first\n"), 0644))
+
+	cache := newErrorLogCache(path, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := cache.tail(10)
+			assert.NoError(t, err)
+			assert.Equal(t, "first\n", string(data))
+		}()
+	}
+	wg.Wait()
+
+	// served from memory until it expires
+	assert.NoError(t, ioutil.WriteFile(path, []byte("first\nsecond\n"), 0644))
+	data, err := cache.tail(10)
+	assert.NoError(t, err)
+	assert.Equal(t, "first\n", string(data))
+	// shorter tails are sliced from the cached one, longer ones read the file and replace it
+	data, err = cache.tail(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "first\n", string(data))
+	data, err = cache.tail(20)
+	assert.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n", string(data))
+	data, err = cache.tail(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "second\n", string(data))
+	assert.Equal(t, 20, cache.entry.lines)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("first\nsecond\nthird\n"), 0644))
+	cache.mu.Lock()
+	cache.entry.expireAt = time.Now().Add(-time.Second)
+	cache.mu.Unlock()
+	data, err = cache.tail(2)
+	assert.NoError(t, err)
+	assert.Equal(t, "second\nthird\n", string(data))
+	assert.Equal(t, 2, cache.entry.lines)
+
+	// without ttl every call reads the file
+	cache = newErrorLogCache(path, 0)
+	assert.NoError(t, ioutil.WriteFile(path, []byte("third"), 0644))
+	data, err = cache.tail(10)
+	assert.NoError(t, err)
+	assert.Equal(t, "third", string(data))
+	assert.NoError(t, ioutil.WriteFile(path, []byte("fourth"), 0644))
+	data, err = cache.tail(10)
+	assert.NoError(t, err)
+	assert.Equal(t, "fourth", string(data))
+}
+
+func TestTailStart(t *testing.T) {
+	tests := []struct {
+		data     string
+		lines    int
+		expected int
+	}{
+		{data: "", lines: 1, expected: -1},
+		{data: "a\nb\nc\n", lines: 1, expected: 4},
+		{data: "a\nb\nc", lines: 2, expected: 2},
+		{data: "a\nb\nc\n", lines: 3, expected: -1},
+		{data: "\n\n", lines: 1, expected: 1},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, tailStart([]byte(test.data), test.lines), "%q", test.data)
+	}
+}
@@ -0,0 +1,61 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseFields names of ?fields, nil when every field is wanted
+func parseFields(value string) map[string]bool {
+	var fields map[string]bool
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if fields == nil {
+			fields = make(map[string]bool)
+		}
+		fields[name] = true
+	}
+	return fields
+}
+
+// maskFields keep only fields of an object, or of each object of an array, values which
+// are not objects are kept as they are. Unknown names are ignored, names may be in the
+// casing of the response
+func (self *HTTPServer) maskFields(data interface{}, fields map[string]bool) interface{} {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return data
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return data
+	}
+	mask := func(value interface{}) interface{} {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		// a gin.H, so its names are renamed by the casing policy like the ones of the struct
+		masked := make(gin.H, len(fields))
+		for key, item := range object {
+			if fields[key] || fields[convertCase(key, self.casing)] {
+				masked[key] = item
+			}
+		}
+		return masked
+	}
+	if items, ok := generic.([]interface{}); ok {
+		for i, item := range items {
+			items[i] = mask(item)
+		}
+		return items
+	}
+	return mask(generic)
+}
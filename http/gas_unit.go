@@ -0,0 +1,74 @@
+package http
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/KyberNetwork/cache/ethereum"
+)
+
+// units of ?unit on /gasPrice, the persister keeps gas prices in gwei
+const (
+	gasUnitWei   = "wei"
+	gasUnitGwei  = "gwei"
+	gasUnitEther = "ether"
+)
+
+// parseGasUnit validate ?unit, gwei when empty
+func parseGasUnit(value string) (string, error) {
+	switch value {
+	case "":
+		return gasUnitGwei, nil
+	case gasUnitWei, gasUnitGwei, gasUnitEther:
+		return value, nil
+	}
+	return "", errors.New("unit must be wei, gwei or ether")
+}
+
+// convertGwei convert a decimal amount in gwei to unit, wei are rounded to an integer.
+// Amounts which are not numbers are returned as is
+func convertGwei(amount string, unit string) string {
+	value, ok := new(big.Rat).SetString(amount)
+	if !ok || unit == gasUnitGwei {
+		return amount
+	}
+	gwei := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(9), nil))
+	if unit == gasUnitWei {
+		return value.Mul(value, gwei).FloatString(0)
+	}
+	ether := value.Quo(value, gwei).FloatString(rateDecimals)
+	ether = strings.TrimRight(ether, "0")
+	return strings.TrimSuffix(ether, ".")
+}
+
+func convertGasPrice(gasPrice *ethereum.GasPrice, unit string) *ethereum.GasPrice {
+	if gasPrice == nil {
+		return nil
+	}
+	return &ethereum.GasPrice{
+		Fast:     convertGwei(gasPrice.Fast, unit),
+		Standard: convertGwei(gasPrice.Standard, unit),
+		Low:      convertGwei(gasPrice.Low, unit),
+		Default:  convertGwei(gasPrice.Default, unit),
+	}
+}
+
+func convertFee(fee ethereum.FeeRecommendation, unit string) ethereum.FeeRecommendation {
+	return ethereum.FeeRecommendation{
+		MaxFeePerGas:         convertGwei(fee.MaxFeePerGas, unit),
+		MaxPriorityFeePerGas: convertGwei(fee.MaxPriorityFeePerGas, unit),
+	}
+}
+
+func convertEIP1559GasPrice(gasPrice *ethereum.EIP1559GasPrice, unit string) *ethereum.EIP1559GasPrice {
+	if gasPrice == nil {
+		return nil
+	}
+	return &ethereum.EIP1559GasPrice{
+		BaseFee:  convertGwei(gasPrice.BaseFee, unit),
+		Slow:     convertFee(gasPrice.Slow, unit),
+		Standard: convertFee(gasPrice.Standard, unit),
+		Fast:     convertFee(gasPrice.Fast, unit),
+	}
+}
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultCompressionMinSize responses smaller than this are not worth the CPU of compressing,
+// they hardly get smaller
+const defaultCompressionMinSize = 1024
+
+// gzipWriter compress response body written by handlers once it reaches minSize bytes,
+// smaller bodies are buffered then sent as is
+type gzipWriter struct {
+	gin.ResponseWriter
+	writer  *gzip.Writer
+	minSize int
+	buf      []byte
+	wrote    bool
+	finished bool
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	if w.wrote {
+		return w.writer.Write(data)
+	}
+	w.buf = append(w.buf, data...)
+	if len(w.buf) < w.minSize {
+		return len(data), nil
+	}
+	if err := w.start(); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// start compressing, the buffered body is the first compressed data
+func (w *gzipWriter) start() error {
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Del("Content-Length")
+	w.wrote = true
+	_, err := w.writer.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// finish close the gzip stream, or send the buffered body as is when it stayed small,
+// only the first call has an effect
+func (w *gzipWriter) finish() {
+	if w.finished {
+		return
+	}
+	w.finished = true
+	if w.wrote {
+		w.writer.Close()
+		return
+	}
+	if len(w.buf) > 0 {
+		w.ResponseWriter.Write(w.buf)
+	}
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *gzipWriter) Flush() {
+	if !w.wrote {
+		w.start()
+	}
+	w.writer.Flush()
+	w.ResponseWriter.Flush()
+}
+
+// gzipCompression compress responses of at least minSize bytes for clients accepting gzip,
+// level is one of compress/gzip levels, invalid levels fallback to gzip.DefaultCompression.
+// Event streams are not compressed so events are delivered without buffering, HEAD requests
+// are so headResponse can count the compressed body
+func gzipCompression(level, minSize int) gin.HandlerFunc {
+	if _, err := gzip.NewWriterLevel(ioutil.Discard, level); err != nil {
+		log.Printf("invalid compression level %d, use default level: %v", level, err)
+		level = gzip.DefaultCompression
+	}
+	pool := sync.Pool{
+		New: func() interface{} {
+			w, _ := gzip.NewWriterLevel(ioutil.Discard, level)
+			return w
+		},
+	}
+	return func(c *gin.Context) {
+		if !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") ||
+			strings.HasPrefix(c.Request.URL.Path, "/sse/") {
+			c.Next()
+			return
+		}
+
+		gz := pool.Get().(*gzip.Writer)
+		gz.Reset(c.Writer)
+		c.Header("Vary", "Accept-Encoding")
+		writer := &gzipWriter{ResponseWriter: c.Writer, writer: gz, minSize: minSize}
+		c.Writer = writer
+		defer func() {
+			writer.finish()
+			gz.Reset(ioutil.Discard)
+			pool.Put(gz)
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// headWriter count the body written by GET handlers without sending it
+type headWriter struct {
+	gin.ResponseWriter
+	size int
+}
+
+func (w *headWriter) Write(data []byte) (int, error) {
+	w.size += len(data)
+	return len(data), nil
+}
+
+func (w *headWriter) WriteString(s string) (int, error) {
+	w.size += len(s)
+	return len(s), nil
+}
+
+func (w *headWriter) Flush() {}
+
+// headResponse run a GET handler for HEAD request, send its headers with
+// the Content-Length of the body it would have written, compressed when GET is
+func headResponse(c *gin.Context) {
+	writer := c.Writer
+	if gz, ok := writer.(*gzipWriter); ok {
+		// compressed bytes are counted under the gzip writer
+		counter := &headWriter{ResponseWriter: gz.ResponseWriter}
+		gz.ResponseWriter = counter
+		gz.writer.Reset(counter)
+		c.Next()
+		gz.finish()
+		gz.ResponseWriter = counter.ResponseWriter
+		c.Header("Content-Length", strconv.Itoa(counter.size))
+		counter.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	c.Writer = &headWriter{ResponseWriter: writer}
+	c.Next()
+	size := c.Writer.(*headWriter).size
+	c.Writer = writer
+	c.Header("Content-Length", strconv.Itoa(size))
+	writer.WriteHeaderNow()
+}
+
+// read register a read endpoint, HEAD requests are served by the same handler
+// unless disabled by WithoutHeadRequests
+func (self *HTTPServer) read(path string, handler gin.HandlerFunc) {
+	self.r.GET(path, handler)
+	if self.headRequests {
+		self.r.HEAD(path, headResponse, handler)
+	}
+}
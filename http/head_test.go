@@ -0,0 +1,88 @@
+package http
+
+import (
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	persister "github.com/KyberNetwork/cache/persister"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeadRequests(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	server := &HTTPServer{r: gin.New(), persister: ramPersister, headRequests: true}
+	server.read("/latestBlock", server.GetLatestBlock)
+
+	// not changed, HEAD gets the status of GET
+	ramPersister.SetNewLatestBlock(false)
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("HEAD", "/latestBlock", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	assert.Nil(t, ramPersister.SaveLatestBlock("100"))
+	get := httptest.NewRecorder()
+	server.r.ServeHTTP(get, httptest.NewRequest("GET", "/latestBlock", nil))
+	assert.Equal(t, http.StatusOK, get.Code)
+
+	head := httptest.NewRecorder()
+	server.r.ServeHTTP(head, httptest.NewRequest("HEAD", "/latestBlock", nil))
+	assert.Equal(t, http.StatusOK, head.Code)
+	assert.Empty(t, head.Body.String())
+	assert.Equal(t, strconv.Itoa(get.Body.Len()), head.Header().Get("Content-Length"))
+	assert.Equal(t, get.Header().Get("Content-Type"), head.Header().Get("Content-Type"))
+}
+
+func TestWithoutHeadRequests(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	server := &HTTPServer{r: gin.New(), persister: ramPersister, headRequests: true}
+	WithoutHeadRequests()(server)
+	server.read("/latestBlock", server.GetLatestBlock)
+
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("HEAD", "/latestBlock", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHeadRequestsCompressed(t *testing.T) {
+	server := &HTTPServer{r: gin.New(), headRequests: true}
+	server.r.Use(gzipCompression(gzip.DefaultCompression, 100))
+	server.read("/large", func(c *gin.Context) {
+		c.String(http.StatusOK, strings.Repeat("rate ", 100))
+	})
+	server.read("/small", func(c *gin.Context) {
+		c.String(http.StatusOK, "rate")
+	})
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w
+	}
+
+	// HEAD reports the compressed length and encoding of GET
+	get := send("GET", "/large")
+	assert.Equal(t, "gzip", get.Header().Get("Content-Encoding"))
+	head := send("HEAD", "/large")
+	assert.Equal(t, http.StatusOK, head.Code)
+	assert.Empty(t, head.Body.String())
+	assert.Equal(t, "gzip", head.Header().Get("Content-Encoding"))
+	assert.Equal(t, strconv.Itoa(get.Body.Len()), head.Header().Get("Content-Length"))
+
+	// bodies under the minimum size are sent as is by both
+	get = send("GET", "/small")
+	assert.Equal(t, "", get.Header().Get("Content-Encoding"))
+	head = send("HEAD", "/small")
+	assert.Equal(t, "", head.Header().Get("Content-Encoding"))
+	assert.Equal(t, strconv.Itoa(get.Body.Len()), head.Header().Get("Content-Length"))
+	assert.Empty(t, head.Body.String())
+}
@@ -0,0 +1,47 @@
+package http
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/KyberNetwork/cache/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// unmatchedRoute route tag of requests no route matched, keeps the number of series bounded
+	unmatchedRoute = "unmatched"
+
+	unmatchedContextKey = "unmatchedRoute"
+)
+
+// requestMetrics count requests and observe their latency per route, method and status
+func requestMetrics(sink metrics.MetricsSink) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.Request.URL.Path
+		if c.GetBool(unmatchedContextKey) {
+			route = unmatchedRoute
+		}
+		tags := map[string]string{"route": route, "method": c.Request.Method, "status": strconv.Itoa(c.Writer.Status())}
+		sink.Incr("http_requests_total", tags)
+		sink.Timing("http_request_duration_seconds", time.Since(start), map[string]string{"route": route, "method": c.Request.Method})
+	}
+}
+
+// markUnmatched no route handler, tell requestMetrics not to use the path as route.
+// gin still answers its default 404
+func markUnmatched(c *gin.Context) {
+	c.Set(unmatchedContextKey, true)
+}
+
+// GetMetrics serve metrics in Prometheus text format, the age of the latest block is
+// computed at scrape time
+func (self *HTTPServer) GetMetrics(c *gin.Context) {
+	if updatedAt := self.persister.GetTimeUpdateLatestBlock(); updatedAt != 0 {
+		self.metrics.Gauge("latest_block_age_seconds", float64(time.Now().Unix()-updatedAt), map[string]string{})
+	}
+	self.metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
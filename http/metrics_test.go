@@ -0,0 +1,37 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KyberNetwork/cache/metrics"
+	"github.com/KyberNetwork/cache/persister"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	assert.Nil(t, ramPersister.SaveLatestBlock("100"))
+	sink := metrics.NewPrometheusSink()
+	server := &HTTPServer{r: gin.New(), persister: ramPersister, metrics: sink, metricsHandler: sink.Handler()}
+	server.r.Use(requestMetrics(sink))
+	server.r.NoRoute(markUnmatched)
+	server.r.GET("/ready", server.GetReady)
+	server.r.GET("/metrics", server.GetMetrics)
+
+	for _, path := range []string{"/ready", "/ready", "/nope/0x1"} {
+		server.r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/ready",status="200"} 2`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/ready"} 2`)
+	assert.Contains(t, body, "latest_block_age_seconds")
+	assert.NotContains(t, body, "/nope")
+}
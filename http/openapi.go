@@ -0,0 +1,297 @@
+package http
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryParam a query parameter of an endpoint
+type queryParam struct {
+	Name        string
+	Description string
+	Type        string
+	Required    bool
+}
+
+// routeDoc description of a handler, aliases registered with the same handler share it
+type routeDoc struct {
+	Summary string
+	Query   []queryParam
+	// Data schema of the data field of the response, nil when the response has no envelope
+	Data gin.H
+	// Response schema of the whole response, used instead of the envelope when set
+	Response gin.H
+	Admin    bool
+}
+
+var (
+	stringSchema = gin.H{"type": "string"}
+	boolSchema   = gin.H{"type": "boolean"}
+	intSchema    = gin.H{"type": "integer"}
+	numberSchema = gin.H{"type": "number"}
+
+	rateSchema = gin.H{"type": "object", "properties": gin.H{
+		"source": stringSchema, "dest": stringSchema, "rate": stringSchema, "minRate": stringSchema,
+	}}
+	rateUSDSchema = gin.H{"type": "object", "properties": gin.H{
+		"symbol": stringSchema, "price_usd": stringSchema,
+	}}
+
+	precisionParam = queryParam{Name: "precision", Type: "integer", Description: "round values to N decimals (0-18)"}
+	fieldsParam    = queryParam{Name: "fields", Type: "string", Description: "comma separated fields of each item to return, unknown ones are ignored"}
+)
+
+func arraySchema(items gin.H) gin.H {
+	return gin.H{"type": "array", "items": items}
+}
+
+// routeDocs docs of handlers by method name, routes without a doc are still listed
+var routeDocs = map[string]routeDoc{
+	"GetLatestBlock": {
+		Summary: "Latest block number of network",
+		Query: []queryParam{
+			{Name: "confirmations", Type: "integer", Description: "return block latest - N"},
+			{Name: "maxAge", Type: "integer", Description: "fail with stale:true when the block was fetched more than maxAge seconds ago"},
+		},
+		Data: stringSchema,
+	},
+	"GetRateUSD": {
+		Summary: "USD price of tokens",
+		Query:   []queryParam{precisionParam},
+		Data:    arraySchema(rateUSDSchema),
+	},
+	"GetRate": {
+		Summary: "Rates of tokens with ETH",
+		Query: []queryParam{
+			{Name: "minLiquidity", Type: "number", Description: "only pairs with at least this ETH volume in last 24h"},
+			precisionParam,
+			{Name: "includeSource", Type: "boolean", Description: "add rateSource (market, network or wrapper) to each pair"},
+			{Name: "tokens", Type: "string", Description: "comma separated symbols, only pairs with one of them as source or dest"},
+			fieldsParam,
+		},
+		Data: arraySchema(rateSchema),
+	},
+	"GetRatesCombined": {
+		Summary: "Rates and rates USD in one payload",
+		Data: gin.H{"type": "object", "properties": gin.H{
+			"rates": arraySchema(rateSchema), "ratesUSD": arraySchema(rateUSDSchema),
+		}},
+	},
+	"GetKyberEnabled": {Summary: "Whether Kyber is enabled", Data: boolSchema},
+	"GetMaxGasPrice":  {Summary: "Max gas price from contract", Data: stringSchema},
+	"GetGasPrice": {
+		Summary: "Gas price with EIP-1559 fees",
+		Query:   []queryParam{{Name: "unit", Type: "string", Description: "wei, gwei (default) or ether"}},
+		Data: gin.H{"type": "object", "properties": gin.H{
+			"fast": stringSchema, "standard": stringSchema, "low": stringSchema, "default": stringSchema,
+			"eip1559": gin.H{"type": "object"},
+		}},
+	},
+	"GetRateHistory": {
+		Summary: "Rates of a token saved in the last RATE_HISTORY_RETENTION seconds, oldest first",
+		Query: []queryParam{
+			{Name: "token", Type: "string", Required: true},
+			{Name: "dest", Type: "string", Description: "dest of the pair, ETH by default"},
+			{Name: "from", Type: "integer", Description: "unix millis, first point included"},
+			{Name: "to", Type: "integer", Description: "unix millis, last point included"},
+		},
+		Data: arraySchema(gin.H{"type": "object", "properties": gin.H{"timestamp": intSchema, "rate": stringSchema}}),
+	},
+	"GetRatePair": {
+		Summary: "Rate of src to dst, direct, inverse of dst to src or derived through ETH",
+		Query: []queryParam{
+			{Name: "src", Type: "string", Required: true},
+			{Name: "dst", Type: "string", Required: true},
+		},
+		Data: gin.H{"type": "object", "properties": gin.H{
+			"source": stringSchema, "dest": stringSchema, "rate": stringSchema,
+			"derivation": stringSchema, "path": arraySchema(stringSchema),
+		}},
+	},
+	"GetRateETH":      {Summary: "USD price of ETH", Data: stringSchema},
+	"getCacheVersion": {Summary: "Current cache version", Data: stringSchema},
+	"GetReady":        {Summary: "Readiness probe, 503 once shutdown started", Response: gin.H{"type": "object", "properties": gin.H{"success": boolSchema}}},
+	"GetHealth": {
+		Summary: "Health probe, 503 when no rates were fetched or node cache refresh is older than HEALTH_NODE_MAX_AGE",
+		Response: gin.H{"type": "object", "properties": gin.H{
+			"success": boolSchema, "unhealthy": arraySchema(stringSchema),
+			"data": gin.H{"type": "object", "properties": gin.H{
+				"latestBlock": stringSchema, "latestBlockAgeSeconds": intSchema, "rateUpdatedAt": intSchema, "nodeLastRefresh": intSchema,
+			}},
+		}},
+	},
+	"GetRatesStream": {
+		Summary:  "Server-Sent Events stream of rates",
+		Query:    []queryParam{{Name: "format", Type: "string", Description: "full (default) or delta"}},
+		Response: gin.H{"type": "string"},
+	},
+	"GetUserInfo": {
+		Summary: "User stats info",
+		Query:   []queryParam{{Name: "address", Type: "string", Required: true}},
+		Response: gin.H{"type": "object", "properties": gin.H{
+			"cap": numberSchema, "kyced": boolSchema, "rich": boolSchema,
+		}},
+	},
+	"GetSourceAmount": {
+		Summary: "Source amount from dest amount",
+		Query: []queryParam{
+			{Name: "source", Type: "string", Required: true},
+			{Name: "dest", Type: "string", Required: true},
+			{Name: "destAmount", Type: "string", Required: true},
+		},
+		Response: gin.H{"type": "object", "properties": gin.H{"success": boolSchema, "value": stringSchema}},
+	},
+	"GetRefprice": {
+		Summary: "Reference price",
+		Query: []queryParam{
+			{Name: "base", Type: "string", Required: true},
+			{Name: "quote", Type: "string", Required: true},
+		},
+		Response: gin.H{"type": "object", "properties": gin.H{"success": boolSchema, "value": stringSchema}},
+	},
+	"PostNodeRequest": {Summary: "Proxy JSON-RPC requests to node", Response: gin.H{"type": "object"}},
+	"GetProxyAudit": {
+		Summary: "Counts of methods proxied to node",
+		Data: arraySchema(gin.H{"type": "object", "properties": gin.H{
+			"method": stringSchema, "count": intSchema, "uniqueParams": intSchema,
+		}}),
+		Admin: true,
+	},
+	"ExplainProxyRequest": {Summary: "Cache key and state of a JSON-RPC request", Data: gin.H{"type": "object"}, Admin: true},
+	"GetNodeInfo": {
+		Summary: "Version, chain id and network id of node",
+		Data: gin.H{"type": "object", "properties": gin.H{
+			"clientVersion": stringSchema, "chainId": stringSchema, "networkId": stringSchema,
+		}},
+		Admin: true,
+	},
+	"GetWarmup": {
+		Summary: "Warm-up progress of cached methods",
+		Data: gin.H{"type": "object", "properties": gin.H{
+			"total": intSchema, "warmed": intSchema, "failed": intSchema, "inProgress": intSchema,
+			"percentComplete": numberSchema, "ready": boolSchema,
+		}},
+		Admin: true,
+	},
+	"GetBundle": {
+		Summary: "Diagnostics bundle of node cache for support tickets",
+		Data: gin.H{"type": "object", "properties": gin.H{
+			"generatedAt": stringSchema, "config": gin.H{"type": "object"}, "latestBlock": intSchema,
+			"methods": arraySchema(gin.H{"type": "object"}), "warmup": gin.H{"type": "object"},
+			"upstreamErrors": arraySchema(gin.H{"type": "object", "properties": gin.H{
+				"time": stringSchema, "method": stringSchema, "error": stringSchema,
+			}}),
+			"nodeInfo": gin.H{"type": "object"}, "metrics": gin.H{"type": "object", "additionalProperties": numberSchema},
+		}},
+		Admin: true,
+	},
+	"GetErrorLog": {
+		Summary: "Last lines of error.log, 404 when it does not exist",
+		Query:   []queryParam{{Name: "lines", Type: "string", Description: "number of lines from the end (default 1000, at most 10000), all streams the whole file as text/plain"}},
+		Data:    stringSchema,
+		Admin:   true,
+	},
+	"RefreshNodeCache": {
+		Summary: "Refresh cached methods now, 502 when one failed",
+		Query:   []queryParam{{Name: "method", Type: "string", Description: "method of CACHE_METHODS, all of them by default"}},
+		Data: gin.H{"type": "object", "properties": gin.H{
+			"refreshed": arraySchema(stringSchema), "failed": gin.H{"type": "object", "additionalProperties": stringSchema},
+		}},
+		Admin: true,
+	},
+	"GetOpenAPI": {Summary: "This OpenAPI spec", Response: gin.H{"type": "object"}},
+	"GetCachedMethods": {
+		Summary: "Methods served from cache when called without params, with their refresh interval",
+		Data:    arraySchema(gin.H{"type": "object", "properties": gin.H{"method": stringSchema, "intervalSeconds": intSchema}}),
+	},
+	"GetMetrics": {Summary: "Metrics in Prometheus text format, only with ENABLE_METRICS=true", Response: gin.H{"type": "string"}},
+}
+
+// handlerName method name of a handler from its full function name,
+// e.g. github.com/KyberNetwork/cache/http.(*HTTPServer).GetRate-fm
+func handlerName(fullName string) string {
+	name := strings.TrimSuffix(fullName, "-fm")
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func (doc routeDoc) operation(method string) gin.H {
+	parameters := []gin.H{}
+	for _, param := range doc.Query {
+		parameters = append(parameters, gin.H{
+			"name":        param.Name,
+			"in":          "query",
+			"required":    param.Required,
+			"description": param.Description,
+			"schema":      gin.H{"type": param.Type},
+		})
+	}
+	schema := doc.Response
+	if schema == nil {
+		data := doc.Data
+		if data == nil {
+			data = gin.H{}
+		}
+		schema = gin.H{"type": "object", "properties": gin.H{"success": boolSchema, "data": data}}
+	}
+	response := gin.H{"description": "OK"}
+	// HEAD answers the headers of GET without body
+	if method != "head" {
+		response["content"] = gin.H{"application/json": gin.H{"schema": schema}}
+	}
+	op := gin.H{
+		"summary":    doc.Summary,
+		"parameters": parameters,
+		"responses":  gin.H{"200": response},
+	}
+	if doc.Admin {
+		op["security"] = []gin.H{{"adminToken": []string{}}}
+	}
+	return op
+}
+
+// openAPISpec OpenAPI 3 spec of the routes registered on r
+func openAPISpec(r *gin.Engine) gin.H {
+	routes := r.Routes()
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	paths := gin.H{}
+	for _, route := range routes {
+		name := handlerName(route.Handler)
+		doc, ok := routeDocs[name]
+		if !ok {
+			doc = routeDoc{Summary: name}
+		}
+		ops, ok := paths[route.Path].(gin.H)
+		if !ok {
+			ops = gin.H{}
+			paths[route.Path] = ops
+		}
+		method := strings.ToLower(route.Method)
+		ops[method] = doc.operation(method)
+	}
+	return gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":       "Kyber Swap Cache",
+			"version":     "1.0.0",
+			"description": "Send X-Api-Version: 2 (or ?apiVersion=2) to get fields renamed by the casing policy",
+		},
+		"paths": paths,
+		"components": gin.H{"securitySchemes": gin.H{
+			"adminToken": gin.H{"type": "apiKey", "in": "header", "name": adminTokenHeader},
+		}},
+	}
+}
+
+// GetOpenAPI serve the OpenAPI spec of registered routes, as is since
+// field names of the spec are not subject to the casing policy
+func (self *HTTPServer) GetOpenAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, openAPISpec(self.r))
+}
@@ -0,0 +1,36 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPISpecFromRoutes(t *testing.T) {
+	server := &HTTPServer{r: gin.New(), headRequests: true}
+	server.read("/getRate", server.GetRate)
+	server.read("/rate", server.GetRate)
+	server.r.POST("/node", server.PostNodeRequest)
+	server.r.GET("/undocumented", func(c *gin.Context) {})
+
+	paths := openAPISpec(server.r)["paths"].(gin.H)
+	assert.Len(t, paths, 4)
+
+	rate := paths["/rate"].(gin.H)
+	assert.Equal(t, paths["/getRate"], rate)
+	get := rate["get"].(gin.H)
+	assert.Equal(t, "Rates of tokens with ETH", get["summary"])
+	params := get["parameters"].([]gin.H)
+	assert.Equal(t, "minLiquidity", params[0]["name"])
+	assert.Equal(t, "precision", params[1]["name"])
+	assert.NotContains(t, rate["head"].(gin.H)["responses"].(gin.H)["200"], "content")
+
+	assert.Contains(t, paths["/node"], "post")
+	assert.Contains(t, paths["/undocumented"], "get")
+}
+
+func TestHandlerName(t *testing.T) {
+	assert.Equal(t, "GetRate", handlerName("github.com/KyberNetwork/cache/http.(*HTTPServer).GetRate-fm"))
+	assert.Equal(t, "func1", handlerName("github.com/KyberNetwork/cache/http.TestOpenAPISpecFromRoutes.func1"))
+}
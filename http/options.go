@@ -0,0 +1,87 @@
+package http
+
+import (
+	"io"
+	"net"
+
+	"github.com/KyberNetwork/cache/logger"
+)
+
+// ServerOption configure optional HTTPServer features
+type ServerOption func(*HTTPServer)
+
+// WithAccessLog write access log in Combined Log Format to w
+func WithAccessLog(w io.Writer) ServerOption {
+	return func(self *HTTPServer) {
+		self.accessLog = w
+	}
+}
+
+// WithoutDefaultLogger disable gin request logger, e.g. when access log replaces it
+func WithoutDefaultLogger() ServerOption {
+	return func(self *HTTPServer) {
+		self.disableLogger = true
+	}
+}
+
+// WithLogger write logs of the server to l instead of the default logger
+func WithLogger(l logger.Logger) ServerOption {
+	return func(self *HTTPServer) {
+		self.logger = l
+	}
+}
+
+// WithCompression gzip responses with the given compress/gzip level,
+// from gzip.BestSpeed (1) to gzip.BestCompression (9)
+func WithCompression(level int) ServerOption {
+	return func(self *HTTPServer) {
+		self.compression = true
+		self.compressionLevel = level
+	}
+}
+
+// WithCompressionMinSize only gzip responses of at least size bytes, 0 compresses every response
+func WithCompressionMinSize(size int) ServerOption {
+	return func(self *HTTPServer) {
+		self.compressionMinSize = size
+	}
+}
+
+// WithoutHeadRequests only register GET for read endpoints
+func WithoutHeadRequests() ServerOption {
+	return func(self *HTTPServer) {
+		self.headRequests = false
+	}
+}
+
+// WithUnchangedAsSuccess answer success:true, empty data and changed:false instead of
+// success:false when data is not fresh, for API version 2 and later
+func WithUnchangedAsSuccess() ServerOption {
+	return func(self *HTTPServer) {
+		self.unchangedAsSuccess = true
+	}
+}
+
+// WithCORS only allow cross-origin requests listed in config, config should be validated
+// first since an invalid one panics
+func WithCORS(config CORSConfig) ServerOption {
+	return func(self *HTTPServer) {
+		self.cors = &config
+	}
+}
+
+// WithRateLimit limit requests per client IP, routes listed in routes (by path)
+// get their own limit, others share the default one
+func WithRateLimit(limit RateLimit, routes map[string]RateLimit) ServerOption {
+	return func(self *HTTPServer) {
+		self.rateLimiter = newRateLimiter(limit, routes)
+	}
+}
+
+// WithTrustedProxies read the client IP of rate limits from X-Forwarded-For when the
+// connection comes from one of proxies, otherwise the remote address is used
+func WithTrustedProxies(proxies []*net.IPNet) ServerOption {
+	return func(self *HTTPServer) {
+		self.trustedProxies = proxies
+	}
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+
+	"github.com/KyberNetwork/cache/ethereum"
+	persister "github.com/KyberNetwork/cache/persister"
+)
+
+const (
+	maxPrecision = 18
+	rateDecimals = 18
+)
+
+// parsePrecision validate ?precision, -1 means full precision
+func parsePrecision(value string) (int, error) {
+	if value == "" {
+		return -1, nil
+	}
+	precision, err := strconv.Atoi(value)
+	if err != nil || precision < 0 || precision > maxPrecision {
+		return 0, errors.New("precision must be an integer from 0 to 18")
+	}
+	return precision, nil
+}
+
+// roundWei round an amount in wei to precision decimals of token unit, amount is kept in wei
+func roundWei(amount string, precision int) string {
+	value, ok := new(big.Int).SetString(amount, 10)
+	if !ok || precision >= rateDecimals {
+		return amount
+	}
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(rateDecimals-precision)), nil)
+	half := new(big.Int).Div(unit, big.NewInt(2))
+	value.Add(value, half)
+	value.Div(value, unit)
+	return value.Mul(value, unit).String()
+}
+
+// roundDecimal round a decimal string to precision decimals
+func roundDecimal(amount string, precision int) string {
+	value, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return amount
+	}
+	return value.FloatString(precision)
+}
+
+func roundRates(rates []ethereum.Rate, precision int) []ethereum.Rate {
+	result := make([]ethereum.Rate, len(rates))
+	for i, rate := range rates {
+		rate.Rate = roundWei(rate.Rate, precision)
+		rate.Minrate = roundWei(rate.Minrate, precision)
+		result[i] = rate
+	}
+	return result
+}
+
+func roundRatesUSD(rates []persister.RateUSD, precision int) []persister.RateUSD {
+	result := make([]persister.RateUSD, len(rates))
+	for i, rate := range rates {
+		rate.PriceUsd = roundDecimal(rate.PriceUsd, precision)
+		result[i] = rate
+	}
+	return result
+}
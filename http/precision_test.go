@@ -0,0 +1,22 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundRates(t *testing.T) {
+	assert.Equal(t, "600000000000000", roundWei("580350000000000", 4))
+	assert.Equal(t, "580000000000000", roundWei("580350000000000", 5))
+	assert.Equal(t, "580350000000000", roundWei("580350000000000", 18))
+	assert.Equal(t, "0", roundWei("251549999999999", 0))
+	assert.Equal(t, "150.11", roundDecimal("150.110255", 2))
+	assert.Equal(t, "150", roundDecimal("150.110255", 0))
+
+	_, err := parsePrecision("19")
+	assert.NotNil(t, err)
+	precision, err := parsePrecision("")
+	assert.Nil(t, err)
+	assert.Equal(t, -1, precision)
+}
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"math/big"
+
+	"github.com/KyberNetwork/cache/ethereum"
+)
+
+// rateDelta difference of a pair from its previous value, in wei
+type rateDelta struct {
+	Source  string `json:"source"`
+	Dest    string `json:"dest"`
+	Rate    string `json:"rate"`
+	Minrate string `json:"minRate"`
+}
+
+type ratePair struct {
+	Source string `json:"source"`
+	Dest   string `json:"dest"`
+}
+
+// rateDeltas changes since the previous snapshot sent to a client. Pairs which are
+// new or have a value which is not an integer are sent in full in Set
+type rateDeltas struct {
+	Delta   []rateDelta     `json:"delta"`
+	Set     []ethereum.Rate `json:"set"`
+	Removed []ratePair      `json:"removed"`
+}
+
+func (d rateDeltas) empty() bool {
+	return len(d.Delta) == 0 && len(d.Set) == 0 && len(d.Removed) == 0
+}
+
+// rateDeltaEncoder remember the last rates sent to a client to encode the next ones as deltas
+type rateDeltaEncoder struct {
+	last map[ratePair]ethereum.Rate
+}
+
+func newRateDeltaEncoder(rates []ethereum.Rate) *rateDeltaEncoder {
+	e := &rateDeltaEncoder{}
+	e.remember(rates)
+	return e
+}
+
+func (e *rateDeltaEncoder) remember(rates []ethereum.Rate) {
+	e.last = make(map[ratePair]ethereum.Rate, len(rates))
+	for _, rate := range rates {
+		e.last[ratePair{Source: rate.Source, Dest: rate.Dest}] = rate
+	}
+}
+
+// subInt return a - b of two integer strings, false if one is not an integer
+func subInt(a, b string) (string, bool) {
+	x, ok := new(big.Int).SetString(a, 10)
+	if !ok {
+		return "", false
+	}
+	y, ok := new(big.Int).SetString(b, 10)
+	if !ok {
+		return "", false
+	}
+	return x.Sub(x, y).String(), true
+}
+
+// encode return changes of rates since the previous call, pairs which did not change are omitted
+func (e *rateDeltaEncoder) encode(rates []ethereum.Rate) rateDeltas {
+	result := rateDeltas{Delta: []rateDelta{}, Set: []ethereum.Rate{}, Removed: []ratePair{}}
+	seen := make(map[ratePair]bool, len(rates))
+	for _, rate := range rates {
+		pair := ratePair{Source: rate.Source, Dest: rate.Dest}
+		seen[pair] = true
+		prev, ok := e.last[pair]
+		if ok && prev.Rate == rate.Rate && prev.Minrate == rate.Minrate {
+			continue
+		}
+		if !ok {
+			result.Set = append(result.Set, rate)
+			continue
+		}
+		rateDiff, rateOK := subInt(rate.Rate, prev.Rate)
+		minRateDiff, minRateOK := subInt(rate.Minrate, prev.Minrate)
+		if !rateOK || !minRateOK {
+			result.Set = append(result.Set, rate)
+			continue
+		}
+		result.Delta = append(result.Delta, rateDelta{Source: rate.Source, Dest: rate.Dest, Rate: rateDiff, Minrate: minRateDiff})
+	}
+	for pair := range e.last {
+		if !seen[pair] {
+			result.Removed = append(result.Removed, pair)
+		}
+	}
+	e.remember(rates)
+	return result
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/KyberNetwork/cache/ethereum"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateDeltaEncoder(t *testing.T) {
+	encoder := newRateDeltaEncoder([]ethereum.Rate{
+		{Source: "KNC", Dest: "ETH", Rate: "580350000000000", Minrate: "562939500000000"},
+		{Source: "ETH", Dest: "KNC", Rate: "1720000000000000000000", Minrate: "1668400000000000000000"},
+		{Source: "REQ", Dest: "ETH", Rate: "251549999999999", Minrate: "244003499999999"},
+	})
+
+	changes := encoder.encode([]ethereum.Rate{
+		{Source: "KNC", Dest: "ETH", Rate: "580351000000000", Minrate: "562939000000000"},
+		{Source: "ETH", Dest: "KNC", Rate: "1720000000000000000000", Minrate: "1668400000000000000000"},
+		{Source: "POWR", Dest: "ETH", Rate: "100", Minrate: "97"},
+	})
+	assert.Equal(t, []rateDelta{{Source: "KNC", Dest: "ETH", Rate: "1000000000", Minrate: "-500000000"}}, changes.Delta)
+	assert.Equal(t, []ethereum.Rate{{Source: "POWR", Dest: "ETH", Rate: "100", Minrate: "97"}}, changes.Set)
+	assert.Equal(t, []ratePair{{Source: "REQ", Dest: "ETH"}}, changes.Removed)
+
+	// deltas are relative to the previous call
+	changes = encoder.encode([]ethereum.Rate{
+		{Source: "KNC", Dest: "ETH", Rate: "580351000000000", Minrate: "562939000000000"},
+		{Source: "ETH", Dest: "KNC", Rate: "1720000000000000000000", Minrate: "1668400000000000000000"},
+		{Source: "POWR", Dest: "ETH", Rate: "0.5", Minrate: "97"},
+	})
+	assert.Empty(t, changes.Delta)
+	assert.Equal(t, []ethereum.Rate{{Source: "POWR", Dest: "ETH", Rate: "0.5", Minrate: "97"}}, changes.Set)
+	assert.Empty(t, changes.Removed)
+
+	assert.True(t, encoder.encode([]ethereum.Rate{
+		{Source: "KNC", Dest: "ETH", Rate: "580351000000000", Minrate: "562939000000000"},
+		{Source: "ETH", Dest: "KNC", Rate: "1720000000000000000000", Minrate: "1668400000000000000000"},
+		{Source: "POWR", Dest: "ETH", Rate: "0.5", Minrate: "97"},
+	}).empty())
+}
@@ -0,0 +1,191 @@
+package http
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultRateLimitIdleTimeout = 10 * time.Minute
+	// defaultRateLimitMaxBuckets a few MB of buckets
+	defaultRateLimitMaxBuckets = 100000
+	// overflowClient clients arriving while every bucket is in use share the bucket of this client
+	overflowClient = "overflow"
+)
+
+// RateLimit requests per second allowed for a client, with bursts up to Burst requests
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter token buckets per client IP. Routes with a specific limit have their own
+// bucket, other routes share the bucket of the default limit. Idle buckets are evicted
+// and there are at most maxBuckets of them to keep memory bounded
+type rateLimiter struct {
+	mu          sync.Mutex
+	limit       RateLimit
+	routes      map[string]RateLimit
+	buckets     map[string]*tokenBucket
+	maxBuckets  int
+	idleTimeout time.Duration
+	lastSweep   time.Time
+}
+
+func newRateLimiter(limit RateLimit, routes map[string]RateLimit) *rateLimiter {
+	return &rateLimiter{
+		limit:       limit,
+		routes:      routes,
+		buckets:     make(map[string]*tokenBucket),
+		maxBuckets:  defaultRateLimitMaxBuckets,
+		idleTimeout: defaultRateLimitIdleTimeout,
+		lastSweep:   time.Now(),
+	}
+}
+
+// bucketKey key of the bucket of ip for route
+func (rl *rateLimiter) bucketKey(route, ip string) (string, RateLimit) {
+	if limit, ok := rl.routes[route]; ok {
+		return route + " " + ip, limit
+	}
+	return ip, rl.limit
+}
+
+// allow take a token of client for route, return how long to wait when there is none
+func (rl *rateLimiter) allow(route, ip string, now time.Time) (bool, time.Duration) {
+	key, limit := rl.bucketKey(route, ip)
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if now.Sub(rl.lastSweep) > rl.idleTimeout {
+		rl.sweep(now)
+	}
+
+	b, ok := rl.buckets[key]
+	if !ok && len(rl.buckets) >= rl.maxBuckets {
+		// sweeping is a scan of every bucket, it is not repeated for each new client
+		if now.Sub(rl.lastSweep) > time.Second {
+			rl.sweep(now)
+		}
+		if len(rl.buckets) >= rl.maxBuckets {
+			key, _ = rl.bucketKey(route, overflowClient)
+			b, ok = rl.buckets[key]
+		}
+	}
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if limit.Rate <= 0 {
+		return false, rl.idleTimeout
+	}
+	return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+}
+
+// sweep remove buckets which were not used for idleTimeout, they are full again anyway
+func (rl *rateLimiter) sweep(now time.Time) {
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) > rl.idleTimeout {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// clientIP address of the client of a request, the remote address of the connection.
+// X-Forwarded-For is only read when the connection comes from one of trustedProxies,
+// the client is then its last address which is not a trusted proxy
+func clientIP(req *http.Request, trustedProxies []*net.IPNet) string {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		ip = req.RemoteAddr
+	}
+	if !isTrustedProxy(ip, trustedProxies) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(req.Header["X-Forwarded-For"], ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		if !isTrustedProxy(hop, trustedProxies) {
+			return hop
+		}
+		ip = hop
+	}
+	return ip
+}
+
+func isTrustedProxy(ip string, trustedProxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parse a comma separated list of IPs and CIDRs
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	proxies := []*net.IPNet{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", item)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// middleware answer 429 with Retry-After when client is over its limit, clients are
+// identified by clientIP
+func (rl *rateLimiter) middleware(trustedProxies []*net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ok, wait := rl.allow(c.Request.URL.Path, clientIP(c.Request, trustedProxies), time.Now())
+		if ok {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.AbortWithStatusJSON(
+			http.StatusTooManyRequests,
+			gin.H{"success": false, "error": "rate limit exceeded"},
+		)
+	}
+}
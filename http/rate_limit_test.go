@@ -0,0 +1,151 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterPerRoute(t *testing.T) {
+	rl := newRateLimiter(RateLimit{Rate: 10, Burst: 2}, map[string]RateLimit{
+		"/expensive": {Rate: 1, Burst: 1},
+	})
+	now := time.Now()
+
+	ok, _ := rl.allow("/expensive", "1.1.1.1", now)
+	assert.True(t, ok)
+	ok, wait := rl.allow("/expensive", "1.1.1.1", now)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+
+	// other routes and other clients have their own buckets
+	ok, _ = rl.allow("/gasPrice", "1.1.1.1", now)
+	assert.True(t, ok)
+	ok, _ = rl.allow("/rate", "1.1.1.1", now)
+	assert.True(t, ok)
+	ok, _ = rl.allow("/gasPrice", "1.1.1.1", now)
+	assert.False(t, ok)
+	ok, _ = rl.allow("/expensive", "2.2.2.2", now)
+	assert.True(t, ok)
+
+	ok, _ = rl.allow("/expensive", "1.1.1.1", now.Add(time.Second))
+	assert.True(t, ok)
+
+	rl.allow("/gasPrice", "3.3.3.3", now.Add(time.Hour))
+	assert.Equal(t, 1, len(rl.buckets))
+}
+
+func TestRateLimitMiddlewareRoutes(t *testing.T) {
+	rl := newRateLimiter(RateLimit{Rate: 0.001, Burst: 1}, map[string]RateLimit{
+		"/marketInfo": {Rate: 0.001, Burst: 2},
+		"/gasPrice":   {Rate: 0.001, Burst: 3},
+	})
+	r := gin.New()
+	r.Use(rl.middleware(nil))
+	for _, route := range []string{"/marketInfo", "/gasPrice", "/rate", "/rateUSD"} {
+		r.GET(route, func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	}
+	get := func(route, remoteAddr string) int {
+		req := httptest.NewRequest("GET", route, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// each route with a limit has its own budget, spending one does not touch the other
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, get("/marketInfo", "1.1.1.1:1000"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, get("/marketInfo", "1.1.1.1:1000"))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, get("/gasPrice", "1.1.1.1:1001"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, get("/gasPrice", "1.1.1.1:1001"))
+
+	// routes without a limit share the default budget
+	assert.Equal(t, http.StatusOK, get("/rate", "1.1.1.1:1002"))
+	assert.Equal(t, http.StatusTooManyRequests, get("/rateUSD", "1.1.1.1:1003"))
+
+	// clients are told apart by the address of the connection, not its port
+	assert.Equal(t, http.StatusOK, get("/marketInfo", "2.2.2.2:1000"))
+}
+
+func TestRateLimitClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	assert.Nil(t, err)
+	_, err = ParseTrustedProxies("10.0.0.0/33")
+	assert.NotNil(t, err)
+
+	newRequest := func(remoteAddr string, forwarded ...string) *http.Request {
+		req := httptest.NewRequest("GET", "/rate", nil)
+		req.RemoteAddr = remoteAddr
+		for _, value := range forwarded {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		return req
+	}
+	// X-Forwarded-For of untrusted clients is ignored
+	assert.Equal(t, "1.1.1.1", clientIP(newRequest("1.1.1.1:1000", "9.9.9.9"), nil))
+	assert.Equal(t, "1.1.1.1", clientIP(newRequest("1.1.1.1:1000", "9.9.9.9"), proxies))
+	// behind trusted proxies the client is the last hop which is not one of them
+	assert.Equal(t, "2.2.2.2", clientIP(newRequest("10.1.2.3:1000", "9.9.9.9, 2.2.2.2, 10.0.0.5"), proxies))
+	assert.Equal(t, "2.2.2.2", clientIP(newRequest("192.168.1.1:1000", "9.9.9.9", "2.2.2.2"), proxies))
+	assert.Equal(t, "10.1.2.3", clientIP(newRequest("10.1.2.3:1000"), proxies))
+	assert.Equal(t, "10.0.0.5", clientIP(newRequest("10.1.2.3:1000", "garbage, 10.0.0.5"), proxies))
+}
+
+func TestRateLimitSpoofedForwardedFor(t *testing.T) {
+	rl := newRateLimiter(RateLimit{Rate: 0.001, Burst: 1}, nil)
+	r := gin.New()
+	r.Use(rl.middleware(nil))
+	r.GET("/marketInfo", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	codes := []int{}
+	for _, forwarded := range []string{"1.0.0.1", "1.0.0.2", "1.0.0.3"} {
+		req := httptest.NewRequest("GET", "/marketInfo", nil)
+		req.RemoteAddr = "3.3.3.3:1000"
+		req.Header.Set("X-Forwarded-For", forwarded)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}, codes)
+	assert.Equal(t, 1, len(rl.buckets))
+}
+
+func TestRateLimiterMaxBuckets(t *testing.T) {
+	rl := newRateLimiter(RateLimit{Rate: 0.001, Burst: 2}, nil)
+	rl.maxBuckets = 2
+	now := time.Now()
+
+	ok, _ := rl.allow("/rate", "1.1.1.1", now)
+	assert.True(t, ok)
+	ok, _ = rl.allow("/rate", "2.2.2.2", now)
+	assert.True(t, ok)
+	// new clients share the overflow bucket while the table is full
+	ok, _ = rl.allow("/rate", "3.3.3.3", now)
+	assert.True(t, ok)
+	ok, _ = rl.allow("/rate", "4.4.4.4", now)
+	assert.True(t, ok)
+	ok, _ = rl.allow("/rate", "5.5.5.5", now)
+	assert.False(t, ok)
+	assert.Equal(t, 3, len(rl.buckets))
+
+	// known clients keep their own bucket
+	ok, _ = rl.allow("/rate", "1.1.1.1", now)
+	assert.True(t, ok)
+
+	// idle buckets are swept to make room
+	ok, _ = rl.allow("/rate", "6.6.6.6", now.Add(rl.idleTimeout/2))
+	assert.False(t, ok)
+	ok, _ = rl.allow("/rate", "6.6.6.6", now.Add(rl.idleTimeout+time.Second))
+	assert.True(t, ok)
+	_, ok = rl.buckets["6.6.6.6"]
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(rl.buckets))
+}
@@ -0,0 +1,142 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/KyberNetwork/cache/ethereum"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	pairBase = "ETH"
+
+	// derivations of a pair rate
+	derivationDirect  = "direct"  // rate of the pair
+	derivationInverse = "inverse" // 1 / rate of the reverse pair
+	derivationCross   = "cross"   // src to ETH then ETH to dst
+)
+
+// RatePair rate of src to dst, Path is the tokens it went through
+type RatePair struct {
+	Source     string   `json:"source"`
+	Dest       string   `json:"dest"`
+	Rate       string   `json:"rate"`
+	Derivation string   `json:"derivation"`
+	Path       []string `json:"path"`
+}
+
+// pairRates rates by source and dest
+type pairRates map[string]map[string]*big.Int
+
+func newPairRates(rates []ethereum.Rate) pairRates {
+	pairs := make(pairRates)
+	for _, rate := range rates {
+		value, ok := new(big.Int).SetString(rate.Rate, 10)
+		if !ok || value.Sign() <= 0 {
+			continue
+		}
+		if pairs[rate.Source] == nil {
+			pairs[rate.Source] = make(map[string]*big.Int)
+		}
+		pairs[rate.Source][rate.Dest] = value
+	}
+	return pairs
+}
+
+func (pairs pairRates) known(token string) bool {
+	if _, ok := pairs[token]; ok {
+		return true
+	}
+	for _, dests := range pairs {
+		if _, ok := dests[token]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rate of src to dst from the pair or the reverse one, with rateDecimals decimals
+func (pairs pairRates) rate(src, dst string) (*big.Int, string, bool) {
+	if value, ok := pairs[src][dst]; ok {
+		return value, derivationDirect, true
+	}
+	if value, ok := pairs[dst][src]; ok {
+		return new(big.Int).Div(new(big.Int).Mul(rateUnit(), rateUnit()), value), derivationInverse, true
+	}
+	return nil, "", false
+}
+
+func rateUnit() *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(rateDecimals), nil)
+}
+
+// findRatePair rate of src to dst, derived through ETH when there is no pair between them
+func findRatePair(rates []ethereum.Rate, src, dst string) (*RatePair, error) {
+	pairs := newPairRates(rates)
+	unknown := []string{}
+	for _, token := range []string{src, dst} {
+		if !pairs.known(token) {
+			unknown = append(unknown, token)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown tokens: %s", strings.Join(unknown, ", "))
+	}
+
+	if value, derivation, ok := pairs.rate(src, dst); ok {
+		return &RatePair{Source: src, Dest: dst, Rate: value.String(), Derivation: derivation, Path: []string{src, dst}}, nil
+	}
+	toBase, _, ok := pairs.rate(src, pairBase)
+	if !ok {
+		return nil, fmt.Errorf("no rate between %s and %s", src, dst)
+	}
+	fromBase, _, ok := pairs.rate(pairBase, dst)
+	if !ok {
+		return nil, fmt.Errorf("no rate between %s and %s", src, dst)
+	}
+	value := new(big.Int).Div(new(big.Int).Mul(toBase, fromBase), rateUnit())
+	return &RatePair{Source: src, Dest: dst, Rate: value.String(), Derivation: derivationCross, Path: []string{src, pairBase, dst}}, nil
+}
+
+// GetRatePair rate of ?src to ?dst, direct or derived through ETH
+func (self *HTTPServer) GetRatePair(c *gin.Context) {
+	timestamp := self.persister.GetRateTimestamp()
+	if timestamp == 0 {
+		self.writeNeverPopulated(c)
+		return
+	}
+	src, dst := strings.TrimSpace(c.Query("src")), strings.TrimSpace(c.Query("dst"))
+	var err error
+	switch {
+	case src == "" || dst == "":
+		err = errors.New("src and dst are required")
+	case src == dst:
+		err = errors.New("src and dst must be different tokens")
+	}
+	if err != nil {
+		self.writeJSON(
+			c,
+			http.StatusBadRequest,
+			gin.H{"success": false, "error": err.Error()},
+		)
+		return
+	}
+	pair, err := findRatePair(self.persister.GetRate(), src, dst)
+	if err != nil {
+		self.writeJSON(
+			c,
+			http.StatusNotFound,
+			gin.H{"success": false, "error": err.Error()},
+		)
+		return
+	}
+	self.writeJSON(
+		c,
+		http.StatusOK,
+		gin.H{"success": true, "timestamp": timestamp, "data": pair},
+	)
+}
@@ -0,0 +1,37 @@
+package http
+
+import (
+	"github.com/KyberNetwork/cache/node"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxRequestIDLength longer ids sent by clients are replaced, they end up in every log line
+const maxRequestIDLength = 128
+
+// requestID reuse X-Request-ID of the client or generate one, attach it to the request
+// context so node cache logs carry it, and echo it back in the response
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(node.RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+		c.Header(node.RequestIDHeader, id)
+		c.Request = c.Request.WithContext(node.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// validRequestID accept printable ASCII ids up to maxRequestIDLength
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
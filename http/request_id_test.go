@@ -0,0 +1,37 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KyberNetwork/cache/node"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	r := gin.New()
+	r.Use(requestID())
+	r.GET("/id", func(c *gin.Context) {
+		c.String(http.StatusOK, node.RequestID(c.Request.Context()))
+	})
+
+	req := httptest.NewRequest("GET", "/id", nil)
+	req.Header.Set("X-Request-ID", "client-id-1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "client-id-1", w.Header().Get("X-Request-ID"))
+	assert.Equal(t, "client-id-1", w.Body.String())
+
+	for _, id := range []string{"", strings.Repeat("a", maxRequestIDLength+1), "bad id\n"} {
+		req = httptest.NewRequest("GET", "/id", nil)
+		req.Header.Set("X-Request-ID", id)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		generated := w.Header().Get("X-Request-ID")
+		assert.Len(t, generated, 36)
+		assert.Equal(t, generated, w.Body.String())
+	}
+}
@@ -0,0 +1,245 @@
+package http
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// CasingCamel rename response fields to camelCase
+	CasingCamel = "camel"
+	// CasingSnake rename response fields to snake_case
+	CasingSnake = "snake"
+
+	apiVersionHeader = "X-Api-Version"
+	legacyAPIVersion = "1"
+)
+
+// apiVersion return the API version requested by client, default is the legacy one
+func apiVersion(c *gin.Context) string {
+	version := c.GetHeader(apiVersionHeader)
+	if version == "" {
+		version = c.Query("apiVersion")
+	}
+	if version == "" {
+		return legacyAPIVersion
+	}
+	return strings.TrimPrefix(strings.ToLower(version), "v")
+}
+
+// writeJSON write response, field names are kept as they are for the legacy API version
+// and follow the configured casing policy otherwise
+func (self *HTTPServer) writeJSON(c *gin.Context, code int, obj interface{}) {
+	if apiVersion(c) == legacyAPIVersion {
+		c.JSON(code, obj)
+		return
+	}
+	c.JSON(code, withCasing(reflect.ValueOf(obj), self.casing))
+}
+
+// writeNotChanged answer an endpoint whose data is not fresh. The legacy API version and
+// servers without WithUnchangedAsSuccess get the legacy body with 503, otherwise it is a
+// success with empty data and changed:false
+func (self *HTTPServer) writeNotChanged(c *gin.Context, legacy gin.H, empty interface{}) {
+	if !self.unchangedAsSuccess || apiVersion(c) == legacyAPIVersion {
+		self.writeJSON(
+			c,
+			http.StatusServiceUnavailable,
+			legacy,
+		)
+		return
+	}
+	self.writeJSON(
+		c,
+		http.StatusOK,
+		gin.H{"success": true, "data": empty, "changed": false},
+	)
+}
+
+// writeNeverPopulated answer a dataset which was never saved, for every API version
+func (self *HTTPServer) writeNeverPopulated(c *gin.Context) {
+	self.writeJSON(
+		c,
+		http.StatusServiceUnavailable,
+		gin.H{"success": false, "data": nil, "timestamp": 0},
+	)
+}
+
+var (
+	ginHType          = reflect.TypeOf(gin.H{})
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// withCasing copy of v to be encoded as JSON with field names in casing. Only names of struct
+// fields and keys of gin.H, the envelope of responses, are renamed; keys of other maps are
+// data, e.g. method names or token symbols, and are kept as they are
+func withCasing(v reflect.Value, casing string) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Type().Implements(marshalerType) || v.Type().Implements(textMarshalerType) {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return withCasing(v.Elem(), casing)
+	case reflect.Struct:
+		object := gin.H{}
+		casedFields(v, casing, object)
+		return object
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+		rename := v.Type() == ginHType
+		object := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			name := key.String()
+			if rename {
+				name = convertCase(name, casing)
+			}
+			object[name] = withCasing(v.MapIndex(key), casing)
+		}
+		return object
+	case reflect.Slice:
+		if v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		fallthrough
+	case reflect.Array:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = withCasing(v.Index(i), casing)
+		}
+		return items
+	default:
+		return v.Interface()
+	}
+}
+
+// casedFields add exported fields of struct v to object, named as encoding/json does.
+// Fields of embedded structs are promoted unless the outer struct has one of the same name
+func casedFields(v reflect.Value, casing string, object gin.H) {
+	promoted := gin.H{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		// exported fields of unexported embedded structs are still encoded
+		if tag == "-" || (field.PkgPath != "" && !(field.Anonymous && field.Type.Kind() == reflect.Struct)) {
+			continue
+		}
+		value := v.Field(i)
+		name, options := tag, ""
+		if sep := strings.Index(tag, ","); sep >= 0 {
+			name, options = tag[:sep], tag[sep+1:]
+		}
+		if field.Anonymous && name == "" {
+			if value.Kind() == reflect.Ptr {
+				if value.IsNil() {
+					continue
+				}
+				value = value.Elem()
+			}
+			if value.Kind() == reflect.Struct {
+				casedFields(value, casing, promoted)
+				continue
+			}
+		}
+		if strings.Contains(options, "omitempty") && isEmptyValue(value) {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		object[convertCase(name, casing)] = withCasing(value, casing)
+	}
+	for name, value := range promoted {
+		if _, ok := object[name]; !ok {
+			object[name] = value
+		}
+	}
+}
+
+// isEmptyValue values left out by omitempty
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+func convertCase(key string, casing string) string {
+	switch casing {
+	case CasingSnake:
+		return toSnakeCase(key)
+	case CasingCamel:
+		return toCamelCase(key)
+	default:
+		return key
+	}
+}
+
+// toSnakeCase convert camelCase key to snake_case, acronyms are one word (ratesUSD becomes rates_usd).
+// Keys without lower case letter (e.g. token symbols) are kept
+func toSnakeCase(key string) string {
+	if strings.ToUpper(key) == key {
+		return key
+	}
+	runes := []rune(key)
+	var b strings.Builder
+	for i, r := range runes {
+		if !unicode.IsUpper(r) {
+			b.WriteRune(r)
+			continue
+		}
+		if i > 0 && runes[i-1] != '_' {
+			prev := runes[i-1]
+			// a word starts after a lower case letter, or at the last upper case letter of an acronym
+			endOfAcronym := unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if !unicode.IsUpper(prev) || endOfAcronym {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// toCamelCase convert snake_case key to camelCase
+func toCamelCase(key string) string {
+	if !strings.Contains(key, "_") {
+		return key
+	}
+	parts := strings.Split(key, "_")
+	var b strings.Builder
+	b.WriteString(parts[0])
+	for _, part := range parts[1:] {
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
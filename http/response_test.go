@@ -0,0 +1,104 @@
+package http
+
+import (
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KyberNetwork/cache/ethereum"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteJSONCasing(t *testing.T) {
+	type embedded struct {
+		UpdatedAt int64  `json:"updated_at"`
+		Source    string `json:"source"`
+	}
+	type payload struct {
+		embedded
+		*ethereum.GasPrice
+		Source   string            `json:"source"`
+		Amount   *big.Int          `json:"amount"`
+		Failed   map[string]string `json:"failed_methods"`
+		Skipped  string            `json:"skipped,omitempty"`
+		Hidden   string            `json:"-"`
+		internal string
+	}
+	obj := gin.H{
+		"success":  true,
+		"rate_usd": []ethereum.RateUSD{{Symbol: "cDAI", PriceUsd: "0.02"}},
+		"data": payload{
+			embedded: embedded{UpdatedAt: 1, Source: "promoted"},
+			GasPrice: &ethereum.GasPrice{Fast: "12.5"},
+			Source:   "KNC",
+			Amount:   big.NewInt(1000000000000000000),
+			// keys of data maps are not field names
+			Failed: map[string]string{"eth_getLogs": "timeout", "cDAI": "unknown"},
+			Hidden: "hidden",
+		},
+	}
+
+	tests := []struct {
+		casing   string
+		version  string
+		expected string
+	}{
+		{
+			casing:   CasingCamel,
+			version:  "1",
+			expected: `{"success":true,"rate_usd":[{"symbol":"cDAI","price_usd":"0.02"}],"data":{"updated_at":1,"fast":"12.5","standard":"","low":"","default":"","source":"KNC","amount":1000000000000000000,"failed_methods":{"eth_getLogs":"timeout","cDAI":"unknown"}}}`,
+		},
+		{
+			casing:   CasingCamel,
+			version:  "2",
+			expected: `{"success":true,"rateUsd":[{"symbol":"cDAI","priceUsd":"0.02"}],"data":{"updatedAt":1,"fast":"12.5","standard":"","low":"","default":"","source":"KNC","amount":1000000000000000000,"failedMethods":{"eth_getLogs":"timeout","cDAI":"unknown"}}}`,
+		},
+		{
+			casing:   CasingSnake,
+			version:  "2",
+			expected: `{"success":true,"rate_usd":[{"symbol":"cDAI","price_usd":"0.02"}],"data":{"updated_at":1,"fast":"12.5","standard":"","low":"","default":"","source":"KNC","amount":1000000000000000000,"failed_methods":{"eth_getLogs":"timeout","cDAI":"unknown"}}}`,
+		},
+	}
+	for _, test := range tests {
+		server := &HTTPServer{r: gin.New(), casing: test.casing}
+		server.r.GET("/test", func(c *gin.Context) {
+			server.writeJSON(c, http.StatusOK, obj)
+		})
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set(apiVersionHeader, test.version)
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		assert.JSONEq(t, test.expected, w.Body.String(), "%s v%s", test.casing, test.version)
+	}
+}
+
+func TestWriteJSONCasingNil(t *testing.T) {
+	server := &HTTPServer{r: gin.New(), casing: CasingSnake}
+	server.r.GET("/test", func(c *gin.Context) {
+		var rates []ethereum.Rate
+		server.writeJSON(c, http.StatusOK, gin.H{"data": rates, "minRate": nil, "eip1559": (*ethereum.EIP1559GasPrice)(nil)})
+	})
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/test?apiVersion=2", nil))
+	assert.JSONEq(t, `{"data":null,"min_rate":null,"eip1559":null}`, w.Body.String())
+}
+
+func TestConvertCase(t *testing.T) {
+	tests := []struct {
+		key, snake, camel string
+	}{
+		{key: "minRate", snake: "min_rate", camel: "minRate"},
+		{key: "price_usd", snake: "price_usd", camel: "priceUsd"},
+		{key: "KNC", snake: "KNC", camel: "KNC"},
+		{key: "ratesUSD", snake: "rates_usd", camel: "ratesUSD"},
+		{key: "USDBaseUpdateAt", snake: "usd_base_update_at", camel: "USDBaseUpdateAt"},
+		{key: "rate_source", snake: "rate_source", camel: "rateSource"},
+		{key: "source", snake: "source", camel: "source"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.snake, convertCase(test.key, CasingSnake), test.key)
+		assert.Equal(t, test.camel, convertCase(test.key, CasingCamel), test.key)
+	}
+}
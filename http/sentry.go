@@ -0,0 +1,43 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	raven "github.com/getsentry/raven-go"
+)
+
+const defaultSentryTimeoutSeconds = 3
+
+// newSentryClient build sentry client from SENTRY_DSN, return nil when sentry is not configured.
+// Events are queued and sent by a background worker, they are dropped when the queue is full
+// so a sentry outage never blocks request handling
+func newSentryClient() *raven.Client {
+	dsn := os.Getenv("SENTRY_DSN")
+	if dsn == "" {
+		return nil
+	}
+	client, err := raven.New(dsn)
+	if err != nil {
+		log.Printf("invalid SENTRY_DSN, sentry is disabled: %v", err)
+		return nil
+	}
+
+	timeoutSeconds := defaultSentryTimeoutSeconds
+	if seconds, err := strconv.Atoi(os.Getenv("SENTRY_TIMEOUT")); err == nil && seconds > 0 {
+		timeoutSeconds = seconds
+	}
+	timeout := time.Duration(timeoutSeconds) * time.Second
+	if transport, ok := client.Transport.(*raven.HTTPTransport); ok && transport.Client != nil {
+		transport.Client.Timeout = timeout
+	} else {
+		client.Transport = &raven.HTTPTransport{Client: &http.Client{Timeout: timeout}}
+	}
+	client.DropHandler = func(packet *raven.Packet) {
+		log.Printf("sentry queue is full, event %s is dropped", packet.EventID)
+	}
+	return client
+}
@@ -1,17 +1,23 @@
 package http
 
 import (
-	"io/ioutil"
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/KyberNetwork/cache/ethereum"
 	"github.com/KyberNetwork/cache/fetcher"
+	"github.com/KyberNetwork/cache/logger"
+	"github.com/KyberNetwork/cache/metrics"
 	"github.com/KyberNetwork/cache/node"
 	persister "github.com/KyberNetwork/cache/persister"
 	"github.com/KyberNetwork/cache/refprice"
-	raven "github.com/getsentry/raven-go"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/sentry"
 	"github.com/gin-gonic/gin"
@@ -20,77 +26,318 @@ import (
 const (
 	MAX_PAGE_SIZE = 50
 	DEFAULT_PAGE  = 1
+
+	defaultHealthNodeMaxAge = 60 * time.Second
+
+	healthPersister = "persister"
+	healthNode      = "node"
 )
 
+type gasPriceResponse struct {
+	*ethereum.GasPrice
+	EIP1559 *ethereum.EIP1559GasPrice `json:"eip1559,omitempty"`
+}
+
 type HTTPServer struct {
-	node      *node.NodeMiddleware
-	fetcher   *fetcher.Fetcher
-	persister persister.Persister
-	host      string
-	r         *gin.Engine
-	refPrice  *refprice.RefPrice
+	sseConnections    int64 // accessed atomically, keep it 64-bit aligned
+	sseMaxConnections int64
+	shuttingDown      int32 // accessed atomically, 1 once shutdown started
+	// ssePollInterval how often streams check for new rates
+	ssePollInterval      time.Duration
+	sseKeepAliveInterval time.Duration
+	// streamsDone closed when srv shuts down, see closeStreamsOnShutdown
+	streamsDone chan struct{}
+
+	node       *node.NodeMiddleware
+	fetcher    *fetcher.Fetcher
+	persister  persister.Persister
+	host       string
+	r          *gin.Engine
+	srv        *http.Server
+	refPrice   *refprice.RefPrice
+	adminToken string
+	errorLog   *errorLogCache
+	casing     string
+
+	accessLog     io.Writer // nil when access log is disabled
+	errorLogRoute string    // path of the error log, only served with the admin token
+	disableLogger bool
+
+	compression        bool
+	compressionLevel   int
+	compressionMinSize int
+	headRequests       bool
+	// unchangedAsSuccess answer success:true with changed:false when data is not fresh
+	unchangedAsSuccess bool
+	rateLimiter        *rateLimiter // nil when requests are not limited
+	trustedProxies     []*net.IPNet // X-Forwarded-For is only read from these proxies
+	cors               *CORSConfig  // nil when every origin is allowed
+	// healthNodeMaxAge node cache is unhealthy when its last refresh is older
+	healthNodeMaxAge time.Duration
+
+	metrics        metrics.MetricsSink
+	metricsHandler http.Handler // nil when ENABLE_METRICS is not set
+	logger         logger.Logger
 }
 
 func (self *HTTPServer) GetRate(c *gin.Context) {
+	timestamp := self.persister.GetRateTimestamp()
+	if timestamp == 0 {
+		self.writeNeverPopulated(c)
+		return
+	}
 	isNewRate := self.persister.GetIsNewRate()
 	if isNewRate != true {
-		c.JSON(
-			http.StatusOK,
-			gin.H{"success": false, "data": nil},
-		)
+		self.writeNotChanged(c, gin.H{"success": false, "data": nil, "timestamp": timestamp}, []ethereum.Rate{})
 		return
 	}
 
+	precision, err := parsePrecision(c.Query("precision"))
+	if err != nil {
+		self.writeJSON(
+			c,
+			http.StatusBadRequest,
+			gin.H{"success": false, "error": err.Error()},
+		)
+		return
+	}
 	rates := self.persister.GetRate()
+	var unknown []string
+	if tokens := c.Query("tokens"); tokens != "" {
+		rates, unknown = self.persister.GetRateByTokens(parseTokens(tokens))
+	}
 	updateAt := self.persister.GetTimeUpdateRate()
-	c.JSON(
+	if minLiquidity := c.Query("minLiquidity"); minLiquidity != "" {
+		min, err := strconv.ParseFloat(minLiquidity, 64)
+		if err != nil || min < 0 {
+			self.writeJSON(
+				c,
+				http.StatusBadRequest,
+				gin.H{"success": false, "error": "minLiquidity must be a non-negative number"},
+			)
+			return
+		}
+		rates = filterRatesByLiquidity(rates, min)
+	}
+	if precision >= 0 {
+		rates = roundRates(rates, precision)
+	}
+	var data interface{} = rates
+	if c.Query("includeSource") == "true" {
+		data = withRateSource(rates)
+	}
+	if fields := parseFields(c.Query("fields")); fields != nil {
+		data = self.maskFields(data, fields)
+	}
+	response := gin.H{"success": true, "updateAt": updateAt, "timestamp": timestamp, "data": data}
+	if unknown != nil {
+		response["unknown"] = unknown
+	}
+	self.writeJSON(
+		c,
 		http.StatusOK,
-		gin.H{"success": true, "updateAt": updateAt, "data": rates},
+		response,
 	)
 }
 
+// parseTokens upper case symbols of a comma separated list, duplicates are removed
+func parseTokens(value string) []string {
+	symbols := []string{}
+	seen := make(map[string]bool)
+	for _, symbol := range strings.Split(value, ",") {
+		symbol = strings.ToUpper(strings.TrimSpace(symbol))
+		if symbol == "" || seen[symbol] {
+			continue
+		}
+		seen[symbol] = true
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+// rateWithSource rate with its provider, the source field is already the source token
+type rateWithSource struct {
+	ethereum.Rate
+	RateSource string `json:"rateSource"`
+}
+
+func withRateSource(rates []ethereum.Rate) []rateWithSource {
+	result := make([]rateWithSource, len(rates))
+	for i, rate := range rates {
+		result[i] = rateWithSource{Rate: rate, RateSource: rate.Provider}
+	}
+	return result
+}
+
+// filterRatesByLiquidity keep pairs with liquidity at least min
+func filterRatesByLiquidity(rates []ethereum.Rate, min float64) []ethereum.Rate {
+	result := []ethereum.Rate{}
+	for _, rate := range rates {
+		if rate.Liquidity >= min {
+			result = append(result, rate)
+		}
+	}
+	return result
+}
+
 func (self *HTTPServer) GetLatestBlock(c *gin.Context) {
 	if !self.persister.GetIsNewLatestBlock() {
-		c.JSON(
-			http.StatusOK,
-			gin.H{"success": false},
-		)
+		self.writeNotChanged(c, gin.H{"success": false}, nil)
 		return
 	}
+	if maxAge := c.Query("maxAge"); maxAge != "" {
+		seconds, err := strconv.ParseInt(maxAge, 10, 64)
+		if err != nil || seconds <= 0 {
+			self.writeJSON(
+				c,
+				http.StatusBadRequest,
+				gin.H{"success": false, "error": "maxAge must be a positive number of seconds"},
+			)
+			return
+		}
+		if time.Now().Unix()-self.persister.GetTimeUpdateLatestBlock() > seconds {
+			self.writeJSON(
+				c,
+				http.StatusServiceUnavailable,
+				gin.H{"success": false, "stale": true},
+			)
+			return
+		}
+	}
 	blockNum := self.persister.GetLatestBlock()
-	c.JSON(
+	if confirmations := c.Query("confirmations"); confirmations != "" {
+		safeBlock, err := confirmedBlock(blockNum, confirmations)
+		if err != nil {
+			self.writeJSON(
+				c,
+				http.StatusBadRequest,
+				gin.H{"success": false, "error": err.Error()},
+			)
+			return
+		}
+		blockNum = safeBlock
+	}
+	self.writeJSON(
+		c,
 		http.StatusOK,
 		gin.H{"success": true, "data": blockNum},
 	)
 }
 
+// confirmedBlock return the block which has the given number of confirmations on top of tip
+func confirmedBlock(tip string, confirmations string) (string, error) {
+	n, err := strconv.ParseUint(confirmations, 10, 64)
+	if err != nil {
+		return "", errors.New("confirmations must be a non-negative integer")
+	}
+	tipNumber, err := strconv.ParseUint(tip, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid latest block %q", tip)
+	}
+	if n > tipNumber {
+		return "", errors.New("confirmations is larger than latest block")
+	}
+	return strconv.FormatUint(tipNumber-n, 10), nil
+}
+
 func (self *HTTPServer) GetRateUSD(c *gin.Context) {
+	timestamp := self.persister.GetRateUSDTimestamp()
+	if timestamp == 0 {
+		self.writeNeverPopulated(c)
+		return
+	}
 	if !self.persister.GetIsNewRateUSD() {
-		c.JSON(
-			http.StatusOK,
-			gin.H{"success": false},
-		)
+		self.writeNotChanged(c, gin.H{"success": false, "timestamp": timestamp}, []persister.RateUSD{})
 		return
 	}
 
+	precision, err := parsePrecision(c.Query("precision"))
+	if err != nil {
+		self.writeJSON(
+			c,
+			http.StatusBadRequest,
+			gin.H{"success": false, "error": err.Error()},
+		)
+		return
+	}
 	rates := self.persister.GetRateUSD()
-	c.JSON(
+	if precision >= 0 {
+		rates = roundRatesUSD(rates, precision)
+	}
+	self.writeJSON(
+		c,
+		http.StatusOK,
+		gin.H{"success": true, "timestamp": timestamp, "data": rates},
+	)
+}
+
+// GetRatesCombined return rates and rates USD of the same read, consistent is false
+// when rates USD were not calculated from the returned rates
+func (self *HTTPServer) GetRatesCombined(c *gin.Context) {
+	combined := self.persister.GetRatesCombined()
+	if !combined.IsNewRate && !combined.IsNewRateUSD {
+		self.writeNotChanged(c, gin.H{"success": false}, gin.H{"rates": []ethereum.Rate{}, "ratesUSD": []persister.RateUSD{}})
+		return
+	}
+
+	self.writeJSON(
+		c,
 		http.StatusOK,
-		gin.H{"success": true, "data": rates},
+		gin.H{
+			"success":    true,
+			"updateAt":   combined.UpdateAt,
+			"consistent": combined.UpdateAt == combined.USDBaseUpdateAt,
+			"fresh":      gin.H{"rates": combined.IsNewRate, "ratesUSD": combined.IsNewRateUSD},
+			"data":       gin.H{"rates": combined.Rates, "ratesUSD": combined.RatesUSD},
+		},
+	)
+}
+
+// GetRateHistory rates of token to dest (ETH by default) saved between from and to, unix millis
+func (self *HTTPServer) GetRateHistory(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		self.writeJSON(
+			c,
+			http.StatusBadRequest,
+			gin.H{"success": false, "error": "token is required"},
+		)
+		return
+	}
+	dest := c.DefaultQuery("dest", "ETH")
+	var timeRange [2]int64
+	for i, name := range []string{"from", "to"} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		millis, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || millis < 0 {
+			self.writeJSON(
+				c,
+				http.StatusBadRequest,
+				gin.H{"success": false, "error": name + " must be a unix timestamp in milliseconds"},
+			)
+			return
+		}
+		timeRange[i] = millis
+	}
+	self.writeJSON(
+		c,
+		http.StatusOK,
+		gin.H{"success": true, "data": self.persister.GetRateHistory(token, dest, timeRange[0], timeRange[1])},
 	)
 }
 
 func (self *HTTPServer) GetRateETH(c *gin.Context) {
 	if !self.persister.GetIsNewRateUSD() {
-		c.JSON(
-			http.StatusOK,
-			gin.H{"success": false},
-		)
+		self.writeNotChanged(c, gin.H{"success": false}, nil)
 		return
 	}
 
 	ethRate := self.persister.GetRateETH()
-	c.JSON(
+	self.writeJSON(
+		c,
 		http.StatusOK,
 		gin.H{"success": true, "data": ethRate},
 	)
@@ -98,15 +345,13 @@ func (self *HTTPServer) GetRateETH(c *gin.Context) {
 
 func (self *HTTPServer) GetKyberEnabled(c *gin.Context) {
 	if !self.persister.GetNewKyberEnabled() {
-		c.JSON(
-			http.StatusOK,
-			gin.H{"success": false},
-		)
+		self.writeNotChanged(c, gin.H{"success": false}, nil)
 		return
 	}
 
 	enabled := self.persister.GetKyberEnabled()
-	c.JSON(
+	self.writeJSON(
+		c,
 		http.StatusOK,
 		gin.H{"success": true, "data": enabled},
 	)
@@ -114,15 +359,13 @@ func (self *HTTPServer) GetKyberEnabled(c *gin.Context) {
 
 func (self *HTTPServer) GetMaxGasPrice(c *gin.Context) {
 	if !self.persister.GetNewMaxGasPrice() {
-		c.JSON(
-			http.StatusOK,
-			gin.H{"success": false},
-		)
+		self.writeNotChanged(c, gin.H{"success": false}, nil)
 		return
 	}
 
 	gasPrice := self.persister.GetMaxGasPrice()
-	c.JSON(
+	self.writeJSON(
+		c,
 		http.StatusOK,
 		gin.H{"success": true, "data": gasPrice},
 	)
@@ -130,38 +373,138 @@ func (self *HTTPServer) GetMaxGasPrice(c *gin.Context) {
 
 func (self *HTTPServer) GetGasPrice(c *gin.Context) {
 	if !self.persister.GetNewGasPrice() {
-		c.JSON(
-			http.StatusOK,
-			gin.H{"success": false},
+		self.writeNotChanged(c, gin.H{"success": false}, nil)
+		return
+	}
+
+	unit, err := parseGasUnit(c.Query("unit"))
+	if err != nil {
+		self.writeJSON(
+			c,
+			http.StatusBadRequest,
+			gin.H{"success": false, "error": err.Error()},
 		)
 		return
 	}
 
 	gasPrice := self.persister.GetGasPrice()
-	c.JSON(
+	data := gasPriceResponse{GasPrice: convertGasPrice(gasPrice, unit)}
+	// fall back to legacy gas price only when fee history is not available
+	if self.persister.GetNewEIP1559GasPrice() {
+		data.EIP1559 = convertEIP1559GasPrice(self.persister.GetEIP1559GasPrice(), unit)
+	}
+	self.writeJSON(
+		c,
 		http.StatusOK,
-		gin.H{"success": true, "data": gasPrice},
+		gin.H{"success": true, "data": data, "unit": unit},
 	)
 }
 
+// GetErrorLog last ?lines lines of error.log (default 1000), ?lines=all streams the whole file as text
 func (self *HTTPServer) GetErrorLog(c *gin.Context) {
-	dat, err := ioutil.ReadFile("error.log")
+	if c.Query("lines") == "all" {
+		self.streamErrorLog(c)
+		return
+	}
+	lines := defaultErrorLogLines
+	if value := c.Query("lines"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxErrorLogLines {
+			self.writeJSON(
+				c,
+				http.StatusBadRequest,
+				gin.H{"success": false, "error": fmt.Sprintf("lines must be all or between 1 and %d", maxErrorLogLines)},
+			)
+			return
+		}
+		lines = n
+	}
+	dat, err := self.errorLog.tail(lines)
 	if err != nil {
-		log.Print(err)
-		c.JSON(
-			http.StatusOK,
-			gin.H{"success": false, "data": err},
-		)
+		self.errorLogFailed(c, err)
+		return
 	}
-	c.JSON(
+	self.writeJSON(
+		c,
 		http.StatusOK,
 		gin.H{"success": true, "data": string(dat[:])},
 	)
 }
 
+func (self *HTTPServer) streamErrorLog(c *gin.Context) {
+	f, err := self.errorLog.open()
+	if err != nil {
+		self.errorLogFailed(c, err)
+		return
+	}
+	defer f.Close()
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, f); err != nil {
+		self.logger.Error("streaming error log failed", logger.Fields{"error": err})
+	}
+}
+
+func (self *HTTPServer) errorLogFailed(c *gin.Context, err error) {
+	if os.IsNotExist(err) {
+		self.writeJSON(
+			c,
+			http.StatusNotFound,
+			gin.H{"success": false, "error": "error log not found"},
+		)
+		return
+	}
+	self.logger.Error("reading error log failed", logger.Fields{"error": err})
+	self.writeJSON(
+		c,
+		http.StatusInternalServerError,
+		gin.H{"success": false, "error": "reading error log failed"},
+	)
+}
+
+// GetHealth 200 when persister has rates and node cache refreshed within healthNodeMaxAge,
+// 503 listing unhealthy subsystems otherwise. Node is not checked when no method is cached
+func (self *HTTPServer) GetHealth(c *gin.Context) {
+	now := time.Now()
+	unhealthy := []string{}
+	data := gin.H{"latestBlock": self.persister.GetLatestBlock()}
+
+	rateUpdatedAt := self.persister.GetTimeUpdateRate()
+	if rateUpdatedAt == 0 {
+		unhealthy = append(unhealthy, healthPersister)
+	}
+	data["rateUpdatedAt"] = rateUpdatedAt
+	if blockUpdatedAt := self.persister.GetTimeUpdateLatestBlock(); blockUpdatedAt != 0 {
+		data["latestBlockAgeSeconds"] = now.Unix() - blockUpdatedAt
+	}
+
+	if self.node != nil {
+		data["circuitBreaker"] = self.node.CircuitBreakerState()
+	}
+	if self.node != nil && self.node.WarmupProgress().Total > 0 {
+		lastRefresh := self.node.LastRefresh()
+		if lastRefresh.IsZero() || now.Sub(lastRefresh) > self.healthNodeMaxAge {
+			unhealthy = append(unhealthy, healthNode)
+		}
+		if !lastRefresh.IsZero() {
+			data["nodeLastRefresh"] = lastRefresh.Unix()
+		}
+	}
+
+	status := http.StatusOK
+	if len(unhealthy) > 0 {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(
+		status,
+		gin.H{"success": len(unhealthy) == 0, "unhealthy": unhealthy, "data": data},
+	)
+}
+
 func (self *HTTPServer) getCacheVersion(c *gin.Context) {
 	timeRun := self.persister.GetTimeVersion()
-	c.JSON(
+	self.writeJSON(
+		c,
 		http.StatusOK,
 		gin.H{"success": true, "data": timeRun},
 	)
@@ -171,13 +514,15 @@ func (self *HTTPServer) GetUserInfo(c *gin.Context) {
 	address := c.Query("address")
 	userInfo, err := self.fetcher.FetchUserInfo(address)
 	if err != nil {
-		c.JSON(
-			http.StatusOK,
+		self.writeJSON(
+			c,
+			http.StatusInternalServerError,
 			gin.H{"error": err.Error()},
 		)
 		return
 	}
-	c.JSON(
+	self.writeJSON(
+		c,
 		http.StatusOK,
 		userInfo,
 	)
@@ -190,101 +535,217 @@ func (self *HTTPServer) GetSourceAmount(c *gin.Context) {
 	srcAmount, err := self.fetcher.GetSourceAmount(src, dest, destAmount)
 
 	if err != nil {
-		c.JSON(
-			http.StatusOK,
+		self.writeJSON(
+			c,
+			errorStatus(err),
 			gin.H{"error": err.Error()},
 		)
 		return
 	}
 
-	c.JSON(
+	self.writeJSON(
+		c,
 		http.StatusOK,
 		gin.H{"success": true, "value": srcAmount},
 	)
 }
 
+// errorStatus 404 for unknown tokens and pairs, 500 for other errors
+func errorStatus(err error) int {
+	if err == fetcher.ErrTokenNotFound || err == refprice.ErrContractNotFound {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
 func (self *HTTPServer) GetRefprice(c *gin.Context) {
 	base := c.Query("base")
 	quote := c.Query("quote")
 
 	price, err := self.refPrice.GetRefPrice(strings.ToUpper(base), strings.ToUpper(quote))
 	if err != nil {
-		c.JSON(
-			http.StatusOK,
+		self.writeJSON(
+			c,
+			errorStatus(err),
 			gin.H{"error": err.Error()},
 		)
 		return
 	}
-	c.JSON(
+	self.writeJSON(
+		c,
 		http.StatusOK,
 		gin.H{"success": true, "value": price},
 	)
 }
 
+// PostNodeRequest proxy a JSON-RPC request to node, CORS headers come from the cors config
 func (self *HTTPServer) PostNodeRequest(c *gin.Context) {
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-	c.Writer.Header().Set("Access-Control-Allow-Methods", "DELETE, GET, OPTIONS, PATCH, POST, PUT")
-	c.Writer.Header().Set("Access-Control-Allow-Headers", "accept, accept-encoding, authorization, content-type, dnt, origin, user-agent, x-csrftoken, x-requested-with, alchemy-web3-version")
-
 	self.node.HandleNodeRequest(c)
 }
 
-func (self *HTTPServer) Run(kyberENV string) {
-	self.r.GET("/getLatestBlock", self.GetLatestBlock)
-	self.r.GET("/latestBlock", self.GetLatestBlock)
+// GetCachedMethods list methods served from cache instead of node, with their refresh interval
+func (self *HTTPServer) GetCachedMethods(c *gin.Context) {
+	self.writeJSON(
+		c,
+		http.StatusOK,
+		gin.H{"success": true, "data": self.node.CachedMethods()},
+	)
+}
 
-	self.r.GET("/getRateUSD", self.GetRateUSD)
-	self.r.GET("/rateUSD", self.GetRateUSD)
+func (self *HTTPServer) Run(kyberENV string) error {
+	self.read("/getLatestBlock", self.GetLatestBlock)
+	self.read("/latestBlock", self.GetLatestBlock)
 
-	self.r.GET("/getRate", self.GetRate)
-	self.r.GET("/rate", self.GetRate)
+	self.read("/getRateUSD", self.GetRateUSD)
+	self.read("/rateUSD", self.GetRateUSD)
 
-	self.r.GET("/getKyberEnabled", self.GetKyberEnabled)
-	self.r.GET("/kyberEnabled", self.GetKyberEnabled)
+	self.read("/getRate", self.GetRate)
+	self.read("/rate", self.GetRate)
 
-	self.r.GET("/getMaxGasPrice", self.GetMaxGasPrice)
-	self.r.GET("/maxGasPrice", self.GetMaxGasPrice)
+	self.read("/getRatesCombined", self.GetRatesCombined)
+	self.read("/ratesCombined", self.GetRatesCombined)
 
-	self.r.GET("/getGasPrice", self.GetGasPrice)
-	self.r.GET("/gasPrice", self.GetGasPrice)
+	self.read("/getKyberEnabled", self.GetKyberEnabled)
+	self.read("/kyberEnabled", self.GetKyberEnabled)
 
-	self.r.GET("/getRateETH", self.GetRateETH)
-	self.r.GET("/rateETH", self.GetRateETH)
+	self.read("/getMaxGasPrice", self.GetMaxGasPrice)
+	self.read("/maxGasPrice", self.GetMaxGasPrice)
 
-	self.r.GET("/cacheVersion", self.getCacheVersion)
+	self.read("/getGasPrice", self.GetGasPrice)
+	self.read("/gasPrice", self.GetGasPrice)
 
-	self.r.GET("/users", self.GetUserInfo)
+	self.read("/getRateHistory", self.GetRateHistory)
+	self.read("/rateHistory", self.GetRateHistory)
+	self.read("/getRatePair", self.GetRatePair)
+	self.read("/ratePair", self.GetRatePair)
 
-	self.r.GET("/sourceAmount", self.GetSourceAmount)
+	self.read("/getRateETH", self.GetRateETH)
+	self.read("/rateETH", self.GetRateETH)
 
-	self.r.GET("/refprice", self.GetRefprice)
+	self.read("/cacheVersion", self.getCacheVersion)
 
-	self.r.POST("/node", self.PostNodeRequest)
+	self.read("/ready", self.GetReady)
 
-	// if kyberENV != "production" {
-	// 	self.r.GET("/9d74529bc6c25401a2f984ccc9b0b2b3", self.GetErrorLog)
-	// }
+	self.read("/health", self.GetHealth)
 
-	self.r.Run(self.host)
-}
+	self.read("/openapi.json", self.GetOpenAPI)
 
-func NewHTTPServer(host string, persister persister.Persister, fetcher *fetcher.Fetcher, node *node.NodeMiddleware) *HTTPServer {
-	r := gin.Default()
-	r.Use(sentry.Recovery(raven.DefaultClient, false))
+	self.r.GET("/sse/rates", self.GetRatesStream)
 
-	corsConfig := cors.DefaultConfig()
-	corsConfig.AllowAllOrigins = true
-	corsConfig.AllowMethods = []string{"DELETE", "GET", "OPTIONS", "PATCH", "POST", "PUT"}
-	corsConfig.AllowHeaders = []string{"accept", "accept-encoding", "authorization", "content-type", "dnt", "origin", "user-agent", "x-csrftoken", "x-requested-with", "alchemy-web3-version"}
-	corsConfig.AllowCredentials = true
+	if self.metricsHandler != nil {
+		self.r.GET("/metrics", self.GetMetrics)
+	}
 
-	corsConfig.MaxAge = 5 * time.Minute
+	self.read("/users", self.GetUserInfo)
 
+	self.read("/sourceAmount", self.GetSourceAmount)
+
+	self.read("/refprice", self.GetRefprice)
+
+	self.r.POST("/node", self.PostNodeRequest)
+	self.read("/node/cachedMethods", self.GetCachedMethods)
+
+	if self.adminToken != "" {
+		admin := self.r.Group("/", adminAuth(self.adminToken))
+		admin.GET("/node/proxyAudit", self.GetProxyAudit)
+		admin.POST("/proxy/explain", self.ExplainProxyRequest)
+		admin.GET("/debug/nodeInfo", self.GetNodeInfo)
+		admin.GET("/debug/warmup", self.GetWarmup)
+		admin.GET("/debug/bundle", self.GetBundle)
+		admin.POST("/node/warm", self.RefreshNodeCache)
+		admin.GET(self.errorLogRoute, self.GetErrorLog)
+	}
+
+	if err := self.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func NewHTTPServer(host string, persister persister.Persister, fetcher *fetcher.Fetcher, node *node.NodeMiddleware, opts ...ServerOption) *HTTPServer {
+	self := &HTTPServer{headRequests: true, compressionMinSize: defaultCompressionMinSize, logger: logger.Default()}
+	for _, opt := range opts {
+		opt(self)
+	}
+
+	r := gin.New()
+	r.Use(requestID())
+	if !self.disableLogger {
+		r.Use(gin.Logger())
+	}
+	if self.accessLog != nil {
+		r.Use(accessLogger(self.accessLog))
+	}
+	if os.Getenv("ENABLE_METRICS") == "true" {
+		// the default sink has a prometheus sink when ENABLE_METRICS is set
+		if prometheusSink := metrics.Prometheus(metrics.Default()); prometheusSink != nil {
+			self.metrics = metrics.Default()
+			self.metricsHandler = prometheusSink.Handler()
+			r.Use(requestMetrics(self.metrics))
+			r.NoRoute(markUnmatched)
+		}
+	}
+	r.Use(gin.Recovery())
+	if self.rateLimiter != nil {
+		r.Use(self.rateLimiter.middleware(self.trustedProxies))
+	}
+	if self.compression {
+		r.Use(gzipCompression(self.compressionLevel, self.compressionMinSize))
+	}
+	if sentryClient := newSentryClient(); sentryClient != nil {
+		r.Use(sentry.Recovery(sentryClient, false))
+	}
+
+	corsConfig := defaultCORSConfig()
+	if self.cors != nil {
+		corsConfig = self.cors.corsConfig()
+	}
 	r.Use(cors.New(corsConfig))
 
 	refPrice := refprice.NewRefPrice()
 
-	return &HTTPServer{
-		node, fetcher, persister, host, r, refPrice,
+	errorLogCacheSeconds := defaultErrorLogCacheSeconds
+	if seconds, err := strconv.Atoi(os.Getenv("ERROR_LOG_CACHE_SECONDS")); err == nil && seconds >= 0 {
+		errorLogCacheSeconds = seconds
 	}
+
+	errorLogRoute := os.Getenv("ERROR_LOG_ROUTE")
+	if errorLogRoute == "" {
+		errorLogRoute = defaultErrorLogRoute
+	} else if !strings.HasPrefix(errorLogRoute, "/") {
+		errorLogRoute = "/" + errorLogRoute
+	}
+
+	casing := os.Getenv("RESPONSE_CASING")
+	if casing != CasingSnake {
+		casing = CasingCamel
+	}
+
+	sseMaxConnections := int64(defaultSSEMaxConnections)
+	if maxConn, err := strconv.ParseInt(os.Getenv("SSE_MAX_CONNECTIONS"), 10, 64); err == nil && maxConn > 0 {
+		sseMaxConnections = maxConn
+	}
+
+	healthNodeMaxAge := defaultHealthNodeMaxAge
+	if seconds, err := strconv.Atoi(os.Getenv("HEALTH_NODE_MAX_AGE")); err == nil && seconds > 0 {
+		healthNodeMaxAge = time.Duration(seconds) * time.Second
+	}
+
+	self.node = node
+	self.fetcher = fetcher
+	self.persister = persister
+	self.host = host
+	self.r = r
+	self.srv = &http.Server{Addr: host, Handler: r}
+	self.closeStreamsOnShutdown()
+	self.refPrice = refPrice
+	self.adminToken = os.Getenv("ADMIN_TOKEN")
+	self.errorLog = newErrorLogCache(defaultErrorLogPath, time.Duration(errorLogCacheSeconds)*time.Second)
+	self.errorLogRoute = errorLogRoute
+	self.casing = casing
+	self.sseMaxConnections = sseMaxConnections
+	self.ssePollInterval = defaultSSEPollInterval
+	self.sseKeepAliveInterval = defaultSSEKeepAliveInterval
+	self.healthNodeMaxAge = healthNodeMaxAge
+	return self
 }
@@ -0,0 +1,551 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/KyberNetwork/cache/ethereum"
+	"github.com/KyberNetwork/cache/fetcher"
+	"github.com/KyberNetwork/cache/logger"
+	"github.com/KyberNetwork/cache/persister"
+	"github.com/KyberNetwork/cache/refprice"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRateSource(t *testing.T) {
+	rates := []ethereum.Rate{
+		{Source: "KNC", Dest: "ETH", Rate: "580350000000000", Minrate: "562939500000000", Liquidity: 12, Provider: ethereum.RateProviderMarket},
+	}
+	data, err := json.Marshal(withRateSource(rates))
+	assert.Nil(t, err)
+	assert.JSONEq(t, `[{"source":"KNC","dest":"ETH","rate":"580350000000000","minRate":"562939500000000","rateSource":"market"}]`, string(data))
+
+	// provider is not exposed by default
+	data, err = json.Marshal(rates)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `[{"source":"KNC","dest":"ETH","rate":"580350000000000","minRate":"562939500000000"}]`, string(data))
+}
+
+func TestWriteNotChangedStatus(t *testing.T) {
+	server := &HTTPServer{r: gin.New(), unchangedAsSuccess: true}
+	server.r.GET("/gasPrice", func(c *gin.Context) {
+		server.writeNotChanged(c, gin.H{"success": false}, nil)
+	})
+
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/gasPrice", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"success":false}`, w.Body.String())
+
+	// not fresh data is a success for the new API version
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/gasPrice?apiVersion=2", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestUnchangedAsSuccess(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	ramPersister.SaveRate([]ethereum.Rate{{Source: "KNC", Dest: "ETH", Rate: "1", Minrate: "1"}}, 1600000000)
+	assert.Nil(t, ramPersister.SaveRateUSD("400"))
+	ramPersister.SetIsNewRate(false)
+	ramPersister.SetNewRateUSD(false)
+	ramPersister.SetNewLatestBlock(false)
+	ramPersister.SetNewKyberEnabled(false)
+	ramPersister.SetNewMaxGasPrice(false)
+	ramPersister.SetNewGasPrice(false)
+
+	routes := map[string]string{
+		"/rate":          `[]`,
+		"/rateUSD":       `[]`,
+		"/ratesCombined": `{"rates":[],"ratesUSD":[]}`,
+		"/rateETH":       `null`,
+		"/latestBlock":   `null`,
+		"/kyberEnabled":  `null`,
+		"/maxGasPrice":   `null`,
+		"/gasPrice":      `null`,
+	}
+	for _, unchangedAsSuccess := range []bool{false, true} {
+		server := &HTTPServer{r: gin.New(), persister: ramPersister, unchangedAsSuccess: unchangedAsSuccess}
+		server.r.GET("/rate", server.GetRate)
+		server.r.GET("/rateUSD", server.GetRateUSD)
+		server.r.GET("/ratesCombined", server.GetRatesCombined)
+		server.r.GET("/rateETH", server.GetRateETH)
+		server.r.GET("/latestBlock", server.GetLatestBlock)
+		server.r.GET("/kyberEnabled", server.GetKyberEnabled)
+		server.r.GET("/maxGasPrice", server.GetMaxGasPrice)
+		server.r.GET("/gasPrice", server.GetGasPrice)
+
+		for route, empty := range routes {
+			// the legacy API version always keeps success:false
+			w := httptest.NewRecorder()
+			server.r.ServeHTTP(w, httptest.NewRequest("GET", route, nil))
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code, route)
+			var legacy map[string]interface{}
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &legacy))
+			assert.Equal(t, false, legacy["success"], route)
+
+			w = httptest.NewRecorder()
+			server.r.ServeHTTP(w, httptest.NewRequest("GET", route+"?apiVersion=2", nil))
+			if !unchangedAsSuccess {
+				assert.Equal(t, http.StatusServiceUnavailable, w.Code, route)
+				continue
+			}
+			assert.Equal(t, http.StatusOK, w.Code, route)
+			var body struct {
+				Success bool            `json:"success"`
+				Changed *bool           `json:"changed"`
+				Data    json.RawMessage `json:"data"`
+			}
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.True(t, body.Success, route)
+			assert.NotNil(t, body.Changed, route)
+			assert.False(t, *body.Changed, route)
+			assert.JSONEq(t, empty, string(body.Data), route)
+		}
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, errorStatus(fetcher.ErrTokenNotFound))
+	assert.Equal(t, http.StatusNotFound, errorStatus(refprice.ErrContractNotFound))
+	assert.Equal(t, http.StatusInternalServerError, errorStatus(errors.New("timeout")))
+}
+
+func TestGetHealth(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	server := &HTTPServer{r: gin.New(), persister: ramPersister}
+	server.r.GET("/health", server.GetHealth)
+
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var body struct {
+		Success   bool     `json:"success"`
+		Unhealthy []string `json:"unhealthy"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.False(t, body.Success)
+	assert.Equal(t, []string{healthPersister}, body.Unhealthy)
+
+	ramPersister.SaveRate([]ethereum.Rate{}, 1600000000)
+	assert.Nil(t, ramPersister.SaveLatestBlock("100"))
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"latestBlockAgeSeconds"`)
+}
+
+func TestRateTimestamp(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	server := &HTTPServer{r: gin.New(), persister: ramPersister}
+	server.r.GET("/rateUSD", server.GetRateUSD)
+
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/rateUSD", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"success":false,"data":null,"timestamp":0}`, w.Body.String())
+
+	assert.Nil(t, ramPersister.SaveRateUSD("400"))
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/rateUSD", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Success   bool  `json:"success"`
+		Timestamp int64 `json:"timestamp"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.True(t, body.Success)
+	assert.Equal(t, ramPersister.GetRateUSDTimestamp(), body.Timestamp)
+}
+
+func TestGetRateHistory(t *testing.T) {
+	os.Setenv("RATE_HISTORY_MAX_POINTS", "2")
+	defer os.Unsetenv("RATE_HISTORY_MAX_POINTS")
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	server := &HTTPServer{r: gin.New(), persister: ramPersister}
+	server.r.GET("/rateHistory", server.GetRateHistory)
+
+	for _, rate := range []string{"1", "2", "3"} {
+		ramPersister.SaveRate([]ethereum.Rate{
+			{Source: "KNC", Dest: "ETH", Rate: rate, Minrate: rate},
+			{Source: "ETH", Dest: "KNC", Rate: "9", Minrate: "9"},
+		}, 0)
+	}
+
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/rateHistory?token=KNC", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Success bool                  `json:"success"`
+		Data    []persister.RatePoint `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.True(t, body.Success)
+	// oldest point is evicted
+	assert.Equal(t, 2, len(body.Data))
+	assert.Equal(t, "2", body.Data[0].Rate)
+	assert.Equal(t, "3", body.Data[1].Rate)
+	assert.True(t, body.Data[0].Timestamp <= body.Data[1].Timestamp)
+
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/rateHistory?token=KNC&dest=ETH&from="+strconv.FormatInt(body.Data[1].Timestamp+1, 10), nil))
+	assert.JSONEq(t, `{"success":true,"data":[]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/rateHistory", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/rateHistory?token=KNC&to=soon", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetRatePair(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	server := &HTTPServer{r: gin.New(), persister: ramPersister}
+	server.r.GET("/ratePair", server.GetRatePair)
+	ramPersister.SaveRate([]ethereum.Rate{
+		{Source: "KNC", Dest: "ETH", Rate: "2000000000000000", Minrate: "1"},
+		{Source: "ETH", Dest: "DAI", Rate: "400000000000000000000", Minrate: "1"},
+		{Source: "ETH", Dest: "OMG", Rate: "500000000000000000000", Minrate: "1"},
+	}, 1600000000)
+
+	for query, expected := range map[string]string{
+		"src=KNC&dst=ETH": `{"source":"KNC","dest":"ETH","rate":"2000000000000000","derivation":"direct","path":["KNC","ETH"]}`,
+		"src=ETH&dst=KNC": `{"source":"ETH","dest":"KNC","rate":"500000000000000000000","derivation":"inverse","path":["ETH","KNC"]}`,
+		"src=KNC&dst=DAI": `{"source":"KNC","dest":"DAI","rate":"800000000000000000","derivation":"cross","path":["KNC","ETH","DAI"]}`,
+		"src=DAI&dst=OMG": `{"source":"DAI","dest":"OMG","rate":"1250000000000000000","derivation":"cross","path":["DAI","ETH","OMG"]}`,
+	} {
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, httptest.NewRequest("GET", "/ratePair?"+query, nil))
+		assert.Equal(t, http.StatusOK, w.Code, query)
+		var body struct {
+			Success bool            `json:"success"`
+			Data    json.RawMessage `json:"data"`
+		}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.True(t, body.Success)
+		assert.JSONEq(t, expected, string(body.Data), query)
+	}
+
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/ratePair?src=ABC&dst=XYZ", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"success":false,"error":"unknown tokens: ABC, XYZ"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/ratePair?src=KNC", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetRateTokens(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	ramPersister.SaveRate([]ethereum.Rate{
+		{Source: "KNC", Dest: "ETH", Rate: "1", Minrate: "1"},
+		{Source: "ETH", Dest: "KNC", Rate: "2", Minrate: "2"},
+		{Source: "DAI", Dest: "ETH", Rate: "3", Minrate: "3"},
+	}, 1600000000)
+	ramPersister.SetIsNewRate(true)
+	server := &HTTPServer{r: gin.New(), persister: ramPersister}
+	server.r.GET("/rate", server.GetRate)
+
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/rate?tokens=knc,FOO", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Data    []ethereum.Rate `json:"data"`
+		Unknown []string        `json:"unknown"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Len(t, body.Data, 2)
+	assert.Equal(t, []string{"FOO"}, body.Unknown)
+
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/rate", nil))
+	assert.NotContains(t, w.Body.String(), "unknown")
+}
+
+func TestGetRateMinLiquidity(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	ramPersister.SaveRate([]ethereum.Rate{
+		{Source: "KNC", Dest: "ETH", Rate: "1", Minrate: "1", Liquidity: 500},
+		{Source: "ETH", Dest: "KNC", Rate: "2", Minrate: "2", Liquidity: 500},
+		{Source: "DAI", Dest: "ETH", Rate: "3", Minrate: "3", Liquidity: 10.5},
+	}, 1600000000)
+	ramPersister.SetIsNewRate(true)
+	server := &HTTPServer{r: gin.New(), persister: ramPersister}
+	server.r.GET("/rate", server.GetRate)
+
+	for query, expected := range map[string][]string{
+		"":                  {"KNC", "ETH", "DAI"},
+		"minLiquidity=0":    {"KNC", "ETH", "DAI"},
+		"minLiquidity=10.5": {"KNC", "ETH", "DAI"},
+		"minLiquidity=100":  {"KNC", "ETH"},
+		"minLiquidity=1e6":  {},
+	} {
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, httptest.NewRequest("GET", "/rate?"+query, nil))
+		assert.Equal(t, http.StatusOK, w.Code, query)
+		var body struct {
+			Success bool            `json:"success"`
+			Data    []ethereum.Rate `json:"data"`
+		}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.True(t, body.Success, query)
+		assert.NotNil(t, body.Data, query)
+		sources := []string{}
+		for _, rate := range body.Data {
+			sources = append(sources, rate.Source)
+		}
+		assert.Equal(t, expected, sources, query)
+	}
+
+	for _, query := range []string{"minLiquidity=-1", "minLiquidity=lots"} {
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, httptest.NewRequest("GET", "/rate?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		assert.JSONEq(t, `{"success":false,"error":"minLiquidity must be a non-negative number"}`, w.Body.String())
+	}
+}
+
+func TestGetRateFields(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	ramPersister.SaveRate([]ethereum.Rate{
+		{Source: "KNC", Dest: "ETH", Rate: "1", Minrate: "1"},
+	}, 1600000000)
+	ramPersister.SetIsNewRate(true)
+	server := &HTTPServer{r: gin.New(), persister: ramPersister, casing: CasingSnake}
+	server.r.GET("/rate", server.GetRate)
+
+	for _, query := range []string{"fields=source,rate,unknown", "fields=source,rate&apiVersion=2", "fields=source,rate,rateSource&includeSource=true"} {
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, httptest.NewRequest("GET", "/rate?"+query, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		var body struct {
+			Data json.RawMessage `json:"data"`
+		}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+		expected := `[{"source":"KNC","rate":"1"}]`
+		if strings.Contains(query, "includeSource") {
+			expected = `[{"source":"KNC","rate":"1","rateSource":""}]`
+		}
+		assert.JSONEq(t, expected, string(body.Data), query)
+	}
+
+	// names in the casing of the response
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/rate?fields=min_rate&apiVersion=2", nil))
+	assert.Contains(t, w.Body.String(), `"data":[{"min_rate":"1"}]`)
+
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/rate", nil))
+	assert.Contains(t, w.Body.String(), `"minRate":"1"`)
+}
+
+func TestGetLatestBlockMaxAge(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	server := &HTTPServer{r: gin.New(), persister: ramPersister}
+	server.r.GET("/latestBlock", server.GetLatestBlock)
+
+	// never fetched
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/latestBlock?maxAge=30", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"success":false,"stale":true}`, w.Body.String())
+
+	assert.Nil(t, ramPersister.SaveLatestBlock("100"))
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/latestBlock?maxAge=30", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"success":true,"data":"100"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/latestBlock?maxAge=-1", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetLatestBlockConfirmations(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	assert.Nil(t, ramPersister.SaveLatestBlock("100"))
+	server := &HTTPServer{r: gin.New(), persister: ramPersister}
+	server.r.GET("/latestBlock", server.GetLatestBlock)
+
+	tests := []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{"", http.StatusOK, `{"success":true,"data":"100"}`},
+		{"?confirmations=0", http.StatusOK, `{"success":true,"data":"100"}`},
+		{"?confirmations=12", http.StatusOK, `{"success":true,"data":"88"}`},
+		{"?confirmations=100", http.StatusOK, `{"success":true,"data":"0"}`},
+		{"?confirmations=101", http.StatusBadRequest, `{"success":false,"error":"confirmations is larger than latest block"}`},
+		{"?confirmations=-1", http.StatusBadRequest, `{"success":false,"error":"confirmations must be a non-negative integer"}`},
+		{"?confirmations=abc", http.StatusBadRequest, `{"success":false,"error":"confirmations must be a non-negative integer"}`},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, httptest.NewRequest("GET", "/latestBlock"+test.query, nil))
+		assert.Equal(t, test.status, w.Code, test.query)
+		assert.JSONEq(t, test.body, w.Body.String(), test.query)
+	}
+}
+
+func TestGetGasPriceUnit(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	ramPersister.SaveGasPrice(&ethereum.GasPrice{Fast: "12.5", Standard: "10", Low: "8", Default: "10"})
+	server := &HTTPServer{r: gin.New(), persister: ramPersister}
+	server.r.GET("/gasPrice", server.GetGasPrice)
+
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/gasPrice", nil))
+	assert.JSONEq(t, `{"success":true,"unit":"gwei","data":{"fast":"12.5","standard":"10","low":"8","default":"10"}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/gasPrice?unit=wei", nil))
+	assert.JSONEq(t, `{"success":true,"unit":"wei","data":{"fast":"12500000000","standard":"10000000000","low":"8000000000","default":"10000000000"}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/gasPrice?unit=ether", nil))
+	assert.JSONEq(t, `{"success":true,"unit":"ether","data":{"fast":"0.0000000125","standard":"0.00000001","low":"0.000000008","default":"0.00000001"}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/gasPrice?unit=szabo", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetErrorLogAdminToken(t *testing.T) {
+	server := &HTTPServer{r: gin.New(), errorLog: newErrorLogCache(defaultErrorLogPath, 0), logger: logger.Default()}
+	server.r.GET(defaultErrorLogRoute, adminAuth("secret"), server.GetErrorLog)
+
+	for _, token := range []string{"", "wrong"} {
+		req := httptest.NewRequest("GET", defaultErrorLogRoute, nil)
+		req.Header.Set(adminTokenHeader, token)
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// the token is not read from the query, it would be written to request logs
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", defaultErrorLogRoute+"?token=secret", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest("GET", defaultErrorLogRoute, nil)
+	req.Header.Set(adminTokenHeader, "secret")
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, req)
+	assert.NotEqual(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestGetErrorLogLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errorlog")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "error.log")
+
+	server := &HTTPServer{r: gin.New(), errorLog: newErrorLogCache(path, 0), logger: logger.Default()}
+	server.r.GET(defaultErrorLogRoute, server.GetErrorLog)
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, httptest.NewRequest("GET", defaultErrorLogRoute+query, nil))
+		return w
+	}
+
+	w := get("")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"success":false,"error":"error log not found"}`, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, get("?lines=all").Code)
+
+	// longer than a chunk so tail reads backwards more than once
+	var content strings.Builder
+	for i := 1; i <= 3000; i++ {
+		content.WriteString("error line " + strconv.Itoa(i) + "\n")
+	}
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content.String()), 0644))
+
+	var result struct {
+		Data string `json:"data"`
+	}
+	w = get("?lines=2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, "error line 2999\nerror line 3000\n", result.Data)
+
+	w = get("")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, defaultErrorLogLines, strings.Count(result.Data, "\n"))
+	assert.True(t, strings.HasPrefix(result.Data, "error line 2001\n"))
+
+	w = get("?lines=5000")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, content.String(), result.Data)
+
+	w = get("?lines=all")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, content.String(), w.Body.String())
+
+	for _, lines := range []string{"0", "-1", "abc", strconv.Itoa(maxErrorLogLines + 1)} {
+		assert.Equal(t, http.StatusBadRequest, get("?lines="+lines).Code, lines)
+	}
+}
+
+func TestGetRatesCombined(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	server := &HTTPServer{r: gin.New(), persister: ramPersister}
+	server.r.GET("/ratesCombined", server.GetRatesCombined)
+	get := func() (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, httptest.NewRequest("GET", "/ratesCombined", nil))
+		body := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	ramPersister.SetNewRateUSD(false)
+	code, body := get()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, map[string]interface{}{"success": false}, body)
+
+	ramPersister.SaveRate([]ethereum.Rate{{Source: "KNC", Dest: "ETH", Rate: "5000000000000000", Minrate: "4900000000000000"}}, 1600000000)
+	ramPersister.SetIsNewRate(true)
+	assert.Nil(t, ramPersister.SaveRateUSD("200"))
+	code, body = get()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, body["success"])
+	assert.Equal(t, float64(1600000000), body["updateAt"])
+	assert.Equal(t, true, body["consistent"])
+	assert.Equal(t, map[string]interface{}{"rates": true, "ratesUSD": true}, body["fresh"])
+	data := body["data"].(map[string]interface{})
+	assert.Equal(t, "KNC", data["rates"].([]interface{})[0].(map[string]interface{})["source"])
+	assert.Equal(t, 2, len(data["ratesUSD"].([]interface{})))
+
+	// rates of a newer refresh, rates USD still come from the previous one
+	ramPersister.SaveRate([]ethereum.Rate{{Source: "KNC", Dest: "ETH", Rate: "6000000000000000", Minrate: "5900000000000000"}}, 1600000015)
+	ramPersister.SetNewRateUSD(false)
+	code, body = get()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, false, body["consistent"])
+	assert.Equal(t, map[string]interface{}{"rates": true, "ratesUSD": false}, body["fresh"])
+}
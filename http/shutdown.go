@@ -0,0 +1,149 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ShutdownStep a stage of the shutdown sequence
+type ShutdownStep string
+
+const (
+	// ShutdownReadiness answer 503 on /ready so load balancers stop routing new requests
+	ShutdownReadiness ShutdownStep = "readiness"
+	// ShutdownHTTP stop accepting connections and wait for in-flight requests
+	ShutdownHTTP ShutdownStep = "http"
+	// ShutdownNode stop node cache workers
+	ShutdownNode ShutdownStep = "node"
+
+	defaultReadinessDelay = 5 * time.Second
+	defaultDrainTimeout   = 30 * time.Second
+	defaultNodeTimeout    = 10 * time.Second
+)
+
+// ShutdownConfig order and timeouts of the shutdown sequence
+type ShutdownConfig struct {
+	Order []ShutdownStep
+	// ReadinessDelay wait after flipping readiness so probes can notice it
+	ReadinessDelay time.Duration
+	DrainTimeout   time.Duration
+	NodeTimeout    time.Duration
+}
+
+// DefaultShutdownConfig flip readiness, drain HTTP then stop node cache workers,
+// so in-flight proxy requests can still be served from cache
+func DefaultShutdownConfig() ShutdownConfig {
+	return ShutdownConfig{
+		Order:          []ShutdownStep{ShutdownReadiness, ShutdownHTTP, ShutdownNode},
+		ReadinessDelay: defaultReadinessDelay,
+		DrainTimeout:   defaultDrainTimeout,
+		NodeTimeout:    defaultNodeTimeout,
+	}
+}
+
+// ParseShutdownOrder parse a comma separated list of steps, e.g. "readiness,http,node",
+// every step must appear exactly once
+func ParseShutdownOrder(value string) ([]ShutdownStep, error) {
+	order := []ShutdownStep{}
+	seen := make(map[ShutdownStep]bool)
+	for _, item := range strings.Split(value, ",") {
+		step := ShutdownStep(strings.TrimSpace(item))
+		switch step {
+		case ShutdownReadiness, ShutdownHTTP, ShutdownNode:
+		default:
+			return nil, fmt.Errorf("unknown shutdown step %q", step)
+		}
+		if seen[step] {
+			return nil, fmt.Errorf("duplicate shutdown step %q", step)
+		}
+		seen[step] = true
+		order = append(order, step)
+	}
+	if len(order) != 3 {
+		return nil, fmt.Errorf("shutdown order %q must contain readiness, http and node", value)
+	}
+	return order, nil
+}
+
+// Shutdown stop server and its node cache in the configured order,
+// every step runs even if a previous one failed, the first error is returned
+func Shutdown(ctx context.Context, server *HTTPServer, config ShutdownConfig) error {
+	var firstErr error
+	for _, step := range config.Order {
+		var err error
+		switch step {
+		case ShutdownReadiness:
+			err = server.unready(ctx, config.ReadinessDelay)
+		case ShutdownHTTP:
+			err = server.drain(ctx, config.DrainTimeout)
+		case ShutdownNode:
+			err = server.closeNode(ctx, config.NodeTimeout)
+		}
+		if err != nil {
+			log.Printf("shutdown %s: %v", step, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (self *HTTPServer) unready(ctx context.Context, delay time.Duration) error {
+	atomic.StoreInt32(&self.shuttingDown, 1)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (self *HTTPServer) drain(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return self.srv.Shutdown(ctx)
+}
+
+func (self *HTTPServer) closeNode(ctx context.Context, timeout time.Duration) error {
+	if self.node == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		self.node.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetReady readiness probe, 503 once shutdown started
+func (self *HTTPServer) GetReady(c *gin.Context) {
+	if atomic.LoadInt32(&self.shuttingDown) == 1 {
+		c.JSON(
+			http.StatusServiceUnavailable,
+			gin.H{"success": false},
+		)
+		return
+	}
+	c.JSON(
+		http.StatusOK,
+		gin.H{"success": true},
+	)
+}
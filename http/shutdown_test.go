@@ -0,0 +1,200 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KyberNetwork/cache/ethereum"
+	"github.com/KyberNetwork/cache/persister"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseShutdownOrder(t *testing.T) {
+	order, err := ParseShutdownOrder("node, readiness,http")
+	assert.Nil(t, err)
+	assert.Equal(t, []ShutdownStep{ShutdownNode, ShutdownReadiness, ShutdownHTTP}, order)
+
+	_, err = ParseShutdownOrder("readiness,http")
+	assert.NotNil(t, err)
+	_, err = ParseShutdownOrder("readiness,http,http")
+	assert.NotNil(t, err)
+	_, err = ParseShutdownOrder("readiness,http,cache")
+	assert.NotNil(t, err)
+}
+
+func TestShutdownFlipReadiness(t *testing.T) {
+	r := gin.New()
+	server := &HTTPServer{r: r, srv: &http.Server{Handler: r}}
+	r.GET("/ready", server.GetReady)
+
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	config := DefaultShutdownConfig()
+	config.ReadinessDelay = 0
+	assert.Nil(t, Shutdown(context.Background(), server, config))
+
+	w = httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+// newRunningServer run a server on a free local port with a /slow route which answers once
+// release is closed, return its address and the result of Run
+func newRunningServer(t *testing.T, release chan struct{}) (*HTTPServer, string, chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	r := gin.New()
+	r.GET("/slow", func(c *gin.Context) {
+		<-release
+		c.String(http.StatusOK, "done")
+	})
+	server := &HTTPServer{r: r, srv: &http.Server{Addr: addr, Handler: r}}
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- server.Run("")
+	}()
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	return server, addr, runErr
+}
+
+func TestRunGracefulShutdown(t *testing.T) {
+	release := make(chan struct{})
+	server, addr, runErr := newRunningServer(t, release)
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			inFlight <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		inFlight <- result{status: resp.StatusCode, body: string(body), err: err}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	config := DefaultShutdownConfig()
+	config.ReadinessDelay = 0
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- Shutdown(context.Background(), server, config)
+	}()
+
+	// new connections are refused while the in-flight request is drained
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	}, 2*time.Second, 10*time.Millisecond)
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("shutdown returned before the in-flight request: %v", err)
+	default:
+	}
+
+	close(release)
+	res := <-inFlight
+	assert.Nil(t, res.err)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, "done", res.body)
+	assert.Nil(t, <-shutdownErr)
+	assert.Nil(t, <-runErr)
+}
+
+func TestRunDrainTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	server, addr, runErr := newRunningServer(t, release)
+
+	go http.Get("http://" + addr + "/slow")
+	time.Sleep(100 * time.Millisecond)
+
+	config := DefaultShutdownConfig()
+	config.ReadinessDelay = 0
+	config.DrainTimeout = 100 * time.Millisecond
+	assert.Equal(t, context.DeadlineExceeded, Shutdown(context.Background(), server, config))
+	assert.Nil(t, <-runErr)
+}
+
+func TestRunListenError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	r := gin.New()
+	server := &HTTPServer{r: r, srv: &http.Server{Addr: listener.Addr().String(), Handler: r}}
+	assert.NotNil(t, server.Run(""))
+}
+
+func TestShutdownNode(t *testing.T) {
+	nodeMiddleware, closeNode := newTestNodeMiddleware(t)
+	defer closeNode()
+	r := gin.New()
+	server := &HTTPServer{r: r, srv: &http.Server{Handler: r}, node: nodeMiddleware}
+
+	config := DefaultShutdownConfig()
+	config.Order = []ShutdownStep{ShutdownNode}
+	assert.Nil(t, Shutdown(context.Background(), server, config))
+}
+
+func TestDrainOpenStream(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	ramPersister.SaveRate([]ethereum.Rate{{Source: "KNC", Dest: "ETH", Rate: "580350000000000", Minrate: "562939500000000"}}, 1600000000)
+	ramPersister.SetIsNewRate(true)
+
+	r := gin.New()
+	server := &HTTPServer{
+		r:                    r,
+		srv:                  &http.Server{Handler: r},
+		persister:            ramPersister,
+		sseMaxConnections:    1,
+		ssePollInterval:      10 * time.Millisecond,
+		sseKeepAliveInterval: time.Minute,
+	}
+	server.closeStreamsOnShutdown()
+	r.GET("/sse/rates", server.GetRatesStream)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go server.srv.Serve(listener)
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/sse/rates")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	stream := bufio.NewReader(resp.Body)
+	assert.Equal(t, "event:rates\n", readEvent(t, stream, "event:"))
+
+	// the stream ends with the shutdown instead of holding it for the drain timeout
+	start := time.Now()
+	assert.Nil(t, server.drain(context.Background(), 5*time.Second))
+	assert.True(t, time.Since(start) < time.Second, "drain took %s", time.Since(start))
+	_, err = ioutil.ReadAll(stream)
+	assert.Nil(t, err)
+	assert.True(t, waitConnections(server, 0))
+}
@@ -0,0 +1,107 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSSEMaxConnections = 100
+
+	defaultSSEPollInterval      = time.Second
+	defaultSSEKeepAliveInterval = 15 * time.Second
+)
+
+// closeStreamsOnShutdown end open streams once srv shuts down. They only end on their own
+// when the client goes away, so a single stream would hold the drain for its whole timeout
+func (self *HTTPServer) closeStreamsOnShutdown() {
+	self.streamsDone = make(chan struct{})
+	var once sync.Once
+	self.srv.RegisterOnShutdown(func() {
+		once.Do(func() { close(self.streamsDone) })
+	})
+}
+
+// GetRatesStream push rates as Server-Sent Events whenever the persister has new rates.
+// With ?format=delta only the first event has every rate, next ones are rates-delta
+// events with the changes since the previous event
+func (self *HTTPServer) GetRatesStream(c *gin.Context) {
+	delta := false
+	switch c.Query("format") {
+	case "", "full":
+	case "delta":
+		delta = true
+	default:
+		self.writeJSON(
+			c,
+			http.StatusBadRequest,
+			gin.H{"success": false, "error": "format must be full or delta"},
+		)
+		return
+	}
+
+	if atomic.AddInt64(&self.sseConnections, 1) > self.sseMaxConnections {
+		atomic.AddInt64(&self.sseConnections, -1)
+		self.writeJSON(
+			c,
+			http.StatusServiceUnavailable,
+			gin.H{"success": false, "error": "too many stream connections"},
+		)
+		return
+	}
+	defer atomic.AddInt64(&self.sseConnections, -1)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	poll := time.NewTicker(self.ssePollInterval)
+	defer poll.Stop()
+	keepAlive := time.NewTicker(self.sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	clientGone := c.Request.Context().Done()
+	lastUpdate := int64(-1)
+	var encoder *rateDeltaEncoder
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-clientGone:
+			return false
+		case <-self.streamsDone:
+			return false
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return false
+			}
+		case <-poll.C:
+			if !self.persister.GetIsNewRate() {
+				return true
+			}
+			updateAt := self.persister.GetTimeUpdateRate()
+			if updateAt == lastUpdate {
+				return true
+			}
+			lastUpdate = updateAt
+			rates := self.persister.GetRate()
+			if !delta {
+				c.SSEvent("rates", gin.H{"updateAt": updateAt, "data": rates})
+				return true
+			}
+			if encoder == nil {
+				encoder = newRateDeltaEncoder(rates)
+				c.SSEvent("rates", gin.H{"updateAt": updateAt, "data": rates})
+				return true
+			}
+			if changes := encoder.encode(rates); !changes.empty() {
+				c.SSEvent("rates-delta", gin.H{"updateAt": updateAt, "data": changes})
+			}
+		}
+		return true
+	})
+}
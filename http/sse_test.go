@@ -0,0 +1,94 @@
+package http
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KyberNetwork/cache/ethereum"
+	"github.com/KyberNetwork/cache/persister"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// readEvent read lines of stream until one starts with prefix
+func readEvent(t *testing.T, stream *bufio.Reader, prefix string) string {
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended before %q: %v", prefix, err)
+		}
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+}
+
+// waitConnections wait for the number of open streams of server to be n
+func waitConnections(server *HTTPServer, n int64) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if atomic.LoadInt64(&server.sseConnections) == n {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
+
+func TestGetRatesStream(t *testing.T) {
+	ramPersister, err := persister.NewRamPersister()
+	assert.Nil(t, err)
+	ramPersister.SaveRate([]ethereum.Rate{{Source: "KNC", Dest: "ETH", Rate: "580350000000000", Minrate: "562939500000000"}}, 1600000000)
+	ramPersister.SetIsNewRate(true)
+
+	server := &HTTPServer{
+		r:                    gin.New(),
+		persister:            ramPersister,
+		sseMaxConnections:    1,
+		ssePollInterval:      10 * time.Millisecond,
+		sseKeepAliveInterval: 20 * time.Millisecond,
+	}
+	server.r.GET("/sse/rates", server.GetRatesStream)
+	ts := httptest.NewServer(server.r)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/sse/rates")
+	assert.Nil(t, err)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+	stream := bufio.NewReader(resp.Body)
+	assert.Equal(t, "event:rates\n", readEvent(t, stream, "event:"))
+	assert.Contains(t, readEvent(t, stream, "data:"), `"source":"KNC"`)
+	readEvent(t, stream, ": keep-alive")
+
+	// over the cap
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/sse/rates", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"success":false,"error":"too many stream connections"}`, w.Body.String())
+
+	// the handler returns once client is gone, freeing its slot
+	resp.Body.Close()
+	assert.True(t, waitConnections(server, 0), "stream is still open after client disconnected")
+
+	resp, err = http.Get(ts.URL + "/sse/rates")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	assert.True(t, waitConnections(server, 0))
+}
+
+func TestGetRatesStreamFormat(t *testing.T) {
+	server := &HTTPServer{r: gin.New(), sseMaxConnections: 1}
+	server.r.GET("/sse/rates", server.GetRatesStream)
+
+	w := httptest.NewRecorder()
+	server.r.ServeHTTP(w, httptest.NewRequest("GET", "/sse/rates?format=xml", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&server.sseConnections))
+}
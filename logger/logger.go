@@ -0,0 +1,79 @@
+package logger
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Fields structured context of a log line
+type Fields map[string]interface{}
+
+// Logger write structured log lines
+type Logger interface {
+	Info(msg string, fields Fields)
+	Error(msg string, fields Fields)
+}
+
+type loggerHolder struct {
+	logger Logger
+}
+
+var defaultLogger atomic.Value
+
+func init() {
+	defaultLogger.Store(loggerHolder{NewJSONLogger(os.Stderr)})
+}
+
+// Default return the logger used by packages which are not given one
+func Default() Logger {
+	return defaultLogger.Load().(loggerHolder).logger
+}
+
+// SetDefault replace the default logger, it should be called before creating the node cache and server
+func SetDefault(logger Logger) {
+	defaultLogger.Store(loggerHolder{logger})
+}
+
+// JSONLogger write a JSON object per line with time, level, msg and the fields
+type JSONLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLogger create a logger writing to w
+func NewJSONLogger(w io.Writer) *JSONLogger {
+	return &JSONLogger{w: w}
+}
+
+func (l *JSONLogger) Info(msg string, fields Fields) {
+	l.write("info", msg, fields)
+}
+
+func (l *JSONLogger) Error(msg string, fields Fields) {
+	l.write("error", msg, fields)
+}
+
+func (l *JSONLogger) write(level, msg string, fields Fields) {
+	line := make(map[string]interface{}, len(fields)+3)
+	for key, value := range fields {
+		// errors marshal to {} otherwise
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		line[key] = value
+	}
+	line["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	line["level"] = level
+	line["msg"] = msg
+	data, err := json.Marshal(line)
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{"time": line["time"], "level": level, "msg": msg, "logError": err.Error()})
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(append(data, '\n'))
+}
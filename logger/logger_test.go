@@ -0,0 +1,35 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewJSONLogger(buf)
+	l.Error("call to node failed", Fields{"method": "eth_gasPrice", "endpoint": "node-1:8545", "error": errors.New("timeout")})
+	l.Info("refreshed", nil)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+
+	line := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &line))
+	assert.Equal(t, "error", line["level"])
+	assert.Equal(t, "call to node failed", line["msg"])
+	assert.Equal(t, "eth_gasPrice", line["method"])
+	assert.Equal(t, "node-1:8545", line["endpoint"])
+	assert.Equal(t, "timeout", line["error"])
+	assert.NotEmpty(t, line["time"])
+
+	line = map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &line))
+	assert.Equal(t, "info", line["level"])
+	assert.Equal(t, "refreshed", line["msg"])
+}
@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// MetricsSink receive metric events and send them to a backend
+type MetricsSink interface {
+	Incr(name string, tags map[string]string)
+	Gauge(name string, value float64, tags map[string]string)
+	Timing(name string, d time.Duration, tags map[string]string)
+}
+
+type sinkHolder struct {
+	sink MetricsSink
+}
+
+var defaultSink atomic.Value
+
+func init() {
+	defaultSink.Store(sinkHolder{NoopSink{}})
+}
+
+// Default return the sink used by packages which are not given one
+func Default() MetricsSink {
+	return defaultSink.Load().(sinkHolder).sink
+}
+
+// SetDefault replace the default sink, it should be called before creating the node cache and server
+func SetDefault(sink MetricsSink) {
+	defaultSink.Store(sinkHolder{sink})
+}
+
+// NoopSink drop every metric
+type NoopSink struct{}
+
+func (NoopSink) Incr(name string, tags map[string]string)                    {}
+func (NoopSink) Gauge(name string, value float64, tags map[string]string)    {}
+func (NoopSink) Timing(name string, d time.Duration, tags map[string]string) {}
+
+// MultiSink send every metric to all of its sinks
+type MultiSink []MetricsSink
+
+func (m MultiSink) Incr(name string, tags map[string]string) {
+	for _, sink := range m {
+		sink.Incr(name, tags)
+	}
+}
+
+func (m MultiSink) Gauge(name string, value float64, tags map[string]string) {
+	for _, sink := range m {
+		sink.Gauge(name, value, tags)
+	}
+}
+
+func (m MultiSink) Timing(name string, d time.Duration, tags map[string]string) {
+	for _, sink := range m {
+		sink.Timing(name, d, tags)
+	}
+}
+
+// Snapshotter sinks which can report current values of their metrics
+type Snapshotter interface {
+	Snapshot() map[string]float64
+}
+
+// Snapshot current values of the sinks of sink which support it, nil when none does
+func Snapshot(sink MetricsSink) map[string]float64 {
+	switch s := sink.(type) {
+	case Snapshotter:
+		return s.Snapshot()
+	case MultiSink:
+		var result map[string]float64
+		for _, member := range s {
+			for key, value := range Snapshot(member) {
+				if result == nil {
+					result = make(map[string]float64)
+				}
+				result[key] = value
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// Prometheus the Prometheus sink of sink, nil when there is none
+func Prometheus(sink MetricsSink) *PrometheusSink {
+	switch s := sink.(type) {
+	case *PrometheusSink:
+		return s
+	case MultiSink:
+		for _, member := range s {
+			if p := Prometheus(member); p != nil {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// NewSinkFromEnv build sink from METRICS_SINK, a comma separated list of
+// "prometheus" and "statsd" (address in STATSD_ADDR), default is no-op.
+// ENABLE_METRICS=true or METRICS_LOG_INTERVAL (for NewSnapshotLoggerFromEnv) add the
+// prometheus sink when it is not listed
+func NewSinkFromEnv() MetricsSink {
+	sinks := MultiSink{}
+	for _, name := range strings.Split(os.Getenv("METRICS_SINK"), ",") {
+		switch strings.TrimSpace(name) {
+		case "prometheus":
+			sinks = append(sinks, NewPrometheusSink())
+		case "statsd":
+			sink, err := NewStatsDSink(os.Getenv("STATSD_ADDR"), os.Getenv("STATSD_PREFIX"))
+			if err != nil {
+				log.Print(err)
+				continue
+			}
+			sinks = append(sinks, sink)
+		case "":
+		default:
+			log.Printf("unknown metrics sink %s", name)
+		}
+	}
+	if (os.Getenv("ENABLE_METRICS") == "true" || os.Getenv("METRICS_LOG_INTERVAL") != "") && Prometheus(sinks) == nil {
+		sinks = append(sinks, NewPrometheusSink())
+	}
+	switch len(sinks) {
+	case 0:
+		return NoopSink{}
+	case 1:
+		return sinks[0]
+	default:
+		return sinks
+	}
+}
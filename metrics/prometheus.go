@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// PrometheusSink keep metrics in a Prometheus registry, metric vectors are created
+// on first use with the tag names of that call
+type PrometheusSink struct {
+	registry *prometheus.Registry
+
+	mu         sync.Mutex
+	counters   map[string]*prometheus.CounterVec
+	gauges     map[string]*prometheus.GaugeVec
+	histograms map[string]*prometheus.HistogramVec
+}
+
+func NewPrometheusSink() *PrometheusSink {
+	return &PrometheusSink{
+		registry:   prometheus.NewRegistry(),
+		counters:   make(map[string]*prometheus.CounterVec),
+		gauges:     make(map[string]*prometheus.GaugeVec),
+		histograms: make(map[string]*prometheus.HistogramVec),
+	}
+}
+
+// Registry return the registry to be gathered
+func (p *PrometheusSink) Registry() *prometheus.Registry {
+	return p.registry
+}
+
+// Handler serve the registry in Prometheus text format
+func (p *PrometheusSink) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+}
+
+func labelNames(tags map[string]string) []string {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *PrometheusSink) counter(name string, tags map[string]string) *prometheus.CounterVec {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if vec, ok := p.counters[name]; ok {
+		return vec
+	}
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: name}, labelNames(tags))
+	if err := p.registry.Register(vec); err != nil {
+		log.Print(err)
+	}
+	p.counters[name] = vec
+	return vec
+}
+
+func (p *PrometheusSink) gauge(name string, tags map[string]string) *prometheus.GaugeVec {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if vec, ok := p.gauges[name]; ok {
+		return vec
+	}
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: name}, labelNames(tags))
+	if err := p.registry.Register(vec); err != nil {
+		log.Print(err)
+	}
+	p.gauges[name] = vec
+	return vec
+}
+
+func (p *PrometheusSink) histogram(name string, tags map[string]string) *prometheus.HistogramVec {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if vec, ok := p.histograms[name]; ok {
+		return vec
+	}
+	vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: name}, labelNames(tags))
+	if err := p.registry.Register(vec); err != nil {
+		log.Print(err)
+	}
+	p.histograms[name] = vec
+	return vec
+}
+
+func (p *PrometheusSink) Incr(name string, tags map[string]string) {
+	counter, err := p.counter(name, tags).GetMetricWith(tags)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	counter.Inc()
+}
+
+func (p *PrometheusSink) Gauge(name string, value float64, tags map[string]string) {
+	gauge, err := p.gauge(name, tags).GetMetricWith(tags)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	gauge.Set(value)
+}
+
+// Timing observe the duration in seconds
+func (p *PrometheusSink) Timing(name string, d time.Duration, tags map[string]string) {
+	histogram, err := p.histogram(name, tags).GetMetricWith(tags)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	histogram.Observe(d.Seconds())
+}
+
+// Snapshot current value of every series, keyed by name and labels in Prometheus text
+// format. Histograms report their sample count
+func (p *PrometheusSink) Snapshot() map[string]float64 {
+	families, err := p.registry.Gather()
+	if err != nil {
+		log.Print(err)
+	}
+	result := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := []string{}
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, fmt.Sprintf("%s=%q", label.GetName(), label.GetValue()))
+			}
+			key := family.GetName()
+			if len(labels) > 0 {
+				key += "{" + strings.Join(labels, ",") + "}"
+			}
+			switch {
+			case metric.Counter != nil:
+				result[key] = metric.GetCounter().GetValue()
+			case metric.Gauge != nil:
+				result[key] = metric.GetGauge().GetValue()
+			case metric.Histogram != nil:
+				result[key] = float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusSink(t *testing.T) {
+	sink := NewPrometheusSink()
+	sink.Incr("upstream_errors_total", map[string]string{"method": "eth_call", "category": "timeout"})
+	sink.Incr("upstream_errors_total", map[string]string{"category": "timeout", "method": "eth_call"})
+	sink.Incr("upstream_errors_total", map[string]string{"method": "eth_getBalance", "category": "5xx"})
+	sink.Incr("cache_hits_total", nil)
+	sink.Gauge("cache_age_seconds", 3, map[string]string{"method": "eth_blockNumber"})
+	sink.Timing("upstream_request_duration_seconds", 250*time.Millisecond, map[string]string{"method": "eth_call"})
+
+	server := httptest.NewServer(sink.Handler())
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	text := string(body)
+	assert.Contains(t, text, `upstream_errors_total{category="timeout",method="eth_call"} 2`)
+	assert.Contains(t, text, `upstream_errors_total{category="5xx",method="eth_getBalance"} 1`)
+	assert.Contains(t, text, "cache_hits_total 1")
+	assert.Contains(t, text, `cache_age_seconds{method="eth_blockNumber"} 3`)
+	assert.Contains(t, text, `upstream_request_duration_seconds_count{method="eth_call"} 1`)
+	assert.Contains(t, text, `upstream_request_duration_seconds_sum{method="eth_call"} 0.25`)
+}
+
+func TestPrometheusSinkLabelMismatch(t *testing.T) {
+	sink := NewPrometheusSink()
+	sink.Incr("cache_misses_total", map[string]string{"method": "eth_call"})
+	// the vector is created with the labels of the first call, other label sets are dropped
+	sink.Incr("cache_misses_total", map[string]string{"method": "eth_call", "step": "stale"})
+	sink.Incr("cache_misses_total", nil)
+	sink.Gauge("cache_age_seconds", 1, nil)
+	sink.Gauge("cache_age_seconds", 2, map[string]string{"method": "eth_call"})
+
+	assert.Equal(t, map[string]float64{
+		`cache_misses_total{method="eth_call"}`: 1,
+		"cache_age_seconds":                     1,
+	}, sink.Snapshot())
+}
+
+func TestSnapshot(t *testing.T) {
+	prometheus := NewPrometheusSink()
+	prometheus.Incr("cache_hits_total", map[string]string{"method": "eth_call"})
+	prometheus.Timing("upstream_request_duration_seconds", time.Second, nil)
+	prometheus.Timing("upstream_request_duration_seconds", time.Second, nil)
+
+	expected := map[string]float64{
+		`cache_hits_total{method="eth_call"}`: 1,
+		"upstream_request_duration_seconds":   2,
+	}
+	assert.Equal(t, expected, Snapshot(MultiSink{NoopSink{}, prometheus}))
+	assert.Equal(t, prometheus, Prometheus(MultiSink{NoopSink{}, prometheus}))
+	assert.Nil(t, Snapshot(NoopSink{}))
+}
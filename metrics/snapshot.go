@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KyberNetwork/cache/logger"
+)
+
+// SnapshotLogger log a summary of the metrics of a sink every interval, for deployments
+// without a metrics scraper. Values are read from the sink, the same ones served on /metrics
+type SnapshotLogger struct {
+	sink     MetricsSink
+	logger   logger.Logger
+	level    string             // info or error, the method of logger
+	previous map[string]float64 // snapshot of the last summary, counters are logged as deltas
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newSnapshotLogger(sink MetricsSink, l logger.Logger, level string) *SnapshotLogger {
+	return &SnapshotLogger{
+		sink:     sink,
+		logger:   l,
+		level:    level,
+		previous: Snapshot(sink),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// NewSnapshotLoggerFromEnv start logging a summary of sink to l every METRICS_LOG_INTERVAL
+// seconds at METRICS_LOG_LEVEL, info (default) or error. It is nil when the interval is not
+// set. sink should come from NewSinkFromEnv, which adds the prometheus sink the values are read from
+func NewSnapshotLoggerFromEnv(sink MetricsSink, l logger.Logger) (*SnapshotLogger, error) {
+	interval, err := strconv.Atoi(os.Getenv("METRICS_LOG_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return nil, nil
+	}
+	level := strings.ToLower(os.Getenv("METRICS_LOG_LEVEL"))
+	switch level {
+	case "":
+		level = "info"
+	case "info", "error":
+	default:
+		return nil, fmt.Errorf("unknown METRICS_LOG_LEVEL %q, must be info or error", level)
+	}
+	s := newSnapshotLogger(sink, l, level)
+	go s.logLoop(time.Duration(interval) * time.Second)
+	return s, nil
+}
+
+// Close stop logging, the loop has returned when it returns
+func (s *SnapshotLogger) Close() {
+	close(s.stop)
+	<-s.done
+}
+
+// logLoop log a summary every interval until Close
+func (s *SnapshotLogger) logLoop(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		if s.level == "error" {
+			s.logger.Error("metrics snapshot", s.summary(interval))
+		} else {
+			s.logger.Info("metrics snapshot", s.summary(interval))
+		}
+	}
+}
+
+// splitKey split a snapshot key, e.g. cache_age_seconds{method="eth_call"}, into name and labels
+func splitKey(key string) (string, map[string]string) {
+	open := strings.IndexByte(key, '{')
+	if open < 0 || !strings.HasSuffix(key, "}") {
+		return key, nil
+	}
+	labels := make(map[string]string)
+	rest := key[open+1 : len(key)-1]
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		name := rest[:eq]
+		rest = rest[eq+1:]
+		// the value is quoted with escapes, it ends at the first unescaped quote
+		end := 1
+		for end < len(rest) && (rest[end] != '"' || rest[end-1] == '\\') {
+			end++
+		}
+		if end >= len(rest) {
+			break
+		}
+		labels[name], _ = strconv.Unquote(rest[:end+1])
+		rest = strings.TrimPrefix(rest[end+1:], ",")
+	}
+	return key[:open], labels
+}
+
+// summary metrics since the last summary, counters and timings are summed over their labels,
+// staleness is the age in seconds of each cached method
+func (s *SnapshotLogger) summary(interval time.Duration) logger.Fields {
+	current := Snapshot(s.sink)
+	totals := make(map[string]float64)
+	staleness := make(map[string]float64)
+	for key, value := range current {
+		name, labels := splitKey(key)
+		if name == "cache_age_seconds" {
+			staleness[labels["method"]] = math.Round(value)
+			continue
+		}
+		totals[name] += value - s.previous[key]
+	}
+	s.previous = current
+
+	hits, misses := totals["cache_hits_total"], totals["cache_misses_total"]
+	hitRatio := 0.0
+	if hits+misses > 0 {
+		hitRatio = hits / (hits + misses)
+	}
+	upstreamRate := totals["upstream_request_duration_seconds"] / interval.Seconds()
+	return logger.Fields{
+		"hitRatio":               math.Round(hitRatio*1000) / 1000,
+		"requests":               hits + misses,
+		"upstreamCallsPerSecond": math.Round(upstreamRate*100) / 100,
+		"upstreamErrors":         totals["upstream_errors_total"],
+		"staleness":              staleness,
+	}
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KyberNetwork/cache/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitKey(t *testing.T) {
+	name, labels := splitKey(`upstream_errors_total{category="timeout",method="eth_call"}`)
+	assert.Equal(t, "upstream_errors_total", name)
+	assert.Equal(t, map[string]string{"category": "timeout", "method": "eth_call"}, labels)
+
+	name, labels = splitKey(`cache_age_seconds{method="a\"b,c"}`)
+	assert.Equal(t, "cache_age_seconds", name)
+	assert.Equal(t, map[string]string{"method": `a"b,c`}, labels)
+
+	name, labels = splitKey("cache_hits_total")
+	assert.Equal(t, "cache_hits_total", name)
+	assert.Nil(t, labels)
+}
+
+func TestSnapshotLoggerSummary(t *testing.T) {
+	sink := NewPrometheusSink()
+	// recorded before the logger starts, not part of the first summary
+	sink.Incr("cache_hits_total", map[string]string{"method": "eth_call"})
+	s := newSnapshotLogger(MultiSink{NoopSink{}, sink}, logger.Default(), "info")
+
+	for i := 0; i < 2; i++ {
+		sink.Incr("cache_hits_total", map[string]string{"method": "eth_call"})
+		sink.Incr("cache_hits_total", map[string]string{"method": "eth_gasPrice"})
+	}
+	sink.Incr("cache_hits_total", map[string]string{"method": "eth_gasPrice"})
+	sink.Incr("cache_misses_total", map[string]string{"method": "eth_call"})
+	sink.Incr("upstream_errors_total", map[string]string{"method": "eth_call", "category": "timeout"})
+	sink.Timing("upstream_request_duration_seconds", time.Millisecond, map[string]string{"method": "eth_call"})
+	sink.Timing("upstream_request_duration_seconds", time.Millisecond, map[string]string{"method": "eth_gasPrice"})
+	sink.Gauge("cache_age_seconds", 7, map[string]string{"method": "eth_gasPrice"})
+	sink.Gauge("cache_age_seconds", 2, map[string]string{"method": "eth_blockNumber"})
+
+	staleness := map[string]float64{"eth_blockNumber": 2, "eth_gasPrice": 7}
+	assert.Equal(t, logger.Fields{
+		"hitRatio": 0.833, "requests": 6.0, "upstreamCallsPerSecond": 1.0, "upstreamErrors": 1.0, "staleness": staleness,
+	}, s.summary(2*time.Second))
+
+	// counters are reset by each summary, gauges are not
+	sink.Incr("cache_misses_total", map[string]string{"method": "eth_call"})
+	assert.Equal(t, logger.Fields{
+		"hitRatio": 0.0, "requests": 1.0, "upstreamCallsPerSecond": 0.0, "upstreamErrors": 0.0, "staleness": staleness,
+	}, s.summary(2*time.Second))
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSnapshotLoggerFromEnv(t *testing.T) {
+	os.Unsetenv("METRICS_LOG_INTERVAL")
+	s, err := NewSnapshotLoggerFromEnv(NewSinkFromEnv(), logger.Default())
+	assert.Nil(t, err)
+	assert.Nil(t, s)
+
+	os.Setenv("METRICS_LOG_INTERVAL", "1")
+	defer os.Unsetenv("METRICS_LOG_INTERVAL")
+	os.Setenv("METRICS_LOG_LEVEL", "debug")
+	defer os.Unsetenv("METRICS_LOG_LEVEL")
+	_, err = NewSnapshotLoggerFromEnv(NewSinkFromEnv(), logger.Default())
+	assert.NotNil(t, err)
+
+	// the summary is read from the prometheus sink added for it
+	os.Setenv("METRICS_LOG_LEVEL", "ERROR")
+	var out syncBuffer
+	sink := NewSinkFromEnv()
+	assert.NotNil(t, Prometheus(sink))
+	s, err = NewSnapshotLoggerFromEnv(sink, logger.NewJSONLogger(&out))
+	assert.Nil(t, err)
+	assert.NotNil(t, s)
+	sink.Incr("cache_hits_total", map[string]string{"method": "eth_call"})
+
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), `"hitRatio":1`) && strings.Contains(out.String(), `"requests":1`)
+	}, 3*time.Second, 50*time.Millisecond)
+	assert.Contains(t, out.String(), `"level":"error"`)
+	assert.Contains(t, out.String(), `"msg":"metrics snapshot"`)
+
+	done := make(chan struct{})
+	go func() {
+		s.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not stop the log loop")
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultStatsDAddr = "127.0.0.1:8125"
+
+var (
+	// nameReplacer replace characters a name or tag key can not hold in a DogStatsD line
+	nameReplacer = strings.NewReplacer(":", "_", "|", "_", ",", "_", "#", "_", "\n", "_")
+	// valueReplacer tag values may contain ':' since only the first one split key and value
+	valueReplacer = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_")
+)
+
+// StatsDSink send metrics to StatsD over UDP, tags use the DogStatsD format
+type StatsDSink struct {
+	conn   net.Conn
+	prefix string
+}
+
+func NewStatsDSink(addr string, prefix string) (*StatsDSink, error) {
+	if addr == "" {
+		addr = defaultStatsDAddr
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsDSink{conn: conn, prefix: prefix}, nil
+}
+
+func (s *StatsDSink) Incr(name string, tags map[string]string) {
+	s.send(name, "1", "c", tags)
+}
+
+func (s *StatsDSink) Gauge(name string, value float64, tags map[string]string) {
+	s.send(name, fmt.Sprintf("%g", value), "g", tags)
+}
+
+func (s *StatsDSink) Timing(name string, d time.Duration, tags map[string]string) {
+	s.send(name, fmt.Sprintf("%d", d.Nanoseconds()/int64(time.Millisecond)), "ms", tags)
+}
+
+func (s *StatsDSink) send(name string, value string, metricType string, tags map[string]string) {
+	var b strings.Builder
+	b.WriteString(s.prefix)
+	b.WriteString(nameReplacer.Replace(name))
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(metricType)
+	if len(tags) > 0 {
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteString("|#")
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(nameReplacer.Replace(k))
+			b.WriteByte(':')
+			b.WriteString(valueReplacer.Replace(tags[k]))
+		}
+	}
+	// UDP write does not wait for the server, errors are dropped like any lost packet
+	s.conn.Write([]byte(b.String()))
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsDSink(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer server.Close()
+
+	sink, err := NewStatsDSink(server.LocalAddr().String(), "cache.")
+	assert.NoError(t, err)
+
+	read := func() string {
+		buf := make([]byte, 1024)
+		assert.NoError(t, server.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := server.ReadFrom(buf)
+		assert.NoError(t, err)
+		return string(buf[:n])
+	}
+
+	sink.Incr("upstream_errors_total", map[string]string{"method": "eth_call", "category": "timeout"})
+	assert.Equal(t, "cache.upstream_errors_total:1|c|#category:timeout,method:eth_call", read())
+
+	sink.Incr("cache_hits_total", nil)
+	assert.Equal(t, "cache.cache_hits_total:1|c", read())
+
+	sink.Gauge("cache_age_seconds", 1.5, map[string]string{"method": "eth_blockNumber"})
+	assert.Equal(t, "cache.cache_age_seconds:1.5|g|#method:eth_blockNumber", read())
+
+	sink.Timing("upstream_request_duration_seconds", 250*time.Millisecond, map[string]string{"method": "eth_call"})
+	assert.Equal(t, "cache.upstream_request_duration_seconds:250|ms|#method:eth_call", read())
+}
+
+func TestStatsDSinkTagEncoding(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer server.Close()
+
+	sink, err := NewStatsDSink(server.LocalAddr().String(), "")
+	assert.NoError(t, err)
+
+	sink.Incr("a:b|c", map[string]string{"end:point": "http://node:8545", "step": "x,y|z#w"})
+	buf := make([]byte, 1024)
+	assert.NoError(t, server.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := server.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "a_b_c:1|c|#end_point:http://node:8545,step:x_y_z_w", string(buf[:n]))
+}
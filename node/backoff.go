@@ -0,0 +1,47 @@
+package node
+
+import (
+	"math/rand"
+	"time"
+)
+
+const defaultRetryBackoff = time.Second
+
+// retryBackoff delay before retrying a failed refresh, doubled on each consecutive failure
+// from min up to max, the interval of the method. A random jitter keeps workers of
+// methods which failed together from retrying together
+type retryBackoff struct {
+	min      time.Duration
+	max      time.Duration
+	failures int
+}
+
+func newRetryBackoff(min, max time.Duration) *retryBackoff {
+	if min > max {
+		min = max
+	}
+	return &retryBackoff{min: min, max: max}
+}
+
+// next record a failure and return the delay before the next attempt, between half
+// and all of the current backoff
+func (b *retryBackoff) next() time.Duration {
+	d := b.min
+	for i := 0; i < b.failures && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+	b.failures++
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// reset back to the interval after a success
+func (b *retryBackoff) reset() {
+	b.failures = 0
+}
@@ -0,0 +1,128 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// CacheStatusPartial some members of a JSON-RPC batch were served from cache
+const CacheStatusPartial = "PARTIAL"
+
+// handleBatch serve members of a JSON-RPC batch from cache, the others are sent to node
+// in a single batch and responses are put back in request order by id.
+// Members node answers with an id which is not in the request are appended at the end
+func (nc *NodeCache) handleBatch(req *http.Request, body []byte, batch []json.RawMessage) (*ProxyResponse, error) {
+	responses := make([]json.RawMessage, len(batch))
+	missed := []int{}
+	for _, raw := range batch {
+		if err := validateMessage(raw); err != nil {
+			return nil, err
+		}
+	}
+	for i, raw := range batch {
+		message := JSONRPCMessage{}
+		if err := json.Unmarshal(raw, &message); err != nil {
+			missed = append(missed, i)
+			continue
+		}
+		if message.Version != jsonRPCVersion && nc.versionMode == VersionModeStrict {
+			return nil, ErrInvalidVersion
+		}
+		lookup := message
+		lookup.Params = nc.canonicalParams(message.Method, message.Params)
+		resp, err := nc.getCachedResponse(lookup)
+		if err != nil {
+			nc.metrics.Incr("cache_misses_total", map[string]string{"method": nc.metricMethod(message.Method)})
+			if nc.audit != nil {
+				nc.audit.Record(message.Method, lookup.Params)
+			}
+			missed = append(missed, i)
+			continue
+		}
+		if resp.CacheStatus == CacheStatusStale {
+			nc.revalidate(lookup)
+		}
+		nc.checkStaleSLO(message.Method, resp)
+		nc.metrics.Incr("cache_hits_total", map[string]string{"method": nc.metricMethod(message.Method)})
+		if message.Version != jsonRPCVersion {
+			resp.Body = withJSONRPCVersion(resp.Body, message.Version)
+		}
+		responses[i] = resp.Body
+	}
+
+	// nothing to reassemble, node answers the whole batch
+	if len(missed) == len(batch) {
+		return nc.proxy(req, body, JSONRPCMessage{})
+	}
+
+	upstream := []json.RawMessage{}
+	if len(missed) > 0 {
+		proxied := make([]json.RawMessage, 0, len(missed))
+		for _, i := range missed {
+			proxied = append(proxied, batch[i])
+		}
+		proxyBody, err := json.Marshal(proxied)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := nc.proxy(req, proxyBody, JSONRPCMessage{})
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(resp.Body, &upstream); err != nil {
+			return nil, &UpstreamError{category: CategoryBadResponse, err: err}
+		}
+	}
+
+	// pair responses of node with missed members by id, the first unused response wins
+	used := make([]bool, len(upstream))
+	byID := make(map[int][]int)
+	for j, raw := range upstream {
+		if id, ok := batchMemberID(raw); ok {
+			byID[id] = append(byID[id], j)
+		}
+	}
+	for _, i := range missed {
+		id, ok := batchMemberID(batch[i])
+		if !ok || len(byID[id]) == 0 {
+			continue
+		}
+		j := byID[id][0]
+		byID[id] = byID[id][1:]
+		responses[i] = upstream[j]
+		used[j] = true
+	}
+
+	result := make([]json.RawMessage, 0, len(batch))
+	for _, resp := range responses {
+		if resp != nil {
+			result = append(result, resp)
+		}
+	}
+	for j, resp := range upstream {
+		if !used[j] {
+			result = append(result, resp)
+		}
+	}
+	resultBody, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	status := CacheStatusHit
+	if len(missed) > 0 {
+		status = CacheStatusPartial
+	}
+	return &ProxyResponse{Body: resultBody, Cached: len(missed) == 0, CacheStatus: status}, nil
+}
+
+// batchMemberID numeric id of a batch member, false when there is none
+func batchMemberID(raw json.RawMessage) (int, bool) {
+	member := struct {
+		ID *int `json:"id"`
+	}{}
+	if err := json.Unmarshal(raw, &member); err != nil || member.ID == nil {
+		return 0, false
+	}
+	return *member.ID, true
+}
@@ -0,0 +1,147 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/KyberNetwork/cache/logger"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	defaultBlockNumberInterval = 5 * time.Second
+	defaultReorgPurgeDepth     = 12
+)
+
+// blockNumberWorker keep track of the latest block number of node, it is used
+// to tell which block a cached response corresponds to
+func (nc *NodeCache) blockNumberWorker(interval time.Duration) {
+	defer nc.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := nc.refreshBlockNumber(); err != nil {
+			nc.logger.Error("refreshing latest block failed", logger.Fields{"error": err})
+		}
+		if !nc.sleep(ticker) {
+			return
+		}
+	}
+}
+
+// blockHead latest block as returned by eth_getBlockByNumber
+type blockHead struct {
+	Number     hexutil.Uint64 `json:"number"`
+	Hash       string         `json:"hash"`
+	ParentHash string         `json:"parentHash"`
+}
+
+func (nc *NodeCache) refreshBlockNumber() error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "eth_getBlockByNumber",
+		"params":  []interface{}{"latest", false},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", nc.endpoints.primary(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := nc.fetchRequest("eth_getBlockByNumber", req)
+	if err != nil {
+		return err
+	}
+	result := struct {
+		Result *blockHead `json:"result"`
+	}{}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return err
+	}
+	if result.Result == nil {
+		return errors.New("latest block is not available")
+	}
+	head := result.Result
+	blockNumber := uint64(head.Number)
+
+	if nc.isReorg(head) {
+		purged := nc.purgeRecentEntries(blockNumber)
+		nc.logger.Info("chain reorg detected, purged cached responses", logger.Fields{"block": blockNumber, "purged": purged})
+		nc.metrics.Incr("chain_reorgs_total", nil)
+	}
+	nc.rememberBlock(head)
+	atomic.StoreUint64(&nc.latestBlock, blockNumber)
+	return nil
+}
+
+// isReorg check if the new head is lower than the previous one, or does not
+// match the recorded hashes of its height and its parent
+func (nc *NodeCache) isReorg(head *blockHead) bool {
+	number := uint64(head.Number)
+	if previous := nc.LatestBlock(); previous > 0 && number < previous {
+		return true
+	}
+	if hash, ok := nc.recentBlocks[number]; ok && hash != head.Hash {
+		return true
+	}
+	if hash, ok := nc.recentBlocks[number-1]; ok && number > 0 && hash != head.ParentHash {
+		return true
+	}
+	return false
+}
+
+// rememberBlock record hash of the new head, blocks above it are orphaned and
+// blocks deeper than purge depth are forgotten
+func (nc *NodeCache) rememberBlock(head *blockHead) {
+	number := uint64(head.Number)
+	for n := range nc.recentBlocks {
+		if n > number || n+nc.purgeDepth < number {
+			delete(nc.recentBlocks, n)
+		}
+	}
+	nc.recentBlocks[number] = head.Hash
+	if number > 0 && head.ParentHash != "" {
+		nc.recentBlocks[number-1] = head.ParentHash
+	}
+}
+
+// purgeRecentEntries remove cached responses fetched within purge depth of block number,
+// return number of removed entries
+func (nc *NodeCache) purgeRecentEntries(blockNumber uint64) int {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	purged := 0
+	for key, entry := range nc.cacheResponse {
+		if entry.blockNumber > 0 && entry.blockNumber+nc.purgeDepth > blockNumber {
+			delete(nc.cacheResponse, key)
+			purged++
+		}
+	}
+	return purged
+}
+
+// LatestBlock Get latest block number known by the cache, 0 if unknown
+func (nc *NodeCache) LatestBlock() uint64 {
+	return atomic.LoadUint64(&nc.latestBlock)
+}
+
+// isLatestTagged check if params refer to the latest state, either by a block
+// tag or by not specifying a block at all
+func isLatestTagged(params []json.RawMessage) bool {
+	if len(params) == 0 {
+		return true
+	}
+	for _, param := range params {
+		tag := ""
+		if json.Unmarshal(param, &tag) == nil && (tag == "latest" || tag == "pending") {
+			return true
+		}
+	}
+	return false
+}
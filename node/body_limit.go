@@ -0,0 +1,47 @@
+package node
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+const (
+	defaultMaxRequestBytes  = 4 << 20  // 4MB
+	defaultMaxResponseBytes = 16 << 20 // 16MB, over the size thresholds of big methods
+)
+
+var (
+	// ErrRequestTooLarge returned when a client request body is over MAX_REQUEST_BYTES
+	ErrRequestTooLarge = errors.New("request body is too large")
+	// ErrResponseTooLarge returned when a node response is over MAX_RESPONSE_BYTES,
+	// reading stops at the limit
+	ErrResponseTooLarge = errors.New("node response is too large")
+)
+
+// bodyLimitsFromEnv read MAX_REQUEST_BYTES and MAX_RESPONSE_BYTES
+func bodyLimitsFromEnv() (int64, int64) {
+	maxRequestBytes := int64(defaultMaxRequestBytes)
+	if limit, err := strconv.ParseInt(os.Getenv("MAX_REQUEST_BYTES"), 10, 64); err == nil && limit > 0 {
+		maxRequestBytes = limit
+	}
+	maxResponseBytes := int64(defaultMaxResponseBytes)
+	if limit, err := strconv.ParseInt(os.Getenv("MAX_RESPONSE_BYTES"), 10, 64); err == nil && limit > 0 {
+		maxResponseBytes = limit
+	}
+	return maxRequestBytes, maxResponseBytes
+}
+
+// readLimited read r up to limit bytes, false when there was more
+func readLimited(r io.Reader, limit int64) ([]byte, bool, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(data)) > limit {
+		return nil, false, nil
+	}
+	return data, true, nil
+}
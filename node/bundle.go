@@ -0,0 +1,93 @@
+package node
+
+import (
+	"time"
+
+	"github.com/KyberNetwork/cache/metrics"
+)
+
+// MethodStatus config and cache state of a cached method
+type MethodStatus struct {
+	Method          string `json:"method"`
+	IntervalSeconds int64  `json:"intervalSeconds"`
+	Cached          bool   `json:"cached"`
+	CacheStatus     string `json:"cacheStatus"`
+	AgeSeconds      int64  `json:"ageSeconds"`
+	Fallback        string `json:"fallback,omitempty"`
+	StaleSLOSeconds int64  `json:"staleSLOSeconds,omitempty"`
+	MaxStaleSeconds int64  `json:"maxStaleSeconds"`
+}
+
+// CacheConfig node cache settings which are not per method
+type CacheConfig struct {
+	KeyHash            string `json:"keyHash"`
+	VersionMode        string `json:"versionMode"`
+	MaxBatchSize       int    `json:"maxBatchSize"`
+	ReorgPurgeDepth    uint64 `json:"reorgPurgeDepth"`
+	RequestCompression bool   `json:"requestCompression"`
+	ResponseCheck      string `json:"responseCheck"`
+	ProxyAudit         bool   `json:"proxyAudit"`
+}
+
+// DiagnosticsBundle everything support needs about the node cache in one document
+type DiagnosticsBundle struct {
+	GeneratedAt    time.Time            `json:"generatedAt"`
+	Config         CacheConfig          `json:"config"`
+	LatestBlock    uint64               `json:"latestBlock"`
+	Methods        []MethodStatus       `json:"methods"`
+	Warmup         WarmupProgress       `json:"warmup"`
+	UpstreamErrors []UpstreamErrorEntry `json:"upstreamErrors"`
+	NodeInfo       NodeInfo             `json:"nodeInfo"`
+	Metrics        map[string]float64   `json:"metrics"`
+}
+
+func (nc *NodeCache) methodStatus(method string) MethodStatus {
+	status := MethodStatus{
+		Method:          method,
+		IntervalSeconds: int64(nc.interval(method) / time.Second),
+		CacheStatus:     CacheStatusMiss,
+	}
+	if chain, ok := nc.fallbacks[method]; ok {
+		status.Fallback = chain.String()
+	}
+	if slo, ok := nc.staleSLOs[method]; ok {
+		status.StaleSLOSeconds = int64(slo / time.Second)
+	}
+	maxStale, ok := nc.maxStaleAges[method]
+	if !ok {
+		maxStale = nc.defaultMaxStaleAge
+	}
+	status.MaxStaleSeconds = int64(maxStale / time.Second)
+	if resp, err := nc.getCachedResponse(JSONRPCMessage{Method: method}); err == nil {
+		status.Cached = true
+		status.CacheStatus = resp.CacheStatus
+		status.AgeSeconds = int64(resp.Age / time.Second)
+	}
+	return status
+}
+
+// Bundle collect config, cache state, recent upstream errors and metrics, node is not called
+func (nc *NodeCache) Bundle() DiagnosticsBundle {
+	methods := []MethodStatus{}
+	for _, config := range nc.methods {
+		methods = append(methods, nc.methodStatus(config.method))
+	}
+	return DiagnosticsBundle{
+		GeneratedAt: time.Now().UTC(),
+		Config: CacheConfig{
+			KeyHash:            nc.keyHashName,
+			VersionMode:        nc.versionMode,
+			MaxBatchSize:       nc.maxBatchSize,
+			ReorgPurgeDepth:    nc.purgeDepth,
+			RequestCompression: nc.requestCompression != nil,
+			ResponseCheck:      nc.responseCheck,
+			ProxyAudit:         nc.audit != nil,
+		},
+		LatestBlock:    nc.LatestBlock(),
+		Methods:        methods,
+		Warmup:         nc.WarmupProgress(),
+		UpstreamErrors: nc.upstreamErrors.recent(),
+		NodeInfo:       nc.cachedNodeInfo(),
+		Metrics:        metrics.Snapshot(nc.metrics),
+	}
+}
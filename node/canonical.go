@@ -0,0 +1,200 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/KyberNetwork/cache/logger"
+)
+
+// paramCanonicalizer normalize a param, in JSON, to its canonical form
+type paramCanonicalizer func(param json.RawMessage) json.RawMessage
+
+// builtin canonicalizers, can be referred by name in PARAM_CANONICALIZERS
+var paramCanonicalizers = map[string]paramCanonicalizer{
+	"raw":      func(param json.RawMessage) json.RawMessage { return param },
+	"quantity": stringParam(canonicalQuantity),
+	"address":  stringParam(canonicalData),
+	"data":     stringParam(canonicalData),
+	"block":    canonicalBlockParam,
+	"bool":     canonicalBool,
+	"call":     canonicalCall,
+}
+
+// callQuantityFields fields of a call object which are hex quantities
+var callQuantityFields = map[string]bool{
+	"gas": true, "gasPrice": true, "maxFeePerGas": true, "maxPriorityFeePerGas": true, "value": true, "nonce": true,
+}
+
+// defaultMethodCanonicalizers canonicalizers of params by position for common methods
+var defaultMethodCanonicalizers = map[string]string{
+	"eth_getBalance":                          "address|block",
+	"eth_getCode":                             "address|block",
+	"eth_getTransactionCount":                 "address|block",
+	"eth_getStorageAt":                        "address|quantity|block",
+	"eth_getBlockByNumber":                    "block|bool",
+	"eth_getBlockByHash":                      "data|bool",
+	"eth_getBlockTransactionCountByNumber":    "block",
+	"eth_getTransactionByHash":                "data",
+	"eth_getTransactionReceipt":               "data",
+	"eth_getTransactionByBlockNumberAndIndex": "block|quantity",
+	"eth_call":                                "call|block",
+	"eth_estimateGas":                         "call|block",
+}
+
+// stringParam canonicalize string params with canonicalize, other values are kept as is
+func stringParam(canonicalize func(string) string) paramCanonicalizer {
+	return func(param json.RawMessage) json.RawMessage {
+		value := ""
+		if err := json.Unmarshal(param, &value); err != nil {
+			return param
+		}
+		result, err := json.Marshal(canonicalize(value))
+		if err != nil {
+			return param
+		}
+		return result
+	}
+}
+
+// canonicalQuantity strip leading zeros of a hex quantity, 0x00 becomes 0x0
+func canonicalQuantity(param string) string {
+	lower := strings.ToLower(param)
+	if !strings.HasPrefix(lower, "0x") {
+		return param
+	}
+	digits := strings.TrimLeft(lower[2:], "0")
+	if digits == "" {
+		digits = "0"
+	}
+	return "0x" + digits
+}
+
+// canonicalData lowercase hex data such as addresses and hashes, so checksummed
+// and lowercase forms are the same
+func canonicalData(param string) string {
+	if strings.HasPrefix(param, "0x") || strings.HasPrefix(param, "0X") {
+		return strings.ToLower(param)
+	}
+	return param
+}
+
+// canonicalBlock lowercase block tags, block numbers are hex quantities
+func canonicalBlock(param string) string {
+	lower := strings.ToLower(param)
+	switch lower {
+	case "latest", "pending", "earliest", "safe", "finalized":
+		return lower
+	}
+	return canonicalQuantity(param)
+}
+
+// canonicalBlockParam canonicalize a block tag or number, or the fields of an EIP-1898
+// block object such as {"blockHash":"0x..."}
+func canonicalBlockParam(param json.RawMessage) json.RawMessage {
+	if isJSONObject(param) {
+		return canonicalObject(param, func(string) func(string) string { return canonicalBlock })
+	}
+	return stringParam(canonicalBlock)(param)
+}
+
+// canonicalBool booleans are kept, strings and numbers meaning a boolean become one
+func canonicalBool(param json.RawMessage) json.RawMessage {
+	value := ""
+	if err := json.Unmarshal(param, &value); err != nil {
+		value = string(param)
+	}
+	switch strings.ToLower(value) {
+	case "true", "1", "0x1":
+		return json.RawMessage("true")
+	case "false", "0", "0x0":
+		return json.RawMessage("false")
+	}
+	return param
+}
+
+// canonicalCall canonicalize a call object of eth_call, fields are sorted and hex values
+// lowercased, quantities lose their leading zeros
+func canonicalCall(param json.RawMessage) json.RawMessage {
+	return canonicalObject(param, func(field string) func(string) string {
+		if callQuantityFields[field] {
+			return canonicalQuantity
+		}
+		return canonicalData
+	})
+}
+
+// canonicalObject canonicalize string fields of a JSON object with the function returned by
+// canonicalizer for the field, and encode it with sorted fields. Other values are kept as is
+func canonicalObject(param json.RawMessage, canonicalizer func(field string) func(string) string) json.RawMessage {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(param, &fields); err != nil {
+		return param
+	}
+	for field, value := range fields {
+		fields[field] = stringParam(canonicalizer(field))(value)
+	}
+	result, err := json.Marshal(fields)
+	if err != nil {
+		return param
+	}
+	return result
+}
+
+// isJSONObject tell if a JSON value is an object
+func isJSONObject(value json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(value)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// parseCanonicalizers parse canonicalizers of params by position, in form of "address|block"
+func parseCanonicalizers(value string, l logger.Logger) []paramCanonicalizer {
+	result := []paramCanonicalizer{}
+	for _, name := range strings.Split(value, "|") {
+		canonicalizer, ok := paramCanonicalizers[strings.TrimSpace(name)]
+		if !ok {
+			l.Error("unknown param canonicalizer, param is kept as is", logger.Fields{"canonicalizer": name, "value": value})
+			canonicalizer = paramCanonicalizers["raw"]
+		}
+		result = append(result, canonicalizer)
+	}
+	return result
+}
+
+// canonicalizersFromEnv builtin method canonicalizers overridden by PARAM_CANONICALIZERS
+func canonicalizersFromEnv(l logger.Logger) map[string][]paramCanonicalizer {
+	config := make(map[string]string)
+	for method, value := range defaultMethodCanonicalizers {
+		config[method] = value
+	}
+	for method, value := range parseMethodConfig(os.Getenv("PARAM_CANONICALIZERS")) {
+		config[method] = value
+	}
+	result := make(map[string][]paramCanonicalizer)
+	for method, value := range config {
+		result[method] = parseCanonicalizers(value, l)
+	}
+	return result
+}
+
+// canonicalParams return params of method in canonical form, params without a
+// canonicalizer are kept as is. Empty, null and missing params are all nil
+func (nc *NodeCache) canonicalParams(method string, params []json.RawMessage) []json.RawMessage {
+	if len(params) == 0 {
+		return nil
+	}
+	canonicalizers, ok := nc.canonicalizers[method]
+	if !ok {
+		return params
+	}
+	result := make([]json.RawMessage, len(params))
+	for i, param := range params {
+		if i < len(canonicalizers) {
+			param = canonicalizers[i](param)
+		}
+		result[i] = param
+	}
+	return result
+}
@@ -0,0 +1,133 @@
+package node
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultCircuitBreakerCooldown = 30 * time.Second
+
+// states of the circuit breaker
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+	// CircuitDisabled CIRCUIT_BREAKER_THRESHOLD is not set
+	CircuitDisabled = "disabled"
+)
+
+// ErrCircuitOpen returned without calling node while the circuit breaker is open
+var ErrCircuitOpen = errors.New("node is unavailable, circuit breaker is open")
+
+// circuitBreaker stop calling node after threshold consecutive failures. Calls fail fast
+// for the cooldown, then a single call is let through to test node: the circuit closes
+// when it succeeds and opens again when it fails. Disabled when nil
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     string
+	openedAt  time.Time
+	probing   bool // a half-open call is in flight
+}
+
+// newCircuitBreakerFromEnv read CIRCUIT_BREAKER_THRESHOLD (consecutive failures) and
+// CIRCUIT_BREAKER_COOLDOWN (seconds, default 30)
+func newCircuitBreakerFromEnv() *circuitBreaker {
+	threshold, err := strconv.Atoi(os.Getenv("CIRCUIT_BREAKER_THRESHOLD"))
+	if err != nil || threshold <= 0 {
+		return nil
+	}
+	cooldown := defaultCircuitBreakerCooldown
+	if seconds, err := strconv.Atoi(os.Getenv("CIRCUIT_BREAKER_COOLDOWN")); err == nil && seconds > 0 {
+		cooldown = time.Duration(seconds) * time.Second
+	}
+	return newCircuitBreaker(threshold, cooldown)
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, state: CircuitClosed}
+}
+
+// allow tell if node may be called, the caller must report the result with done
+func (b *circuitBreaker) allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// done record the result of an allowed call, a call which neither succeeded nor
+// failed, e.g. cancelled by the client, only ends the probe. Return true when the
+// circuit opens
+func (b *circuitBreaker) done(now time.Time, success, failure bool) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	probe := b.state == CircuitHalfOpen
+	if probe {
+		b.probing = false
+	}
+	switch {
+	case success:
+		b.failures = 0
+		b.state = CircuitClosed
+	case failure:
+		b.failures++
+		if b.state != CircuitOpen && (probe || b.failures >= b.threshold) {
+			b.state = CircuitOpen
+			b.openedAt = now
+			return true
+		}
+	}
+	return false
+}
+
+// State current state, CircuitDisabled when there is no breaker
+func (b *circuitBreaker) State() string {
+	if b == nil {
+		return CircuitDisabled
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// retryAfter time until an open circuit lets a call through, 0 otherwise
+func (b *circuitBreaker) retryAfter(now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != CircuitOpen {
+		return 0
+	}
+	if wait := b.cooldown - now.Sub(b.openedAt); wait > 0 {
+		return wait
+	}
+	return 0
+}
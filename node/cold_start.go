@@ -0,0 +1,61 @@
+package node
+
+import (
+	"errors"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultColdStartRate = 5
+
+// ErrColdStartThrottled returned when a call to node is dropped during the cold-start window
+var ErrColdStartThrottled = errors.New("node calls are throttled during cold start")
+
+// coldStartThrottle limit proxied calls to node until warm-up completes or the window ends,
+// while the node also serves warm-up calls. Disabled when nil
+type coldStartThrottle struct {
+	mu     sync.Mutex
+	until  time.Time
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newColdStartThrottleFromEnv read COLD_START_WINDOW (seconds) and COLD_START_PROXY_RATE
+// (calls per second, default 5)
+func newColdStartThrottleFromEnv(now time.Time) *coldStartThrottle {
+	window, err := strconv.Atoi(os.Getenv("COLD_START_WINDOW"))
+	if err != nil || window <= 0 {
+		return nil
+	}
+	rate := float64(defaultColdStartRate)
+	if value, err := strconv.ParseFloat(os.Getenv("COLD_START_PROXY_RATE"), 64); err == nil && value > 0 {
+		rate = value
+	}
+	return &coldStartThrottle{
+		until:  now.Add(time.Duration(window) * time.Second),
+		rate:   rate,
+		tokens: rate,
+		last:   now,
+	}
+}
+
+// allow take a token while the window is open and the cache is not warm
+func (t *coldStartThrottle) allow(now time.Time, warm bool) bool {
+	if t == nil || warm || !now.Before(t.until) {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// burst is one second of calls
+	t.tokens = math.Min(t.rate, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+	t.last = now
+	if t.tokens < 1 {
+		return false
+	}
+	t.tokens--
+	return true
+}
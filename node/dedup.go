@@ -0,0 +1,68 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// dedupKey key of identical calls sharing one call to node: the cache key of message and
+// the client headers sent on to node, so clients with other credentials never share
+func (nc *NodeCache) dedupKey(req *http.Request, message JSONRPCMessage) string {
+	key := cacheKey(message)
+	for _, header := range nc.forwardHeaders {
+		if values, ok := req.Header[header]; ok {
+			key += "\n" + header + ": " + strings.Join(values, ",")
+		}
+	}
+	return key
+}
+
+// callShared send proxyReq to node, concurrent identical calls wait for the one in flight
+// and get its response with their own id. When the client of the shared call went away,
+// the others call node themselves
+func (nc *NodeCache) callShared(req *http.Request, body []byte, message JSONRPCMessage, proxyReq *http.Request) ([]byte, error) {
+	envelope := struct {
+		ID json.RawMessage `json:"id"`
+	}{}
+	if message.Method == "" || json.Unmarshal(body, &envelope) != nil {
+		return nc.callMethod(req.Context(), message.Method, proxyReq)
+	}
+
+	ctx := req.Context()
+	leader := false
+	result := nc.inFlight.DoChan(nc.dedupKey(req, message), func() (interface{}, error) {
+		leader = true
+		return nc.callMethod(ctx, message.Method, proxyReq)
+	})
+	select {
+	case res := <-result:
+		resp, _ := res.Val.([]byte)
+		if leader || !res.Shared {
+			return resp, res.Err
+		}
+		if errors.Is(res.Err, context.Canceled) && ctx.Err() == nil {
+			return nc.callMethod(ctx, message.Method, proxyReq)
+		}
+		nc.metrics.Incr("upstream_deduplicated_total", map[string]string{"method": nc.metricMethod(message.Method)})
+		return withResponseID(resp, envelope.ID), res.Err
+	case <-ctx.Done():
+		return nil, nc.upstreamError(message.Method, transportError(ctx.Err()))
+	}
+}
+
+// withResponseID copy of a JSON-RPC response with id
+func withResponseID(body []byte, id json.RawMessage) []byte {
+	response := map[string]json.RawMessage{}
+	if len(id) == 0 || json.Unmarshal(body, &response) != nil {
+		return body
+	}
+	response["id"] = id
+	result, err := json.Marshal(response)
+	if err != nil {
+		return body
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+package node
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultEndpointCooldown = 30 * time.Second
+
+// nodeEndpoint a node of the pool, unhealthy until unhealthyUntil after a failed call
+type nodeEndpoint struct {
+	url            *url.URL
+	unhealthyUntil time.Time
+}
+
+// endpointPool ordered nodes, calls go to the first healthy one and fail over to the next
+type endpointPool struct {
+	mu        sync.Mutex
+	endpoints []*nodeEndpoint
+	cooldown  time.Duration
+}
+
+// newEndpointPool parse a comma separated list of node URLs, NODE_ENDPOINT_COOLDOWN
+// (seconds) is how long a failed node is skipped
+func newEndpointPool(value string) (*endpointPool, error) {
+	pool := &endpointPool{cooldown: defaultEndpointCooldown}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		u, err := url.Parse(item)
+		if err != nil {
+			return nil, err
+		}
+		pool.endpoints = append(pool.endpoints, &nodeEndpoint{url: u})
+	}
+	if len(pool.endpoints) == 0 {
+		// calls fail with the error of an empty URL, as without a pool
+		pool.endpoints = append(pool.endpoints, &nodeEndpoint{url: &url.URL{}})
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("NODE_ENDPOINT_COOLDOWN")); err == nil && seconds > 0 {
+		pool.cooldown = time.Duration(seconds) * time.Second
+	}
+	return pool, nil
+}
+
+// primary first node, requests are built with it
+func (pool *endpointPool) primary() string {
+	return pool.endpoints[0].url.String()
+}
+
+// candidates healthy nodes in order followed by the unhealthy ones, so a call is
+// still tried when every node failed recently
+func (pool *endpointPool) candidates(now time.Time) []*url.URL {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	healthy := make([]*url.URL, 0, len(pool.endpoints))
+	unhealthy := []*url.URL{}
+	for _, endpoint := range pool.endpoints {
+		if now.Before(endpoint.unhealthyUntil) {
+			unhealthy = append(unhealthy, endpoint.url)
+		} else {
+			healthy = append(healthy, endpoint.url)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// markDown skip node u for the cooldown
+func (pool *endpointPool) markDown(u *url.URL, now time.Time) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for _, endpoint := range pool.endpoints {
+		if endpoint.url == u {
+			endpoint.unhealthyUntil = now.Add(pool.cooldown)
+		}
+	}
+}
+
+// markUp node u answered, it is healthy again
+func (pool *endpointPool) markUp(u *url.URL) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for _, endpoint := range pool.endpoints {
+		if endpoint.url == u {
+			endpoint.unhealthyUntil = time.Time{}
+		}
+	}
+}
+
+// failover tell if a failed call should be retried on the next node: every failure
+// except a JSON-RPC error, which is the answer to the call itself
+func failover(err *UpstreamError) bool {
+	return err.Category() != CategoryRPCError
+}
@@ -0,0 +1,48 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// CacheExplain how a JSON-RPC request is looked up in cache
+type CacheExplain struct {
+	Method       string            `json:"method"`
+	Params       []json.RawMessage `json:"params"`
+	CacheKey     string            `json:"cacheKey"`
+	CacheKeyHash string            `json:"cacheKeyHash"`
+	Cached       bool              `json:"cached"`
+	CacheStatus  string            `json:"cacheStatus"`
+	AgeSeconds   int64             `json:"ageSeconds"`
+	BlockNumber  uint64            `json:"blockNumber"`
+}
+
+// Explain compute cache key of a JSON-RPC request body the same way as HandleRequest,
+// without calling node
+func (nc *NodeCache) Explain(body []byte) (*CacheExplain, error) {
+	if isBatchBody(body) {
+		return nil, errors.New("explain a single request, not a batch")
+	}
+	message := JSONRPCMessage{}
+	if err := json.Unmarshal(body, &message); err != nil {
+		return nil, err
+	}
+	message.Params = nc.canonicalParams(message.Method, message.Params)
+
+	key := cacheKey(message)
+	explain := &CacheExplain{
+		Method:       message.Method,
+		Params:       message.Params,
+		CacheKey:     key,
+		CacheKeyHash: nc.keyHash(key),
+		CacheStatus:  CacheStatusMiss,
+	}
+	if resp, err := nc.getCachedResponse(message); err == nil {
+		explain.Cached = true
+		explain.CacheStatus = resp.CacheStatus
+		explain.AgeSeconds = int64(resp.Age / time.Second)
+		explain.BlockNumber = resp.BlockNumber
+	}
+	return explain, nil
+}
@@ -0,0 +1,125 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/KyberNetwork/cache/logger"
+)
+
+const (
+	fallbackCache  = "cache"
+	fallbackProxy  = "proxy"
+	fallbackStale  = "stale"
+	fallbackStatic = "static"
+
+	// CacheStatusStatic response is the configured static default of the method
+	CacheStatusStatic = "STATIC"
+)
+
+// fallbackChain enabled steps of a method, steps always run in the order:
+// fresh cache -> node -> stale cache -> static default
+type fallbackChain struct {
+	cache  bool
+	proxy  bool
+	stale  bool
+	static bool
+}
+
+// parseFallbackChain parse steps in form of "cache|proxy|stale|static"
+func parseFallbackChain(value string, l logger.Logger) fallbackChain {
+	chain := fallbackChain{}
+	for _, step := range strings.Split(value, "|") {
+		switch strings.TrimSpace(step) {
+		case fallbackCache:
+			chain.cache = true
+		case fallbackProxy:
+			chain.proxy = true
+		case fallbackStale:
+			chain.stale = true
+		case fallbackStatic:
+			chain.static = true
+		default:
+			l.Error("unknown fallback step", logger.Fields{"step": step, "value": value})
+		}
+	}
+	return chain
+}
+
+// fallbacksFromEnv read FALLBACK_CHAIN and FALLBACK_STATIC, static values which are not
+// valid JSON are sent as JSON string
+func fallbacksFromEnv(l logger.Logger) (map[string]fallbackChain, map[string]json.RawMessage) {
+	chains := make(map[string]fallbackChain)
+	for method, value := range parseMethodConfig(os.Getenv("FALLBACK_CHAIN")) {
+		chains[method] = parseFallbackChain(value, l)
+	}
+	statics := make(map[string]json.RawMessage)
+	for method, value := range parseMethodConfig(os.Getenv("FALLBACK_STATIC")) {
+		if json.Valid([]byte(value)) {
+			statics[method] = json.RawMessage(value)
+			continue
+		}
+		encoded, _ := json.Marshal(value)
+		statics[method] = json.RawMessage(encoded)
+	}
+	return chains, statics
+}
+
+// handleFallback serve a message through the configured fallback chain of its method
+func (nc *NodeCache) handleFallback(req *http.Request, body []byte, message JSONRPCMessage, chain fallbackChain) (*ProxyResponse, error) {
+	tags := map[string]string{"method": nc.metricMethod(message.Method)}
+	cached, cacheErr := nc.getCachedResponse(message)
+	if chain.cache && cacheErr == nil && cached.CacheStatus == CacheStatusHit {
+		nc.checkStaleSLO(message.Method, cached)
+		nc.metrics.Incr("cache_hits_total", tags)
+		return cached, nil
+	}
+	nc.metrics.Incr("cache_misses_total", tags)
+
+	err := fmt.Errorf("no fallback step can serve method %s", message.Method)
+	if chain.proxy {
+		resp, proxyErr := nc.proxy(req, body, message)
+		if proxyErr == nil {
+			return resp, nil
+		}
+		nc.logger.Error("proxy failed, falling back", logFields(req.Context(), logger.Fields{"method": message.Method, "error": proxyErr}))
+		err = proxyErr
+	}
+	if chain.stale && cacheErr == nil && !nc.tooStale(message.Method, cached.Age) {
+		nc.metrics.Incr("cache_fallback_total", map[string]string{"method": tags["method"], "step": fallbackStale})
+		cached.CacheStatus = CacheStatusStale
+		nc.checkStaleSLO(message.Method, cached)
+		return cached, nil
+	}
+	if value, ok := nc.staticDefaults[message.Method]; chain.static && ok {
+		result, marshalErr := json.Marshal(JSONRPCResponse{Version: "2.0", ID: message.ID, Result: value})
+		if marshalErr != nil {
+			return nil, marshalErr
+		}
+		nc.metrics.Incr("cache_fallback_total", map[string]string{"method": tags["method"], "step": fallbackStatic})
+		return &ProxyResponse{Body: result, CacheStatus: CacheStatusStatic, CacheKey: cacheKey(message)}, nil
+	}
+	return nil, err
+}
+
+// String steps of the chain in form of "cache|proxy|stale|static"
+func (chain fallbackChain) String() string {
+	steps := []string{}
+	for _, step := range []struct {
+		name    string
+		enabled bool
+	}{
+		{fallbackCache, chain.cache},
+		{fallbackProxy, chain.proxy},
+		{fallbackStale, chain.stale},
+		{fallbackStatic, chain.static},
+	} {
+		if step.enabled {
+			steps = append(steps, step.name)
+		}
+	}
+	return strings.Join(steps, "|")
+}
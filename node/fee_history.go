@@ -0,0 +1,125 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/KyberNetwork/cache/ethereum"
+	"github.com/KyberNetwork/cache/logger"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	feeHistoryMethod          = "eth_feeHistory"
+	defaultFeeHistoryInterval = 5 * time.Second
+)
+
+type feeHistoryResult struct {
+	BaseFeePerGas []*hexutil.Big   `json:"baseFeePerGas"`
+	Reward        [][]*hexutil.Big `json:"reward"`
+}
+
+// feeHistoryEntry fee history fetched for one set of params
+type feeHistoryEntry struct {
+	value     *ethereum.FeeHistory
+	updatedAt time.Time
+}
+
+// feeHistoryIntervalFromEnv FEE_HISTORY_INTERVAL is in seconds
+func feeHistoryIntervalFromEnv() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("FEE_HISTORY_INTERVAL")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultFeeHistoryInterval
+}
+
+// FeeHistory eth_feeHistory of the last blockCount blocks with rewards at percentiles. It is
+// served from cache for FEE_HISTORY_INTERVAL, concurrent refreshes share one call to node,
+// and when node fails a value which is not older than its max stale age is served instead
+func (nc *NodeCache) FeeHistory(blockCount int, percentiles []float64) (*ethereum.FeeHistory, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  feeHistoryMethod,
+		"params":  []interface{}{hexutil.Uint(blockCount), "latest", percentiles},
+	})
+	if err != nil {
+		return nil, err
+	}
+	key := string(body)
+	tags := map[string]string{"method": nc.metricMethod(feeHistoryMethod)}
+
+	nc.mu.RLock()
+	entry, cached := nc.feeHistories[key]
+	nc.mu.RUnlock()
+	if cached && time.Since(entry.updatedAt) < nc.interval(feeHistoryMethod) {
+		nc.metrics.Incr("cache_hits_total", tags)
+		return entry.value, nil
+	}
+	nc.metrics.Incr("cache_misses_total", tags)
+
+	result, err, _ := nc.inFlight.Do(key, func() (interface{}, error) {
+		return nc.fetchFeeHistory(body)
+	})
+	if err == nil {
+		value := result.(*ethereum.FeeHistory)
+		nc.mu.Lock()
+		nc.feeHistories[key] = feeHistoryEntry{value: value, updatedAt: time.Now()}
+		nc.mu.Unlock()
+		return value, nil
+	}
+	if cached && !nc.tooStale(feeHistoryMethod, time.Since(entry.updatedAt)) {
+		nc.logger.Error("refreshing fee history failed, serving the cached one", logger.Fields{"method": feeHistoryMethod, "age": time.Since(entry.updatedAt).String(), "error": err})
+		nc.metrics.Incr("cache_fallback_total", map[string]string{"method": tags["method"], "step": fallbackStale})
+		return entry.value, nil
+	}
+	return nil, err
+}
+
+// fetchFeeHistory call eth_feeHistory with body to node
+func (nc *NodeCache) fetchFeeHistory(body []byte) (*ethereum.FeeHistory, error) {
+	req, err := http.NewRequest("POST", nc.endpoints.primary(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := nc.fetchRequest(feeHistoryMethod, req)
+	if err != nil {
+		return nil, err
+	}
+	response := struct {
+		Result *feeHistoryResult `json:"result"`
+	}{}
+	if err := json.Unmarshal(resp, &response); err != nil {
+		return nil, err
+	}
+	if response.Result == nil {
+		return nil, errors.New("fee history is not available")
+	}
+	feeHistory := &ethereum.FeeHistory{
+		BaseFeePerGas: make([]*big.Int, 0, len(response.Result.BaseFeePerGas)),
+		Reward:        make([][]*big.Int, 0, len(response.Result.Reward)),
+	}
+	for _, baseFee := range response.Result.BaseFeePerGas {
+		if baseFee == nil {
+			return nil, errors.New("fee history has a null base fee")
+		}
+		feeHistory.BaseFeePerGas = append(feeHistory.BaseFeePerGas, baseFee.ToInt())
+	}
+	for _, blockReward := range response.Result.Reward {
+		rewards := make([]*big.Int, 0, len(blockReward))
+		for _, reward := range blockReward {
+			if reward == nil {
+				return nil, errors.New("fee history has a null reward")
+			}
+			rewards = append(rewards, reward.ToInt())
+		}
+		feeHistory.Reward = append(feeHistory.Reward, rewards)
+	}
+	return feeHistory, nil
+}
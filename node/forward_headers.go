@@ -0,0 +1,55 @@
+package node
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+const defaultUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_11_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/56.0.2924.87 Safari/537.36"
+
+var defaultForwardHeaders = []string{"Authorization", "X-Api-Key"}
+
+// forwardHeadersFromEnv read FORWARD_HEADERS, a comma separated list of client headers
+// sent on to node, default is Authorization and X-Api-Key. "none" forwards nothing
+func forwardHeadersFromEnv() []string {
+	value := os.Getenv("FORWARD_HEADERS")
+	if value == "" {
+		return defaultForwardHeaders
+	}
+	headers := []string{}
+	if value == "none" {
+		return headers
+	}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			headers = append(headers, http.CanonicalHeaderKey(item))
+		}
+	}
+	return headers
+}
+
+// hasForwardedHeaders tell if a client request has any of the allowed headers
+func hasForwardedHeaders(allowed []string, header http.Header) bool {
+	for _, key := range allowed {
+		if _, ok := header[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardHeaders copy allowed headers of the client request to the request sent to node,
+// User-Agent of the client is kept and the default one is only set without it
+func forwardHeaders(allowed []string, from, to http.Header) {
+	for _, key := range allowed {
+		if values, ok := from[key]; ok {
+			to[key] = append([]string(nil), values...)
+		}
+	}
+	if userAgent := from.Get("User-Agent"); userAgent != "" {
+		to.Set("User-Agent", userAgent)
+	} else {
+		to.Set("User-Agent", defaultUserAgent)
+	}
+}
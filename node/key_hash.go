@@ -0,0 +1,49 @@
+package node
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"os"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	KeyHashXXHash = "xxhash"
+	KeyHashFNV    = "fnv"
+	KeyHashSHA256 = "sha256"
+)
+
+// keyHashers hash functions of cache keys, cached responses are stored under the hash so
+// keys which collide share one entry. xxhash and fnv are 64-bit non-cryptographic
+// hashes, keys can be crafted to collide. sha256 is collision resistant, on an eth_call
+// key it takes ~650ns against ~220ns for xxhash and ~620ns for fnv (see BenchmarkKeyHash*)
+var keyHashers = map[string]func(key string) string{
+	KeyHashXXHash: func(key string) string {
+		return fmt.Sprintf("%016x", xxhash.Sum64String(key))
+	},
+	KeyHashFNV: func(key string) string {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		return fmt.Sprintf("%016x", h.Sum64())
+	},
+	KeyHashSHA256: func(key string) string {
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:])
+	},
+}
+
+// keyHasherFromEnv read CACHE_KEY_HASH, default is xxhash, return the hash name and function
+func keyHasherFromEnv() (string, func(key string) string, error) {
+	name := os.Getenv("CACHE_KEY_HASH")
+	if name == "" {
+		name = KeyHashXXHash
+	}
+	hasher, ok := keyHashers[name]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown CACHE_KEY_HASH %q", name)
+	}
+	return name, hasher, nil
+}
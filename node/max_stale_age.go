@@ -0,0 +1,43 @@
+package node
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/KyberNetwork/cache/logger"
+)
+
+const defaultMaxStaleAge = 10 * time.Minute
+
+// ErrStaleTooOld returned when the only cached value of a method is older than its max stale age
+var ErrStaleTooOld = errors.New("cached value is too old to be served")
+
+// maxStaleAgesFromEnv read max age of stale values per method from MAX_STALE_AGE,
+// in form of "method:seconds,method:seconds", other methods use MAX_STALE_AGE_DEFAULT
+func maxStaleAgesFromEnv(l logger.Logger) (map[string]time.Duration, time.Duration) {
+	result := make(map[string]time.Duration)
+	for method, value := range parseMethodConfig(os.Getenv("MAX_STALE_AGE")) {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			l.Error("invalid max stale age", logger.Fields{"method": method, "value": value})
+			continue
+		}
+		result[method] = time.Duration(seconds) * time.Second
+	}
+	fallback := defaultMaxStaleAge
+	if seconds, err := strconv.Atoi(os.Getenv("MAX_STALE_AGE_DEFAULT")); err == nil && seconds > 0 {
+		fallback = time.Duration(seconds) * time.Second
+	}
+	return result, fallback
+}
+
+// tooStale tell if a cached value of method is too old to be served as stale
+func (nc *NodeCache) tooStale(method string, age time.Duration) bool {
+	maxAge, ok := nc.maxStaleAges[method]
+	if !ok {
+		maxAge = nc.defaultMaxStaleAge
+	}
+	return age > maxAge
+}
@@ -0,0 +1,114 @@
+package node
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KyberNetwork/cache/logger"
+)
+
+const (
+	duplicatePolicyError = "error"
+	duplicatePolicyMerge = "merge"
+)
+
+// methodConfig cached method and its refresh interval
+type methodConfig struct {
+	method   string
+	interval time.Duration
+}
+
+// parseCacheMethods parse methods in form of "method:seconds,method", interval is optional.
+// A method listed more than once is an error, or with merge policy the last interval wins
+// and the method keeps its first position
+func parseCacheMethods(value string, policy string, l logger.Logger) ([]methodConfig, error) {
+	result := []methodConfig{}
+	index := make(map[string]int)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		config := methodConfig{method: item, interval: defaultCacheInterval}
+		if sep := strings.LastIndex(item, ":"); sep > 0 {
+			seconds, err := strconv.Atoi(strings.TrimSpace(item[sep+1:]))
+			if err != nil || seconds <= 0 {
+				return nil, fmt.Errorf("invalid interval of cache method %q", item)
+			}
+			config.method = strings.TrimSpace(item[:sep])
+			config.interval = time.Duration(seconds) * time.Second
+		}
+
+		i, duplicated := index[config.method]
+		if !duplicated {
+			index[config.method] = len(result)
+			result = append(result, config)
+			continue
+		}
+		if policy != duplicatePolicyMerge {
+			return nil, fmt.Errorf("cache method %s is registered more than once", config.method)
+		}
+		l.Info("cache method is registered more than once, use the last interval", logger.Fields{"method": config.method, "interval": config.interval.String()})
+		result[i] = config
+	}
+	return result, nil
+}
+
+// cacheMethodsFromEnv read CACHE_METHODS, fallback to builtin cacheMethods.
+// DUPLICATE_METHOD_POLICY is error (default) or merge
+func cacheMethodsFromEnv(l logger.Logger) ([]methodConfig, error) {
+	policy := os.Getenv("DUPLICATE_METHOD_POLICY")
+	switch policy {
+	case "":
+		policy = duplicatePolicyError
+	case duplicatePolicyError, duplicatePolicyMerge:
+	default:
+		return nil, fmt.Errorf("unknown DUPLICATE_METHOD_POLICY %q", policy)
+	}
+	value := os.Getenv("CACHE_METHODS")
+	if value == "" {
+		value = strings.Join(cacheMethods, ",")
+	}
+	return parseCacheMethods(value, policy, l)
+}
+
+// CachedMethod method served from cache when called without params, and its refresh interval
+type CachedMethod struct {
+	Method          string `json:"method"`
+	IntervalSeconds int64  `json:"intervalSeconds"`
+}
+
+// CachedMethods methods of CACHE_METHODS in order, with their refresh interval
+func (nc *NodeCache) CachedMethods() []CachedMethod {
+	result := make([]CachedMethod, 0, len(nc.methods))
+	for _, config := range nc.methods {
+		result = append(result, CachedMethod{
+			Method:          config.method,
+			IntervalSeconds: int64(nc.interval(config.method) / time.Second),
+		})
+	}
+	return result
+}
+
+// interval return refresh interval of a cached method
+func (nc *NodeCache) interval(method string) time.Duration {
+	if interval, ok := nc.intervals[method]; ok {
+		return interval
+	}
+	return defaultCacheInterval
+}
+
+// metricMethod return method name to be used as metric tag, methods which are not
+// cached are grouped to keep the tag cardinality bounded
+func (nc *NodeCache) metricMethod(method string) string {
+	if _, ok := nc.intervals[method]; ok {
+		return method
+	}
+	if _, ok := nc.paramMethods[method]; ok {
+		return method
+	}
+	return "other"
+}
@@ -0,0 +1,96 @@
+package node
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KyberNetwork/cache/logger"
+)
+
+// CacheStatusBypass client asked for a fresh value with Cache-Control: no-cache or max-age
+const CacheStatusBypass = "BYPASS"
+
+// adminTokenHeader header carrying ADMIN_TOKEN, the same one as the admin routes
+const adminTokenHeader = "X-Admin-Token"
+
+// cacheMaxAge read the max age a client accepts from its Cache-Control header, no-cache
+// is max-age=0. ok is false without any of them
+func cacheMaxAge(header http.Header) (maxAge time.Duration, ok bool) {
+	for _, value := range header["Cache-Control"] {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if strings.EqualFold(directive, "no-cache") {
+				return 0, true
+			}
+			if len(directive) > len("max-age=") && strings.EqualFold(directive[:len("max-age=")], "max-age=") {
+				seconds, err := strconv.Atoi(directive[len("max-age="):])
+				if err != nil || seconds < 0 {
+					continue
+				}
+				if !ok || time.Duration(seconds)*time.Second < maxAge {
+					maxAge, ok = time.Duration(seconds)*time.Second, true
+				}
+			}
+		}
+	}
+	return maxAge, ok
+}
+
+// canBypass tell if req carries the admin token, only admins may skip the cache since
+// every bypass is a call to node. Nobody can without ADMIN_TOKEN
+func (nc *NodeCache) canBypass(req *http.Request) bool {
+	return nc.adminToken != "" &&
+		subtle.ConstantTimeCompare([]byte(req.Header.Get(adminTokenHeader)), []byte(nc.adminToken)) == 1
+}
+
+// freshEnough tell if message is cached and its response is younger than maxAge
+func (nc *NodeCache) freshEnough(message JSONRPCMessage, maxAge time.Duration) bool {
+	nc.mu.RLock()
+	entry, cached := nc.cacheResponse[nc.entryKey(message)]
+	nc.mu.RUnlock()
+	return cached && time.Since(entry.updatedAt) < maxAge
+}
+
+// bypassCache send message to node without looking at cache. A cached message is fetched
+// the way workers refresh it, without the headers of the client, and the fresh result
+// replaces the cached one. Other messages are proxied as usual
+func (nc *NodeCache) bypassCache(req *http.Request, body []byte, message JSONRPCMessage) (*ProxyResponse, error) {
+	nc.metrics.Incr("cache_bypass_total", map[string]string{"method": nc.metricMethod(message.Method)})
+	nc.mu.RLock()
+	entry, cached := nc.cacheResponse[nc.entryKey(message)]
+	nc.mu.RUnlock()
+	_, paramMethod := nc.paramMethods[message.Method]
+	if !cached && !(paramMethod && len(message.Params) > 0) {
+		resp, err := nc.proxy(req, body, message)
+		if err != nil {
+			return nil, err
+		}
+		resp.CacheStatus = CacheStatusBypass
+		return resp, nil
+	}
+
+	fetchReq, err := http.NewRequest("POST", nc.endpoints.primary(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := nc.fetchRequest(message.Method, fetchReq)
+	if err != nil {
+		return nil, err
+	}
+	if cached && entry.expires.IsZero() {
+		jsonRPCResponse := JSONRPCResponse{}
+		if err := json.Unmarshal(resp, &jsonRPCResponse); err != nil {
+			nc.logger.Error("invalid response", logFields(req.Context(), logger.Fields{"method": message.Method, "error": err}))
+		} else if nc.sizeGuard.check(message.Method, len(resp)) == nil {
+			nc.SetCacheMessageResponse(message, jsonRPCResponse)
+		}
+	} else {
+		nc.storeParamResponse(message, resp)
+	}
+	return &ProxyResponse{Body: resp, CacheStatus: CacheStatusBypass, CacheKey: cacheKey(message)}, nil
+}
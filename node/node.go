@@ -2,19 +2,36 @@ package node
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
-	"log"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/KyberNetwork/cache/ethereum"
+	"github.com/KyberNetwork/cache/logger"
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	diagnosticsHeaders  = "headers"
+	diagnosticsTrailers = "trailers"
+
+	// CacheStatusContextKey gin context key of the cache status of a proxied request
+	CacheStatusContextKey = "cacheStatus"
+)
+
 type NodeMiddleware struct {
 	client    *http.Client
 	nodeCache *NodeCache
+	// diagnostics how cache status is sent to client: headers, trailers or disabled when empty
+	diagnostics string
+	// staleSLOHeader send X-Stale-SLO-Violated when a cached response is older than its SLO
+	staleSLOHeader bool
 }
 
 var whiteListArr = []string{"kyberswap.com", "knstats.com"}
@@ -23,17 +40,25 @@ var whiteListArr = []string{"kyberswap.com", "knstats.com"}
 var banMethod = []string{}
 
 func NewNodeMiddleware() (*NodeMiddleware, error) {
+	nodeCache, err := NewNodeCache("")
+	if err != nil {
+		return nil, err
+	}
 	return &NodeMiddleware{
-		client:    &http.Client{},
-		nodeCache: NewNodeCache(),
+		client:      &http.Client{},
+		nodeCache:   nodeCache,
+		diagnostics: os.Getenv("CACHE_DIAGNOSTICS"),
+
+		staleSLOHeader: os.Getenv("STALE_SLO_HEADER") == "true",
 	}, nil
 }
 
 func (n *NodeMiddleware) HandleNodeRequest(c *gin.Context) {
 	req := c.Request
 
-	if err := filterRequest(req); err != nil {
-		log.Print(err)
+	err := n.filterRequest(req)
+	if err != nil && err != ErrRequestTooLarge {
+		n.nodeCache.logger.Error("request is filtered out", logFields(req.Context(), logger.Fields{"error": err}))
 		c.JSON(
 			http.StatusBadRequest,
 			gin.H{"err": err.Error()},
@@ -41,9 +66,74 @@ func (n *NodeMiddleware) HandleNodeRequest(c *gin.Context) {
 		return
 	}
 
-	respBytes, err := n.nodeCache.HandleRequest(req)
+	var resp *ProxyResponse
+	if err == nil {
+		resp, err = n.nodeCache.HandleRequest(req)
+	}
+	if err == ErrBatchTooLarge || err == ErrRequestTooLarge {
+		c.JSON(
+			http.StatusRequestEntityTooLarge,
+			gin.H{
+				"jsonrpc": "2.0",
+				"id":      nil,
+				"error":   gin.H{"code": -32600, "message": err.Error()},
+			},
+		)
+		return
+	}
+	if err == ErrColdStartThrottled {
+		c.Header("Retry-After", "1")
+		c.JSON(
+			http.StatusServiceUnavailable,
+			gin.H{
+				"jsonrpc": "2.0",
+				"id":      nil,
+				"error":   gin.H{"code": -32005, "message": err.Error()},
+			},
+		)
+		return
+	}
+	if err == ErrCircuitOpen {
+		// a half-open circuit is testing node, try again shortly
+		retryAfter := int(math.Ceil(n.nodeCache.breaker.retryAfter(time.Now()).Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(
+			http.StatusServiceUnavailable,
+			gin.H{
+				"jsonrpc": "2.0",
+				"id":      nil,
+				"error":   gin.H{"code": -32000, "message": err.Error()},
+			},
+		)
+		return
+	}
+	if err == ErrMalformedRequest {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"jsonrpc": "2.0",
+				"id":      nil,
+				"error":   gin.H{"code": -32700, "message": err.Error()},
+			},
+		)
+		return
+	}
+	if err == ErrInvalidVersion || err == ErrInvalidRequest {
+		c.JSON(
+			http.StatusBadRequest,
+			gin.H{
+				"jsonrpc": "2.0",
+				"id":      nil,
+				"error":   gin.H{"code": -32600, "message": err.Error()},
+			},
+		)
+		return
+	}
 	if err != nil {
-		log.Print(err)
+		n.nodeCache.logger.Error("handling node request failed", logFields(req.Context(), logger.Fields{"error": err}))
 		c.JSON(
 			http.StatusBadGateway,
 			gin.H{"err": err.Error()},
@@ -51,10 +141,105 @@ func (n *NodeMiddleware) HandleNodeRequest(c *gin.Context) {
 		return
 	}
 
-	c.Writer.Write(respBytes)
+	if resp.BlockNumber > 0 {
+		c.Header("X-Block-Number", strconv.FormatUint(resp.BlockNumber, 10))
+	}
+	c.Set(CacheStatusContextKey, resp.CacheStatus)
+	c.Header("Content-Type", "application/json")
+	if n.staleSLOHeader && resp.SLOViolated {
+		c.Header("X-Stale-SLO-Violated", "true")
+	}
+	diagnostics := n.cacheDiagnostics(resp)
+	switch n.diagnostics {
+	case diagnosticsHeaders:
+		for key, value := range diagnostics {
+			c.Header(key, value)
+		}
+	case diagnosticsTrailers:
+		// trailers must be announced before the body is written
+		for key := range diagnostics {
+			c.Writer.Header().Add("Trailer", key)
+		}
+	}
+	c.Writer.Write(resp.Body)
+	if n.diagnostics == diagnosticsTrailers {
+		for key, value := range diagnostics {
+			c.Writer.Header().Set(key, value)
+		}
+	}
+}
+
+// Explain Get cache key and cache state of a JSON-RPC request body
+func (n *NodeMiddleware) Explain(body []byte) (*CacheExplain, error) {
+	return n.nodeCache.Explain(body)
+}
+
+// WarmupProgress Get progress of the first refresh of cached methods
+func (n *NodeMiddleware) WarmupProgress() WarmupProgress {
+	return n.nodeCache.WarmupProgress()
+}
+
+// WaitReady Wait for the first refresh of every cached method
+func (n *NodeMiddleware) WaitReady(ctx context.Context) error {
+	return n.nodeCache.WaitReady(ctx)
+}
+
+// CircuitBreakerState Get state of the circuit breaker around node
+func (n *NodeMiddleware) CircuitBreakerState() string {
+	return n.nodeCache.CircuitBreakerState()
+}
+
+// Refresh Refresh one or every cached method now
+func (n *NodeMiddleware) Refresh(method string) (RefreshResult, error) {
+	return n.nodeCache.Refresh(method)
+}
+
+// FeeHistory Get eth_feeHistory of the last blockCount blocks through node cache
+func (n *NodeMiddleware) FeeHistory(blockCount int, percentiles []float64) (*ethereum.FeeHistory, error) {
+	return n.nodeCache.FeeHistory(blockCount, percentiles)
+}
+
+// Bundle Get diagnostics bundle of node cache
+func (n *NodeMiddleware) Bundle() DiagnosticsBundle {
+	return n.nodeCache.Bundle()
+}
+
+// NodeInfo Get version, chain id and network id of node
+func (n *NodeMiddleware) NodeInfo() NodeInfo {
+	return n.nodeCache.NodeInfo()
+}
+
+// LastRefresh Get time of the last successful refresh of a cached method
+func (n *NodeMiddleware) LastRefresh() time.Time {
+	return n.nodeCache.LastRefresh()
+}
+
+// CachedMethods Get methods served from cache with their refresh interval
+func (n *NodeMiddleware) CachedMethods() []CachedMethod {
+	return n.nodeCache.CachedMethods()
+}
+
+// Close stop node cache workers
+func (n *NodeMiddleware) Close() {
+	n.nodeCache.Close()
+}
+
+// ProxyAudit Get counts of methods proxied to node
+func (n *NodeMiddleware) ProxyAudit() ([]ProxyAuditEntry, bool) {
+	return n.nodeCache.ProxyAudit()
+}
+
+// cacheDiagnostics return cache status of a response to be sent as headers or trailers
+func (n *NodeMiddleware) cacheDiagnostics(resp *ProxyResponse) map[string]string {
+	return map[string]string{
+		"X-Cache-Status":   resp.CacheStatus,
+		"X-Cache-Age":      strconv.FormatInt(int64(resp.Age/time.Second), 10),
+		"X-Cache-Key":      resp.CacheKey,
+		"X-Cache-Key-Hash": n.nodeCache.keyHash(resp.CacheKey),
+	}
 }
 
-func filterRequest(req *http.Request) error {
+func (n *NodeMiddleware) filterRequest(req *http.Request) error {
 
 	kyberENV := os.Getenv("KYBER_ENV")
 	if kyberENV != "production" {
@@ -68,22 +253,31 @@ func filterRequest(req *http.Request) error {
 		return errors.New("Domain is not in the whitelist: " + origin)
 	}
 
-	// check method
-	body, err := ioutil.ReadAll(req.Body)
+	// check method, the body is read with the same limit as HandleRequest
+	body, ok, err := readLimited(req.Body, n.nodeCache.maxRequestBytes)
 	if err != nil {
-		log.Print(err)
+		n.nodeCache.logger.Error("reading client request failed", logFields(req.Context(), logger.Fields{"error": err}))
 		return err
 	}
-
-	var requestRpc RequestRPC
-	err = json.Unmarshal(body, &requestRpc)
-	if err != nil {
-		log.Print(err)
-		return err
+	if !ok {
+		n.nodeCache.logger.Error("client request is too large", logFields(req.Context(), logger.Fields{"limit": n.nodeCache.maxRequestBytes}))
+		return ErrRequestTooLarge
 	}
 
-	if InList(requestRpc.Method, banMethod) {
-		return errors.New("Method is not allowed")
+	// members of a batch are checked one by one, malformed bodies are rejected by HandleRequest
+	requests := []RequestRPC{}
+	if isBatchBody(body) {
+		err = json.Unmarshal(body, &requests)
+	} else {
+		requests = append(requests, RequestRPC{})
+		err = json.Unmarshal(body, &requests[0])
+	}
+	if err == nil {
+		for _, requestRpc := range requests {
+			if InList(requestRpc.Method, banMethod) {
+				return errors.New("Method is not allowed")
+			}
+		}
 	}
 
 	// reassign again
@@ -2,203 +2,853 @@ package node
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/KyberNetwork/cache/logger"
+	"github.com/KyberNetwork/cache/metrics"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultMaxBatchSize  = 100
+	defaultCacheInterval = 10 * time.Second
+	defaultNodeTimeout   = 30 * time.Second
+	defaultAgeInterval   = 5 * time.Second
+
+	CacheStatusHit   = "HIT"
+	CacheStatusMiss  = "MISS"
+	CacheStatusStale = "STALE"
 )
 
 var cacheMethods = []string{}
 
+// ErrBatchTooLarge returned when a JSON-RPC batch has more calls than allowed
+var ErrBatchTooLarge = errors.New("JSON-RPC batch is too large")
+
+// ErrMalformedRequest returned when the request body is not JSON, it is not sent to node
+var ErrMalformedRequest = errors.New("request body is not valid JSON")
+
 type JSONRPCMessage struct {
-	Version string   `json:"jsonrpc,omitempty"`
-	ID      int      `json:"id,omitempty"`
-	Method  string   `json:"method,omitempty"`
-	Params  []string `json:"params,omitempty"`
+	Version string            `json:"jsonrpc,omitempty"`
+	ID      int               `json:"id,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	Params  []json.RawMessage `json:"params,omitempty"`
 }
 
 type JSONRPCResponse struct {
-	Version string      `json:"jsonrpc,omitempty"`
-	ID      int         `json:"id,omitempty"`
-	Result  interface{} `json:"result,omitempty"`
+	Version string        `json:"jsonrpc,omitempty"`
+	ID      int           `json:"id,omitempty"`
+	Result  interface{}   `json:"result,omitempty"`
+	Error   *JSONRPCError `json:"error,omitempty"`
+}
+
+// JSONRPCError error object of a JSON-RPC response
+type JSONRPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// ProxyResponse result of HandleRequest
+type ProxyResponse struct {
+	Body   []byte
+	Cached bool
+	// BlockNumber latest block when the cached response was fetched, 0 if unknown
+	BlockNumber uint64
+	// CacheStatus HIT, MISS or STALE when the cached response missed a refresh
+	CacheStatus string
+	Age         time.Duration
+	CacheKey    string
+	// SLOViolated cached response is older than the stale SLO of its method
+	SLOViolated bool
+}
+
+type cacheEntry struct {
+	response    JSONRPCResponse
+	blockNumber uint64
+	updatedAt   time.Time
+	hash        uint64    // content hash of the result
+	expires     time.Time // of responses to calls with params, zero for refreshed methods
 }
 
 type NodeCache struct {
+	latestBlock uint64 // accessed atomically, keep it 64-bit aligned
+	lastRefresh int64  // unix nano of the last successful refresh, accessed atomically
+
+	// ctx lifecycle of workers, cancelled by Close
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// endpoints nodes to call, in order of preference
+	endpoints     *endpointPool
 	client        *http.Client
-	cacheResponse map[string]JSONRPCResponse // cache map with key is method name and value is byte response
+	transport     TransportConfig
+	inFlight      singleflight.Group    // calls to node shared by identical proxied requests
+	timeout       time.Duration         // of each call to node
+	cacheResponse map[string]cacheEntry // cached responses by hash of their cache key
 	mu            sync.RWMutex
+	audit         *proxyAudit // nil when PROXY_AUDIT is not enabled
+	sizeGuard     *responseSizeGuard
+	maxBatchSize  int
+	metrics       metrics.MetricsSink
+	logger        logger.Logger
+	startupDelay  time.Duration // wait before workers begin, give node time to come up
+	// fallbacks per method fallback chain, methods without one are served from cache then node
+	fallbacks      map[string]fallbackChain
+	staticDefaults map[string]json.RawMessage
+	methods        []methodConfig
+	warmup         *warmup
+	intervals      map[string]time.Duration
+	staleSLOs      map[string]time.Duration
+	// maxStaleAges stale values older than this are not served, even as a fallback
+	maxStaleAges       map[string]time.Duration
+	defaultMaxStaleAge time.Duration
+	// canonicalizers per method params canonicalizers, applied before cache key computation
+	canonicalizers map[string][]paramCanonicalizer
+	versionMode    string
+	keyHash        func(key string) string
+	keyHashName    string
+
+	requestCompression *requestCompression // nil when requests to node are not compressed
+	responseCheck      string
+	forwardHeaders     []string // client headers sent on to node
+	upstreamErrors     *upstreamErrorLog
+	coldStart          *coldStartThrottle
+	breaker            *circuitBreaker // nil when CIRCUIT_BREAKER_THRESHOLD is not set
+	revalidator        *revalidator
+	webSockets         map[*url.URL]*wsTransport // persistent connections to ws:// and wss:// nodes
+	maxRequestBytes    int64                     // of client request bodies
+	adminToken         string                    // allows clients to skip cache with Cache-Control
+	paramMethods       map[string]time.Duration  // TTL of cached responses to calls with params
+	paramMaxEntries    int
+	paramSweptAt       time.Time // last sweep of expired responses to calls with params, guarded by mu
+	maxResponseBytes   int64     // of node responses
+
+	// feeHistories eth_feeHistory by request body, see FeeHistory
+	feeHistories map[string]feeHistoryEntry
+
+	// recentBlocks hash of recent blocks by number, only used by the block number worker
+	recentBlocks map[uint64]string
+	purgeDepth   uint64
+}
+
+// Option configure optional NodeCache settings
+type Option func(*NodeCache)
+
+// WithTimeout limit each call to node to timeout, including reading the response
+func WithTimeout(timeout time.Duration) Option {
+	return func(nc *NodeCache) {
+		nc.timeout = timeout
+	}
+}
+
+// WithLogger write logs of node cache to l instead of the default logger
+func WithLogger(l logger.Logger) Option {
+	return func(nc *NodeCache) {
+		nc.logger = l
+	}
 }
 
-func NewNodeCache() *NodeCache {
+// NewNodeCache create a node cache calling the node at endpoint, NODE_ENDPOINT when it is empty.
+// endpoint may be a comma separated list of nodes to fail over to
+func NewNodeCache(endpoint string, opts ...Option) (*NodeCache, error) {
+	return NewNodeCacheWithIntervals(endpoint, nil, opts...)
+}
+
+// NewNodeCacheWithIntervals create a node cache whose refresh intervals of methods in
+// CACHE_METHODS are overridden by intervals, other methods keep the interval of
+// CACHE_METHODS or the 10s default
+func NewNodeCacheWithIntervals(endpoint string, intervals map[string]time.Duration, opts ...Option) (*NodeCache, error) {
+	if endpoint == "" {
+		endpoint = os.Getenv("NODE_ENDPOINT")
+	}
+	endpoints, err := newEndpointPool(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	keyHashName, keyHash, err := keyHasherFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	nc := &NodeCache{
-		client:        &http.Client{},
-		cacheResponse: make(map[string]JSONRPCResponse),
-		mu:            sync.RWMutex{},
+		ctx:            ctx,
+		cancel:         cancel,
+		endpoints:      endpoints,
+		keyHash:        keyHash,
+		keyHashName:    keyHashName,
+		upstreamErrors: newUpstreamErrorLog(defaultUpstreamErrorLogSize),
+		intervals:      make(map[string]time.Duration),
+		timeout:        defaultNodeTimeout,
+		cacheResponse:  make(map[string]cacheEntry),
+		mu:             sync.RWMutex{},
+		maxBatchSize:   defaultMaxBatchSize,
+		metrics:        metrics.Default(),
+		logger:         logger.Default(),
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("NODE_TIMEOUT")); err == nil && seconds > 0 {
+		nc.timeout = time.Duration(seconds) * time.Second
+	}
+	nc.transport = transportConfigFromEnv()
+	for _, opt := range opts {
+		opt(nc)
+	}
+	// methods are read once the logger is set, duplicates are logged
+	methods, err := cacheMethodsFromEnv(nc.logger)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for i, config := range methods {
+		if interval, ok := intervals[config.method]; ok && interval > 0 {
+			methods[i].interval = interval
+		}
+	}
+	nc.methods = methods
+	nc.warmup = newWarmup(methods)
+	nc.paramMethods, nc.paramMaxEntries, err = paramMethodsFromEnv(nc.logger)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	nc.maxRequestBytes, nc.maxResponseBytes = bodyLimitsFromEnv()
+	nc.client = &http.Client{Timeout: nc.timeout, Transport: newTransport(nc.transport)}
+	nc.webSockets = newWSTransports(endpoints, nc.timeout, nc.maxResponseBytes)
+	for _, method := range fetchOnceMethods {
+		nc.intervals[method] = defaultFetchOnceInterval
+	}
+	nc.intervals[feeHistoryMethod] = feeHistoryIntervalFromEnv()
+	for _, config := range methods {
+		nc.intervals[config.method] = config.interval
+	}
+	nc.feeHistories = make(map[string]feeHistoryEntry)
+	nc.sizeGuard = newResponseSizeGuardFromEnv(nc.metrics, nc.logger)
+	nc.fallbacks, nc.staticDefaults = fallbacksFromEnv(nc.logger)
+	nc.canonicalizers = canonicalizersFromEnv(nc.logger)
+	nc.staleSLOs = staleSLOsFromEnv(nc.logger)
+	nc.maxStaleAges, nc.defaultMaxStaleAge = maxStaleAgesFromEnv(nc.logger)
+	nc.requestCompression = newRequestCompressionFromEnv()
+	nc.responseCheck = responseCheckFromEnv()
+	nc.forwardHeaders = forwardHeadersFromEnv()
+	nc.coldStart = newColdStartThrottleFromEnv(time.Now())
+	nc.breaker = newCircuitBreakerFromEnv()
+	nc.revalidator = newRevalidator()
+	nc.recentBlocks = make(map[uint64]string)
+	nc.purgeDepth = defaultReorgPurgeDepth
+	if depth, err := strconv.ParseUint(os.Getenv("REORG_PURGE_DEPTH"), 10, 64); err == nil && depth > 0 {
+		nc.purgeDepth = depth
+	}
+	nc.adminToken = os.Getenv("ADMIN_TOKEN")
+	nc.versionMode = os.Getenv("JSONRPC_VERSION_MODE")
+	if nc.versionMode != VersionModeStrict {
+		nc.versionMode = VersionModeLenient
+	}
+	if maxBatchSize, err := strconv.Atoi(os.Getenv("MAX_BATCH_SIZE")); err == nil && maxBatchSize > 0 {
+		nc.maxBatchSize = maxBatchSize
 	}
+	if delay, err := strconv.Atoi(os.Getenv("NODE_CACHE_STARTUP_DELAY")); err == nil && delay > 0 {
+		nc.startupDelay = time.Duration(delay) * time.Second
+	}
+	if os.Getenv("PROXY_AUDIT") == "true" {
+		nc.audit = newProxyAudit(defaultAuditMaxMethods, defaultAuditMaxParams)
+		if interval, err := strconv.Atoi(os.Getenv("PROXY_AUDIT_LOG_INTERVAL")); err == nil && interval > 0 {
+			nc.wg.Add(1)
+			go func() {
+				defer nc.wg.Done()
+				nc.audit.logLoop(ctx, time.Duration(interval)*time.Second, nc.logger)
+			}()
+		}
+	}
+	nc.wg.Add(1)
 	go nc.run()
-	return nc
+	return nc, nil
+}
+
+// WarmupProgress Get progress of the first refresh of cached methods
+func (nc *NodeCache) WarmupProgress() WarmupProgress {
+	return nc.warmup.progress()
+}
+
+// WaitReady block until every cached method has been fetched once, or ctx is done.
+// Failed methods are retried with backoff, so it may wait for several intervals
+func (nc *NodeCache) WaitReady(ctx context.Context) error {
+	return nc.warmup.wait(ctx)
+}
+
+// CircuitBreakerState state of the circuit breaker around node, CircuitDisabled without one
+func (nc *NodeCache) CircuitBreakerState() string {
+	return nc.breaker.State()
+}
+
+// ProxyAudit Get counts of proxied methods, return false if audit is disabled
+func (nc *NodeCache) ProxyAudit() ([]ProxyAuditEntry, bool) {
+	if nc.audit == nil {
+		return nil, false
+	}
+	return nc.audit.Snapshot(), true
 }
 
 func (nc *NodeCache) run() {
-	for _, method := range cacheMethods {
-		go nc.cacheWorker(method)
+	defer nc.wg.Done()
+	if nc.startupDelay > 0 {
+		nc.logger.Info("node cache workers start later", logger.Fields{"delay": nc.startupDelay.String()})
+		select {
+		case <-nc.ctx.Done():
+			return
+		case <-time.After(nc.startupDelay):
+		}
+	}
+	if len(nc.methods) > 0 {
+		nc.wg.Add(3)
+		go nc.blockNumberWorker(defaultBlockNumberInterval)
+		go nc.ageWorker(defaultAgeInterval)
+		go nc.fetchOnceWorker(defaultFetchOnceInterval)
+	}
+	for _, config := range nc.methods {
+		nc.wg.Add(1)
+		go nc.cacheWorker(config.method, config.interval)
+	}
+}
+
+// Close stop workers and background loops, in-flight calls to node are cancelled and
+// connections to node closed. Workers have returned when it returns
+func (nc *NodeCache) Close() {
+	nc.cancel()
+	// revalidations are not started once Close waits for the running ones
+	nc.revalidator.close()
+	nc.wg.Wait()
+	for _, transport := range nc.webSockets {
+		transport.close()
+	}
+	if transport, ok := nc.client.Transport.(*http.Transport); ok {
+		transport.CloseIdleConnections()
+	}
+}
+
+// sleep wait for the next tick, return false when node cache is closed
+func (nc *NodeCache) sleep(ticker *time.Ticker) bool {
+	select {
+	case <-nc.ctx.Done():
+		return false
+	case <-ticker.C:
+		return true
 	}
 }
 
-// cacheWorker A worker to serve a method
-func (nc *NodeCache) cacheWorker(method string) {
-	ticker := time.NewTicker(10 * time.Second)
+// sleepFor wait for d, return false when node cache is closed
+func (nc *NodeCache) sleepFor(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-nc.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// cacheWorker A worker to serve a method, a failed refresh is retried with backoff
+// up to interval
+func (nc *NodeCache) cacheWorker(method string, interval time.Duration) {
+	defer nc.wg.Done()
+	retry := newRetryBackoff(defaultRetryBackoff, interval)
 	for {
-		req, err := nc.makeRequest(method)
+		err := nc.refreshMethod(method)
+		nc.warmup.done(method, err)
+		wait := interval
 		if err != nil {
-			log.Println(err)
-			<-ticker.C
-			continue
+			wait = retry.next()
+			nc.logger.Info("retrying refresh", logger.Fields{"method": method, "backoff": wait.String(), "attempt": retry.failures})
+		} else {
+			retry.reset()
 		}
-
-		proxyReq, err := nc.cloneRequest(req)
-		if err != nil {
-			log.Println(err)
-			<-ticker.C
-			continue
+		if !nc.sleepFor(wait) {
+			return
 		}
+	}
+}
 
-		resp, err := nc.callMethod(proxyReq)
-		if err != nil {
-			log.Println(err)
-			<-ticker.C
-			continue
-		}
+// refreshMethod fetch a method from node and save it to cache, errors are logged
+func (nc *NodeCache) refreshMethod(method string) error {
+	resp, err := nc.fetchMethod(method)
+	if err != nil {
+		nc.logger.Error("refresh failed", logger.Fields{"method": method, "error": err})
+		return err
+	}
 
-		jsonRPCResponse := JSONRPCResponse{}
-		if err := json.Unmarshal(resp, &jsonRPCResponse); err != nil {
-			log.Println(err)
-			<-ticker.C
-			continue
+	if err := nc.sizeGuard.check(method, len(resp)); err != nil {
+		nc.logger.Error("response too large", logger.Fields{"method": method, "error": err})
+		return err
+	}
+
+	jsonRPCResponse := JSONRPCResponse{}
+	if err := json.Unmarshal(resp, &jsonRPCResponse); err != nil {
+		nc.logger.Error("invalid response", logger.Fields{"method": method, "error": err})
+		return err
+	}
+
+	nc.recordChurn(method, jsonRPCResponse)
+	nc.SetCacheResponse(method, jsonRPCResponse)
+	atomic.StoreInt64(&nc.lastRefresh, time.Now().UnixNano())
+	return nil
+}
+
+// LastRefresh time of the last successful refresh of a cached method, zero if none yet
+func (nc *NodeCache) LastRefresh() time.Time {
+	lastRefresh := atomic.LoadInt64(&nc.lastRefresh)
+	if lastRefresh == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, lastRefresh)
+}
+
+// ageWorker report age of cached methods
+func (nc *NodeCache) ageWorker(interval time.Duration) {
+	defer nc.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for nc.sleep(ticker) {
+		nc.mu.RLock()
+		for _, config := range nc.methods {
+			if entry, ok := nc.cacheResponse[nc.entryKey(JSONRPCMessage{Method: config.method})]; ok {
+				nc.metrics.Gauge("cache_age_seconds", time.Since(entry.updatedAt).Seconds(), map[string]string{"method": config.method})
+			}
 		}
+		nc.mu.RUnlock()
+	}
+}
 
-		nc.SetCacheResponse(method, jsonRPCResponse)
-		<-ticker.C
+// fetchMethod call a method without params to node
+func (nc *NodeCache) fetchMethod(method string) ([]byte, error) {
+	req, err := nc.makeRequest(method)
+	if err != nil {
+		return nil, err
 	}
+	return nc.fetchRequest(method, req)
 }
 
-// callMethod
-func (nc *NodeCache) callMethod(req *http.Request) ([]byte, error) {
-	// We may want to filter some headers, otherwise we could just use a shallow copy
-	resp, err := nc.client.Do(req)
+// fetchRequest send a request made by the cache to node
+func (nc *NodeCache) fetchRequest(method string, req *http.Request) ([]byte, error) {
+	proxyReq, err := nc.cloneRequest(req)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
-		bodyBytes, err := ioutil.ReadAll(resp.Body)
+	// abort when node cache is closed
+	body, host, err := nc.callEndpoints(nc.ctx, method, proxyReq)
+	if err == nil {
+		nc.logger.Info("refreshed", logger.Fields{"method": method, "endpoint": host})
+	}
+	return body, err
+}
+
+// callMethod send req to the nodes of nc, see callEndpoints
+func (nc *NodeCache) callMethod(ctx context.Context, method string, req *http.Request) ([]byte, error) {
+	body, _, err := nc.callEndpoints(ctx, method, req)
+	return body, err
+}
+
+// callEndpoints send req to the first healthy node and fail over to the next ones, return
+// the body and the host of the node which answered. Nodes which failed are skipped for
+// the cooldown of the pool, and no node is called while the circuit breaker is open
+func (nc *NodeCache) callEndpoints(ctx context.Context, method string, req *http.Request) ([]byte, string, error) {
+	if !nc.breaker.allow(time.Now()) {
+		nc.metrics.Incr("circuit_breaker_rejected_total", map[string]string{"method": nc.metricMethod(method)})
+		return nil, "", ErrCircuitOpen
+	}
+	body, host, err := nc.callPool(ctx, method, req)
+	// a JSON-RPC error is an answer of node, calls cancelled by the client are not counted
+	upstreamErr, ok := err.(*UpstreamError)
+	success := err == nil || (ok && !failover(upstreamErr))
+	failure := ok && failover(upstreamErr) && ctx.Err() == nil
+	if nc.breaker.done(time.Now(), success, failure) {
+		nc.logger.Error("circuit breaker opened, node calls fail fast", logFields(ctx, logger.Fields{"method": method, "cooldown": nc.breaker.cooldown.String(), "error": err}))
+		nc.metrics.Incr("circuit_breaker_opened_total", nil)
+	}
+	return body, host, err
+}
+
+// callPool call the nodes of the pool in order, see callEndpoints
+func (nc *NodeCache) callPool(ctx context.Context, method string, req *http.Request) ([]byte, string, error) {
+	var lastErr error
+	candidates := nc.endpoints.candidates(time.Now())
+	for i, endpoint := range candidates {
+		attempt, err := withEndpoint(req, endpoint)
+		if err != nil {
+			return nil, "", err
+		}
+		body, err := nc.callEndpoint(ctx, method, attempt)
+		upstreamErr, ok := err.(*UpstreamError)
+		if err == nil || !ok || !failover(upstreamErr) {
+			nc.endpoints.markUp(endpoint)
+			return body, endpoint.Host, err
+		}
+		nc.endpoints.markDown(endpoint, time.Now())
+		lastErr = err
+		// client is gone or node cache is closed
+		if ctx.Err() != nil {
+			break
+		}
+		if i < len(candidates)-1 {
+			nc.logger.Error("node failed, trying next node", logFields(ctx, logger.Fields{"method": method, "endpoint": endpoint.Host, "error": err}))
+			nc.metrics.Incr("upstream_failovers_total", map[string]string{"method": nc.metricMethod(method)})
+		}
+	}
+	return nil, "", lastErr
+}
+
+// withEndpoint copy of req sent to endpoint, with a new reader of its body
+func withEndpoint(req *http.Request, endpoint *url.URL) (*http.Request, error) {
+	attempt := req.WithContext(req.Context())
+	attempt.URL = endpoint
+	attempt.Host = endpoint.Host
+	if req.GetBody != nil {
+		body, err := req.GetBody()
 		if err != nil {
-			log.Print(err)
 			return nil, err
 		}
-		return bodyBytes, nil
+		attempt.Body = body
+	}
+	return attempt, nil
+}
+
+// callEndpoint send req to one node, cancelled with ctx or after the timeout of nc. Failures
+// are returned as *UpstreamError. When node answers a JSON-RPC error object the body is
+// returned along with the error so it can be proxied
+func (nc *NodeCache) callEndpoint(ctx context.Context, method string, req *http.Request) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, nc.timeout)
+	defer cancel()
+	if transport, ok := nc.webSockets[req.URL]; ok {
+		return nc.callWebSocket(ctx, method, transport, req)
+	}
+	// We may want to filter some headers, otherwise we could just use a shallow copy
+	start := time.Now()
+	resp, err := nc.client.Do(req.WithContext(ctx))
+	nc.metrics.Timing("upstream_request_duration_seconds", time.Since(start), map[string]string{"method": nc.metricMethod(method)})
+	if err != nil {
+		nc.logger.Error("call to node failed", logFields(ctx, logger.Fields{"method": method, "endpoint": req.URL.Host, "error": err}))
+		return nil, nc.upstreamError(method, transportError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		nc.logger.Error("node answered an error status", logFields(ctx, logger.Fields{"method": method, "endpoint": req.URL.Host, "status": resp.StatusCode}))
+		return nil, nc.upstreamError(method, statusError(resp.StatusCode))
+	}
+	bodyBytes, ok, err := readLimited(resp.Body, nc.maxResponseBytes)
+	if err != nil {
+		nc.logger.Error("reading node response failed", logFields(ctx, logger.Fields{"method": method, "endpoint": req.URL.Host, "error": err}))
+		return nil, nc.upstreamError(method, transportError(err))
 	}
-	return nil, errors.New(fmt.Sprintf("Status code is %d", resp.StatusCode))
+	if !ok {
+		return nil, nc.responseTooLarge(ctx, method, req)
+	}
+	if err := checkResponse(nc.responseCheck, resp.Header, bodyBytes); err != nil {
+		nc.logger.Error("node answered a non JSON response", logFields(ctx, logger.Fields{"method": method, "endpoint": req.URL.Host, "contentType": resp.Header.Get("Content-Type"), "error": err}))
+		nc.metrics.Incr("upstream_non_json_total", map[string]string{"method": nc.metricMethod(method)})
+		return nil, nc.upstreamError(method, &UpstreamError{category: CategoryBadResponse, err: err})
+	}
+	if rpcErr := rpcError(bodyBytes); rpcErr != nil {
+		return bodyBytes, nc.upstreamError(method, rpcErr)
+	}
+	return bodyBytes, nil
+}
+
+// responseTooLarge log and count a node response over MAX_RESPONSE_BYTES
+func (nc *NodeCache) responseTooLarge(ctx context.Context, method string, req *http.Request) error {
+	nc.logger.Error("node response is too large", logFields(ctx, logger.Fields{"method": method, "endpoint": req.URL.Host, "limit": nc.maxResponseBytes}))
+	nc.metrics.Incr("upstream_response_too_large_total", map[string]string{"method": nc.metricMethod(method)})
+	return nc.upstreamError(method, &UpstreamError{category: CategoryBadResponse, err: ErrResponseTooLarge})
+}
+
+// upstreamError count a failed call to node by category and keep it in the recent errors
+func (nc *NodeCache) upstreamError(method string, err *UpstreamError) error {
+	nc.metrics.Incr("upstream_errors_total", map[string]string{"method": nc.metricMethod(method), "category": string(err.Category())})
+	nc.upstreamErrors.add(method, err)
+	return err
 }
 
 func (nc *NodeCache) makeRequest(method string) (*http.Request, error) {
 	params := JSONRPCMessage{
 		Version: "2.0",
 		Method:  method,
-		Params:  []string{},
+		Params:  []json.RawMessage{},
 	}
 
 	paramBytes, err := json.Marshal(params)
 	if err != nil {
-		log.Println(err)
+		nc.logger.Error("encoding request failed", logger.Fields{"method": method, "error": err})
 		return nil, err
 	}
 	rbody := bytes.NewReader(paramBytes)
 
-	req, err := http.NewRequest("POST", os.Getenv("NODE_ENDPOINT"), rbody)
+	req, err := http.NewRequest("POST", nc.endpoints.primary(), rbody)
 	if err != nil {
-		log.Print(err)
+		nc.logger.Error("creating request failed", logger.Fields{"method": method, "endpoint": nc.endpoints.primary(), "error": err})
 		return nil, err
 	}
 
 	return req, nil
 }
 
-// SetCacheResponse Save method response to cache
+// SetCacheResponse Save method response to cache, along with the latest block number
+// since cached methods are called without block params
 func (nc *NodeCache) SetCacheResponse(method string, message JSONRPCResponse) {
+	nc.SetCacheMessageResponse(JSONRPCMessage{Method: method}, message)
+}
+
+// SetCacheMessageResponse cache the response of a method called with params,
+// responses with an error object are not cached
+func (nc *NodeCache) SetCacheMessageResponse(request JSONRPCMessage, message JSONRPCResponse) {
+	if message.Error != nil {
+		return
+	}
+	entry := cacheEntry{
+		response:    message,
+		blockNumber: nc.LatestBlock(),
+		updatedAt:   time.Now(),
+		hash:        contentHash(message.Result),
+	}
+	key := nc.entryKey(request)
 	nc.mu.Lock()
 	defer nc.mu.Unlock()
-	nc.cacheResponse[method] = message
+	nc.cacheResponse[key] = entry
+}
+
+// recordChurn count refreshes where the value of method is different from the cached one
+func (nc *NodeCache) recordChurn(method string, message JSONRPCResponse) {
+	nc.mu.RLock()
+	entry, ok := nc.cacheResponse[nc.entryKey(JSONRPCMessage{Method: method})]
+	nc.mu.RUnlock()
+	if ok && entry.hash != contentHash(message.Result) {
+		nc.metrics.Incr("cache_value_changed_total", map[string]string{"method": nc.metricMethod(method)})
+	}
+}
+
+// contentHash hash of a cached value, used to detect changes between refreshes
+func contentHash(value interface{}) uint64 {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// cacheKey return the key of a message in cache, the method followed by its params in JSON,
+// e.g. eth_getBalance["0xabc","latest"], or the method alone when it has no params.
+// Keys are stable across restarts, support can compare them with X-Cache-Key
+func cacheKey(message JSONRPCMessage) string {
+	if len(message.Params) == 0 {
+		return message.Method
+	}
+	params, err := json.Marshal(message.Params)
+	if err != nil {
+		return message.Method
+	}
+	return message.Method + string(params)
+}
+
+// entryKey key of message in cacheResponse, its cache key hashed by CACHE_KEY_HASH
+func (nc *NodeCache) entryKey(message JSONRPCMessage) string {
+	return nc.keyHash(cacheKey(message))
 }
 
 // GetCacheResponse Get response from cache, return []byte
 func (nc *NodeCache) GetCacheResponse(message JSONRPCMessage) ([]byte, error) {
+	resp, err := nc.getCachedResponse(message)
+	if err != nil {
+		return []byte{}, err
+	}
+	return resp.Body, nil
+}
+
+func (nc *NodeCache) getCachedResponse(message JSONRPCMessage) (*ProxyResponse, error) {
 	nc.mu.RLock()
 	defer nc.mu.RUnlock()
 
-	if jsonRPCResponse, ok := nc.cacheResponse[message.Method]; ok {
+	key := cacheKey(message)
+	if entry, ok := nc.cacheResponse[nc.keyHash(key)]; ok && !entry.expired(time.Now()) {
+		jsonRPCResponse := entry.response
 		// clone user request ID
 		jsonRPCResponse.ID = message.ID
 		result, err := json.Marshal(jsonRPCResponse)
 		if err != nil {
-			return []byte{}, err
+			return nil, err
+		}
+		resp := &ProxyResponse{
+			Body:        result,
+			Cached:      true,
+			CacheStatus: CacheStatusHit,
+			Age:         time.Since(entry.updatedAt),
+			CacheKey:    key,
+		}
+		// the entry should have been refreshed at least once already, responses to calls
+		// with params are not refreshed and expire instead
+		if entry.expires.IsZero() && resp.Age > 2*nc.interval(message.Method) {
+			if nc.tooStale(message.Method, resp.Age) {
+				return nil, ErrStaleTooOld
+			}
+			resp.CacheStatus = CacheStatusStale
 		}
-		return result, nil
+		if isLatestTagged(message.Params) {
+			resp.BlockNumber = entry.blockNumber
+		}
+		return resp, nil
 	}
-	return []byte{}, errors.New(fmt.Sprintf("Method %s is not supported caching", message.Method))
+	return nil, errors.New(fmt.Sprintf("Method %s is not supported caching", message.Method))
 }
 
 // HandleRequest Handle client request, if method is in cache list then get from cache
-func (nc *NodeCache) HandleRequest(req *http.Request) ([]byte, error) {
-	body, err := ioutil.ReadAll(req.Body)
+func (nc *NodeCache) HandleRequest(req *http.Request) (*ProxyResponse, error) {
+	body, ok, err := readLimited(req.Body, nc.maxRequestBytes)
 	if err != nil {
-		log.Print(err)
+		nc.logger.Error("reading client request failed", logFields(req.Context(), logger.Fields{"error": err}))
+		return nil, err
+	}
+	if !ok {
+		nc.logger.Error("client request is too large", logFields(req.Context(), logger.Fields{"limit": nc.maxRequestBytes}))
+		return nil, ErrRequestTooLarge
+	}
+	if !json.Valid(body) {
+		return nil, ErrMalformedRequest
+	}
+
+	if isBatchBody(body) {
+		batch := []json.RawMessage{}
+		if err := json.Unmarshal(body, &batch); err == nil {
+			if len(batch) > nc.maxBatchSize {
+				return nil, ErrBatchTooLarge
+			}
+			return nc.handleBatch(req, body, batch)
+		}
+	}
+
+	if err := validateMessage(body); err != nil {
 		return nil, err
 	}
 
 	//get message from request body
 	message := JSONRPCMessage{}
-	if err := json.Unmarshal(body, &message); err == nil {
-		cacheResp, respErr := nc.GetCacheResponse(message)
-		if respErr == nil {
-			return cacheResp, nil
+	if err := json.Unmarshal(body, &message); err != nil {
+		if nc.audit != nil {
+			if isBatchBody(body) {
+				nc.audit.Record(auditBatchMethod, nil)
+			} else {
+				nc.audit.Record(auditInvalidMethod, nil)
+			}
+		}
+		return nc.proxy(req, body, message)
+	}
+
+	clientVersion := message.Version
+	if clientVersion != jsonRPCVersion {
+		if nc.versionMode == VersionModeStrict {
+			return nil, ErrInvalidVersion
 		}
+		body = withJSONRPCVersion(body, jsonRPCVersion)
+		message.Version = jsonRPCVersion
+	}
+	resp, err := nc.handleMessage(req, body, message)
+	if err != nil || clientVersion == jsonRPCVersion {
+		return resp, err
 	}
+	// echo back the version sent by client
+	resp.Body = withJSONRPCVersion(resp.Body, clientVersion)
+	return resp, nil
+}
 
+// handleMessage serve a single JSON-RPC message from cache or node
+func (nc *NodeCache) handleMessage(req *http.Request, body []byte, message JSONRPCMessage) (*ProxyResponse, error) {
+	// node is still called with the original body
+	message.Params = nc.canonicalParams(message.Method, message.Params)
+	if maxAge, ok := cacheMaxAge(req.Header); ok && nc.canBypass(req) && !nc.freshEnough(message, maxAge) {
+		return nc.bypassCache(req, body, message)
+	}
+	if chain, ok := nc.fallbacks[message.Method]; ok {
+		return nc.handleFallback(req, body, message, chain)
+	}
+	cacheResp, respErr := nc.getCachedResponse(message)
+	if respErr == nil {
+		if cacheResp.CacheStatus == CacheStatusStale {
+			nc.revalidate(message)
+		}
+		nc.checkStaleSLO(message.Method, cacheResp)
+		nc.metrics.Incr("cache_hits_total", map[string]string{"method": nc.metricMethod(message.Method)})
+		return cacheResp, nil
+	}
+	nc.metrics.Incr("cache_misses_total", map[string]string{"method": nc.metricMethod(message.Method)})
+	if nc.audit != nil {
+		nc.audit.Record(message.Method, message.Params)
+	}
+	resp, err := nc.proxy(req, body, message)
+	if err == nil {
+		nc.cacheParamResponse(req, message, resp)
+	}
+	return resp, err
+}
+
+// proxy forward the request body to node
+func (nc *NodeCache) proxy(req *http.Request, body []byte, message JSONRPCMessage) (*ProxyResponse, error) {
+	if !nc.coldStart.allow(time.Now(), nc.warmup.progress().Ready) {
+		nc.metrics.Incr("cold_start_throttled_total", map[string]string{"method": nc.metricMethod(message.Method)})
+		return nil, ErrColdStartThrottled
+	}
 	// reassign again
 	req.Body = ioutil.NopCloser(bytes.NewReader(body))
 
 	proxyReq, err := nc.cloneRequest(req)
 	if err != nil {
-		log.Println(err)
+		nc.logger.Error("copying client request failed", logFields(req.Context(), logger.Fields{"method": message.Method, "error": err}))
 		return nil, err
 	}
 
-	return nc.callMethod(proxyReq)
+	// stop calling node when client is gone
+	body, err = nc.callShared(req, body, message, proxyReq)
+	if upstreamErr, ok := err.(*UpstreamError); ok && upstreamErr.Category() == CategoryRPCError {
+		// errors of the call itself, e.g. a reverted eth_call, are answered to the client
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ProxyResponse{Body: body, CacheStatus: CacheStatusMiss, CacheKey: cacheKey(message)}, nil
 }
 
-// cloneRequest
+// cloneRequest copy req to send it to node, with the client headers of FORWARD_HEADERS
 func (nc *NodeCache) cloneRequest(req *http.Request) (*http.Request, error) {
 	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		log.Print(err)
+		nc.logger.Error("reading request body failed", logFields(req.Context(), logger.Fields{"error": err}))
 		return nil, err
 	}
 
-	proxyReq, err := http.NewRequest(req.Method, os.Getenv("NODE_ENDPOINT"), bytes.NewReader(body))
+	body, compressed := nc.requestCompression.compress(body)
+	proxyReq, err := http.NewRequest(req.Method, nc.endpoints.primary(), bytes.NewReader(body))
 	if err != nil {
-		log.Print(err)
+		nc.logger.Error("creating request failed", logFields(req.Context(), logger.Fields{"endpoint": nc.endpoints.primary(), "error": err}))
 		return nil, err
 	}
-
-	proxyReq.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_11_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/56.0.2924.87 Safari/537.36")
-
+	if compressed {
+		proxyReq.Header.Set("Content-Encoding", "gzip")
+	}
+	forwardHeaders(nc.forwardHeaders, req.Header, proxyReq.Header)
+	if id := RequestID(req.Context()); id != "" {
+		proxyReq.Header.Set(RequestIDHeader, id)
+	}
 	return proxyReq, nil
 }
@@ -0,0 +1,1922 @@
+package node
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KyberNetwork/cache/logger"
+	"github.com/KyberNetwork/cache/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+// newTestNode start a fake node and point NODE_ENDPOINT to it
+func newTestNode(handler http.HandlerFunc) *httptest.Server {
+	server := httptest.NewServer(handler)
+	os.Setenv("NODE_ENDPOINT", server.URL)
+	return server
+}
+
+func newTestRequest(body string) *http.Request {
+	req, _ := http.NewRequest("POST", "/node", bytes.NewReader([]byte(body)))
+	return req
+}
+
+func TestNewNodeCacheEndpoint(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer server.Close()
+	os.Setenv("NODE_ENDPOINT", "http://127.0.0.1:1")
+
+	nc, err := NewNodeCache(server.URL)
+	assert.Nil(t, err)
+	resp, err := nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_getCode","params":["0xabc","latest"]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":"0x1"}`, string(resp.Body))
+	assert.Equal(t, 1, calls)
+}
+
+func TestHandleRequestRejectOversizedBatch(t *testing.T) {
+	upstreamCalls := 0
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.maxBatchSize = 2
+
+	batch := `[{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"},{"jsonrpc":"2.0","id":2,"method":"eth_blockNumber"},{"jsonrpc":"2.0","id":3,"method":"eth_blockNumber"}]`
+	_, err = nc.HandleRequest(newTestRequest(batch))
+	assert.Equal(t, ErrBatchTooLarge, err)
+	assert.Equal(t, 0, upstreamCalls)
+
+	batch = `[{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"},{"jsonrpc":"2.0","id":2,"method":"eth_blockNumber"}]`
+	resp, err := nc.HandleRequest(newTestRequest(batch))
+	assert.Nil(t, err)
+	assert.Equal(t, batch, string(resp.Body))
+	assert.Equal(t, 1, upstreamCalls)
+}
+
+func TestHandleRequestBatchPartialHit(t *testing.T) {
+	var upstreamBody string
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		upstreamBody = string(body)
+		// answered out of order
+		w.Write([]byte(`[{"jsonrpc":"2.0","id":3,"result":"0x3"},{"jsonrpc":"2.0","id":1,"result":"0x1"}]`))
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.SetCacheResponse("eth_gasPrice", JSONRPCResponse{Version: "2.0", Result: "0x2"})
+
+	batch := `[{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"},{"jsonrpc":"2.0","id":2,"method":"eth_gasPrice"},{"jsonrpc":"2.0","id":3,"method":"eth_chainId"}]`
+	resp, err := nc.HandleRequest(newTestRequest(batch))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusPartial, resp.CacheStatus)
+	assert.Equal(t, `[{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"},{"jsonrpc":"2.0","id":3,"method":"eth_chainId"}]`, upstreamBody)
+	assert.JSONEq(t, `[{"jsonrpc":"2.0","id":1,"result":"0x1"},{"jsonrpc":"2.0","id":2,"result":"0x2"},{"jsonrpc":"2.0","id":3,"result":"0x3"}]`, string(resp.Body))
+
+	// all members cached, node is not called
+	upstreamBody = ""
+	resp, err = nc.HandleRequest(newTestRequest(`[{"jsonrpc":"2.0","id":7,"method":"eth_gasPrice"}]`))
+	assert.Nil(t, err)
+	assert.True(t, resp.Cached)
+	assert.Equal(t, "", upstreamBody)
+	assert.JSONEq(t, `[{"jsonrpc":"2.0","id":7,"result":"0x2"}]`, string(resp.Body))
+}
+
+func TestHandleRequestCacheStatus(t *testing.T) {
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.SetCacheResponse("eth_gasPrice", JSONRPCResponse{Version: "2.0", Result: "0x2"})
+
+	resp, err := nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusHit, resp.CacheStatus)
+	assert.Equal(t, "eth_gasPrice", resp.CacheKey)
+
+	nc.mu.Lock()
+	entry := nc.cacheResponse[nc.keyHash("eth_gasPrice")]
+	entry.updatedAt = entry.updatedAt.Add(-time.Minute)
+	nc.cacheResponse[nc.keyHash("eth_gasPrice")] = entry
+	nc.mu.Unlock()
+	resp, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusStale, resp.CacheStatus)
+
+	resp, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusMiss, resp.CacheStatus)
+}
+
+func TestHandleRequestFallbackChain(t *testing.T) {
+	nodeDown := false
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		if nodeDown {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.fallbacks = map[string]fallbackChain{
+		"eth_gasPrice": parseFallbackChain("cache|proxy|stale|static", logger.Default()),
+	}
+	nc.staticDefaults = map[string]json.RawMessage{"eth_gasPrice": json.RawMessage(`"0x3b9aca00"`)}
+	request := `{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice"}`
+
+	// no cache, node is up
+	resp, err := nc.HandleRequest(newTestRequest(request))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusMiss, resp.CacheStatus)
+
+	// no cache, node is down
+	nodeDown = true
+	resp, err = nc.HandleRequest(newTestRequest(request))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusStatic, resp.CacheStatus)
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":"0x3b9aca00"}`, string(resp.Body))
+
+	// fresh cache
+	nc.SetCacheResponse("eth_gasPrice", JSONRPCResponse{Version: "2.0", Result: "0x2"})
+	resp, err = nc.HandleRequest(newTestRequest(request))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusHit, resp.CacheStatus)
+
+	// stale cache, node is down
+	nc.mu.Lock()
+	entry := nc.cacheResponse[nc.keyHash("eth_gasPrice")]
+	entry.updatedAt = entry.updatedAt.Add(-time.Minute)
+	nc.cacheResponse[nc.keyHash("eth_gasPrice")] = entry
+	nc.mu.Unlock()
+	resp, err = nc.HandleRequest(newTestRequest(request))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusStale, resp.CacheStatus)
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":"0x2"}`, string(resp.Body))
+
+	// every step disabled but the node
+	nc.fallbacks["eth_gasPrice"] = parseFallbackChain("proxy", logger.Default())
+	_, err = nc.HandleRequest(newTestRequest(request))
+	assert.NotNil(t, err)
+}
+
+// countingSink count Incr calls by metric name, safe for concurrent calls
+type countingSink struct {
+	metrics.NoopSink
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (s *countingSink) Incr(name string, tags map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[name]++
+}
+
+func TestRecordChurn(t *testing.T) {
+	sink := &countingSink{counts: make(map[string]int)}
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.metrics = sink
+
+	nc.recordChurn("eth_gasPrice", JSONRPCResponse{Result: "0x1"})
+	nc.SetCacheResponse("eth_gasPrice", JSONRPCResponse{Result: "0x1"})
+	nc.recordChurn("eth_gasPrice", JSONRPCResponse{Result: "0x1"})
+	assert.Equal(t, 0, sink.counts["cache_value_changed_total"])
+
+	nc.recordChurn("eth_gasPrice", JSONRPCResponse{Result: "0x2"})
+	assert.Equal(t, 1, sink.counts["cache_value_changed_total"])
+}
+
+// rawParams params of a message from their JSON
+func rawParams(params ...string) []json.RawMessage {
+	result := make([]json.RawMessage, 0, len(params))
+	for _, param := range params {
+		result = append(result, json.RawMessage(param))
+	}
+	return result
+}
+
+func TestCanonicalParams(t *testing.T) {
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	tests := []struct {
+		method, params, canonical string
+	}{
+		{"eth_getBalance", `["0x2262D4F6312805851E3b27c40db2c7282E6e4a42","Latest"]`, `["0x2262d4f6312805851e3b27c40db2c7282e6e4a42","latest"]`},
+		{"eth_getBlockByNumber", `["0x00", true]`, `["0x0",true]`},
+		{"eth_getBlockByNumber", `["LATEST","True"]`, `["latest",true]`},
+		{"eth_getBlockTransactionCountByNumber", `["0x0001","0x0A"]`, `["0x1","0x0A"]`},
+		{"eth_getBalance", `["0xABC",{"blockHash":"0xDEF"}]`, `["0xabc",{"blockHash":"0xdef"}]`},
+		{"eth_call", `[{"to":"0xABC","data":"0xA9059CBB","value":"0x00"},"latest"]`, `[{"data":"0xa9059cbb","to":"0xabc","value":"0x0"},"latest"]`},
+		{"eth_call", `[{ "value": "0x0",  "to": "0xabc" }, "latest"]`, `[{"to":"0xabc","value":"0x0"},"latest"]`},
+		{"eth_unknown", `["0x00", {"b": 1, "a": 2}]`, `["0x00",{"b":1,"a":2}]`},
+	}
+	for _, test := range tests {
+		message := JSONRPCMessage{}
+		assert.Nil(t, json.Unmarshal([]byte(`{"method":"`+test.method+`","params":`+test.params+`}`), &message))
+		assert.Equal(t, test.method+test.canonical, cacheKey(JSONRPCMessage{Method: test.method, Params: nc.canonicalParams(test.method, message.Params)}), test.params)
+	}
+}
+
+func TestCanonicalEmptyParams(t *testing.T) {
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.audit = newProxyAudit(defaultAuditMaxMethods, defaultAuditMaxParams)
+
+	variants := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[]}`,
+		`{"jsonrpc":"2.0","id":1,"method":"eth_call","params":null}`,
+		`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`,
+	}
+	for _, body := range variants {
+		explain, err := nc.Explain([]byte(body))
+		assert.Nil(t, err)
+		assert.Nil(t, explain.Params, body)
+		assert.Equal(t, "eth_call", explain.CacheKey, body)
+		assert.Equal(t, nc.keyHash("eth_call"), explain.CacheKeyHash, body)
+
+		_, err = nc.HandleRequest(newTestRequest(body))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, []ProxyAuditEntry{{Method: "eth_call", Count: 3, UniqueParams: 1}}, nc.audit.Snapshot())
+}
+
+func TestExplain(t *testing.T) {
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.SetCacheResponse("eth_gasPrice", JSONRPCResponse{Version: "2.0", Result: "0x2"})
+
+	explain, err := nc.Explain([]byte(`{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "eth_gasPrice", explain.CacheKey)
+	assert.Equal(t, nc.keyHash("eth_gasPrice"), explain.CacheKeyHash)
+	assert.True(t, explain.Cached)
+
+	explain, err = nc.Explain([]byte(`{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":["0xABC","Latest"]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, rawParams(`"0xabc"`, `"latest"`), explain.Params)
+	assert.False(t, explain.Cached)
+
+	_, err = nc.Explain([]byte(`[{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice"}]`))
+	assert.NotNil(t, err)
+}
+
+func TestParseCacheMethodsDuplicate(t *testing.T) {
+	_, err := parseCacheMethods("eth_gasPrice:10,eth_blockNumber,eth_gasPrice:5", duplicatePolicyError, logger.Default())
+	assert.NotNil(t, err)
+
+	methods, err := parseCacheMethods("eth_gasPrice:10,eth_blockNumber,eth_gasPrice:5", duplicatePolicyMerge, logger.Default())
+	assert.Nil(t, err)
+	assert.Equal(t, []methodConfig{
+		{method: "eth_gasPrice", interval: 5 * time.Second},
+		{method: "eth_blockNumber", interval: defaultCacheInterval},
+	}, methods)
+
+	_, err = parseCacheMethods("eth_gasPrice:abc", duplicatePolicyError, logger.Default())
+	assert.NotNil(t, err)
+}
+
+func TestHandleRequestStaleSLO(t *testing.T) {
+	sink := &countingSink{counts: make(map[string]int)}
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.metrics = sink
+	nc.staleSLOs = map[string]time.Duration{"eth_gasPrice": 30 * time.Second}
+	nc.SetCacheResponse("eth_gasPrice", JSONRPCResponse{Version: "2.0", Result: "0x2"})
+	request := `{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice"}`
+
+	resp, err := nc.HandleRequest(newTestRequest(request))
+	assert.Nil(t, err)
+	assert.False(t, resp.SLOViolated)
+
+	nc.mu.Lock()
+	entry := nc.cacheResponse[nc.keyHash("eth_gasPrice")]
+	entry.updatedAt = entry.updatedAt.Add(-time.Minute)
+	nc.cacheResponse[nc.keyHash("eth_gasPrice")] = entry
+	nc.mu.Unlock()
+	resp, err = nc.HandleRequest(newTestRequest(request))
+	assert.Nil(t, err)
+	assert.True(t, resp.SLOViolated)
+	assert.Equal(t, 1, sink.counts["cache_stale_slo_violations_total"])
+}
+
+func TestHandleRequestVersionMode(t *testing.T) {
+	var upstreamBody string
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		upstreamBody = string(body)
+		w.Write([]byte(`{"id":1,"jsonrpc":"2.0","result":"0x1"}`))
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+
+	// lenient, node gets 2.0 and client gets its own version back
+	resp, err := nc.HandleRequest(newTestRequest(`{"jsonrpc":"1.0","id":1,"method":"eth_chainId"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":1,"jsonrpc":"2.0","method":"eth_chainId"}`, upstreamBody)
+	assert.Equal(t, `{"id":1,"jsonrpc":"1.0","result":"0x1"}`, string(resp.Body))
+
+	resp, err = nc.HandleRequest(newTestRequest(`{"id":1,"method":"eth_chainId"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":1,"result":"0x1"}`, string(resp.Body))
+
+	nc.versionMode = VersionModeStrict
+	_, err = nc.HandleRequest(newTestRequest(`{"id":1,"method":"eth_chainId"}`))
+	assert.Equal(t, ErrInvalidVersion, err)
+	_, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+	assert.Nil(t, err)
+}
+
+func TestHandleRequestInvalidRequest(t *testing.T) {
+	calls := 0
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"id":1,"jsonrpc":"2.0","result":"0x1"}`))
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","id":1}`,
+		`{"jsonrpc":"2.0","id":1,"method":""}`,
+		`{"jsonrpc":"2.0","id":1,"method":1}`,
+		`"eth_chainId"`,
+		`[{"jsonrpc":"2.0","id":1,"method":"eth_chainId"},{"jsonrpc":"2.0","id":2}]`,
+	} {
+		_, err = nc.HandleRequest(newTestRequest(body))
+		assert.Equal(t, ErrInvalidRequest, err, body)
+	}
+	assert.Equal(t, 0, calls)
+
+	// members of a batch are validated before any is sent
+	nc.versionMode = VersionModeStrict
+	_, err = nc.HandleRequest(newTestRequest(`[{"jsonrpc":"2.0","id":1,"method":"eth_chainId"},{"jsonrpc":"1.0","id":2,"method":"eth_chainId"}]`))
+	assert.Equal(t, ErrInvalidVersion, err)
+	assert.Equal(t, 0, calls)
+}
+
+func TestCacheKeyHash(t *testing.T) {
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {})
+	defer node.Close()
+	defer os.Unsetenv("CACHE_KEY_HASH")
+
+	first := JSONRPCMessage{Method: "eth_getBalance", Params: rawParams(`"0x1"`, `"latest"`)}
+	second := JSONRPCMessage{Method: "eth_getBalance", Params: rawParams(`"0x2"`, `"latest"`)}
+	for name, size := range map[string]int{KeyHashXXHash: 16, KeyHashFNV: 16, KeyHashSHA256: 64} {
+		os.Setenv("CACHE_KEY_HASH", name)
+		nc, err := NewNodeCache("")
+		assert.Nil(t, err)
+		nc.SetCacheMessageResponse(first, JSONRPCResponse{Version: "2.0", Result: "0x10"})
+		nc.SetCacheMessageResponse(second, JSONRPCResponse{Version: "2.0", Result: "0x20"})
+
+		// entries are stored under the hash of the key only
+		assert.Len(t, nc.cacheResponse, 2, name)
+		for key := range nc.cacheResponse {
+			assert.Len(t, key, size, name)
+		}
+		resp, err := nc.getCachedResponse(first)
+		assert.Nil(t, err)
+		assert.Contains(t, string(resp.Body), "0x10", name)
+		assert.Equal(t, `eth_getBalance["0x1","latest"]`, resp.CacheKey, name)
+		resp, err = nc.getCachedResponse(second)
+		assert.Nil(t, err)
+		assert.Contains(t, string(resp.Body), "0x20", name)
+		nc.Close()
+	}
+
+	os.Setenv("CACHE_KEY_HASH", "md5")
+	_, err := NewNodeCache("")
+	assert.NotNil(t, err)
+
+	// keys whose hashes collide share one entry
+	os.Unsetenv("CACHE_KEY_HASH")
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+	nc.keyHash = func(key string) string { return "collision" }
+	nc.SetCacheMessageResponse(first, JSONRPCResponse{Version: "2.0", Result: "0x10"})
+	nc.SetCacheMessageResponse(second, JSONRPCResponse{Version: "2.0", Result: "0x20"})
+	resp, err := nc.getCachedResponse(first)
+	assert.Nil(t, err)
+	assert.Contains(t, string(resp.Body), "0x20")
+}
+
+// typical eth_call key, method with call object and block
+const benchmarkKey = `eth_call["{\"to\":\"0x818e6fecd516ecc3849daf6845e3ec868087b755\",\"data\":\"0x809a9e55000000000000000000000000eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee000000000000000000000000dd974d5c2e2928dea5f71b9825b8b646686bd2000000000000000000000000000000000000000000000000000de0b6b3a7640000\"}","latest"]`
+
+func benchmarkKeyHash(b *testing.B, name string) {
+	hasher := keyHashers[name]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		hasher(benchmarkKey)
+	}
+}
+
+func BenchmarkKeyHashXXHash(b *testing.B) { benchmarkKeyHash(b, KeyHashXXHash) }
+func BenchmarkKeyHashFNV(b *testing.B)    { benchmarkKeyHash(b, KeyHashFNV) }
+func BenchmarkKeyHashSHA256(b *testing.B) { benchmarkKeyHash(b, KeyHashSHA256) }
+
+func TestHandleRequestCompressUpstreamBody(t *testing.T) {
+	var encodings []string
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			body, _ = gzip.NewReader(r.Body)
+		}
+		data, _ := ioutil.ReadAll(body)
+		w.Write(data)
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.requestCompression = &requestCompression{minSize: 100}
+
+	small := `{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`
+	large := `{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":["0x2262d4f6312805851e3b27c40db2c7282e6e4a42","0x2262d4f6312805851e3b27c40db2c7282e6e4a42"]}`
+	_, err = nc.HandleRequest(newTestRequest(small))
+	assert.Nil(t, err)
+	resp, err := nc.HandleRequest(newTestRequest(large))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"", "gzip"}, encodings)
+	assert.Equal(t, large, string(resp.Body))
+}
+
+func TestCloseCancelsInFlightUpstreamCall(t *testing.T) {
+	started := make(chan struct{}, 10)
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		// request context is only cancelled on client disconnect once body is read
+		ioutil.ReadAll(r.Body)
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	})
+	defer node.Close()
+
+	os.Setenv("CACHE_METHODS", "eth_gasPrice")
+	defer os.Unsetenv("CACHE_METHODS")
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker did not call node")
+	}
+	start := time.Now()
+	nc.Close()
+	assert.True(t, time.Since(start) < time.Second, "Close waited for the upstream call")
+}
+
+func TestRefreshBlockNumberDetectReorg(t *testing.T) {
+	head := `{"number":"0x64","hash":"0xa100","parentHash":"0xa099"}`
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + head + `}`))
+	})
+	defer node.Close()
+
+	sink := &countingSink{counts: make(map[string]int)}
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.metrics = sink
+
+	assert.Nil(t, nc.refreshBlockNumber())
+	assert.Equal(t, uint64(100), nc.LatestBlock())
+	nc.SetCacheResponse("eth_gasPrice", JSONRPCResponse{Result: "0x1"})
+
+	// next block on top of the same chain
+	head = `{"number":"0x65","hash":"0xa101","parentHash":"0xa100"}`
+	assert.Nil(t, nc.refreshBlockNumber())
+	assert.Equal(t, 0, sink.counts["chain_reorgs_total"])
+
+	// block 101 is replaced by a block of another branch
+	head = `{"number":"0x65","hash":"0xb101","parentHash":"0xa100"}`
+	assert.Nil(t, nc.refreshBlockNumber())
+	assert.Equal(t, 1, sink.counts["chain_reorgs_total"])
+	_, err = nc.GetCacheResponse(JSONRPCMessage{Method: "eth_gasPrice"})
+	assert.NotNil(t, err)
+
+	// tip goes back
+	head = `{"number":"0x63","hash":"0xb099","parentHash":"0xb098"}`
+	assert.Nil(t, nc.refreshBlockNumber())
+	assert.Equal(t, 2, sink.counts["chain_reorgs_total"])
+	assert.Equal(t, uint64(99), nc.LatestBlock())
+}
+
+func TestNodeInfo(t *testing.T) {
+	upstreamCalls := 0
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		message := JSONRPCMessage{}
+		json.NewDecoder(r.Body).Decode(&message)
+		results := map[string]string{
+			"web3_clientVersion": `"Geth/v1.13.5-stable"`,
+			"eth_chainId":        `"0x1"`,
+			"net_version":        `"1"`,
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + results[message.Method] + `}`))
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	info := nc.NodeInfo()
+	assert.Equal(t, "Geth/v1.13.5-stable", info.ClientVersion)
+	assert.Equal(t, "0x1", info.ChainID)
+	assert.Equal(t, "1", info.NetworkID)
+	assert.Equal(t, 3, upstreamCalls)
+
+	// fetch-once methods are served from cache
+	resp, err := nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"web3_clientVersion"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusHit, resp.CacheStatus)
+	nc.NodeInfo()
+	assert.Equal(t, 3, upstreamCalls)
+}
+
+func TestWarmupProgress(t *testing.T) {
+	w := newWarmup([]methodConfig{{method: "eth_gasPrice"}, {method: "eth_blockNumber"}, {method: "eth_chainId"}, {method: "net_version"}})
+	assert.Equal(t, WarmupProgress{Total: 4, InProgress: 4}, w.progress())
+
+	w.done("eth_gasPrice", nil)
+	w.done("eth_blockNumber", errors.New("timeout"))
+	assert.Equal(t, WarmupProgress{Total: 4, Warmed: 1, Failed: 1, InProgress: 2, PercentComplete: 25}, w.progress())
+
+	// failed methods are retried, warmed methods stay warmed
+	w.done("eth_blockNumber", nil)
+	w.done("eth_gasPrice", errors.New("timeout"))
+	w.done("eth_chainId", nil)
+	w.done("net_version", nil)
+	assert.Equal(t, WarmupProgress{Total: 4, Warmed: 4, PercentComplete: 100, Ready: true}, w.progress())
+
+	assert.Equal(t, WarmupProgress{PercentComplete: 100, Ready: true}, newWarmup(nil).progress())
+}
+
+func TestWarmupWait(t *testing.T) {
+	w := newWarmup([]methodConfig{{method: "eth_gasPrice"}, {method: "eth_blockNumber"}})
+	w.done("eth_gasPrice", nil)
+	w.done("eth_blockNumber", errors.New("timeout"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, w.wait(ctx))
+
+	w.done("eth_blockNumber", nil)
+	w.done("eth_gasPrice", nil)
+	assert.Nil(t, w.wait(context.Background()))
+	assert.Nil(t, newWarmup(nil).wait(context.Background()))
+}
+
+func TestHandleRequestNonJSONResponse(t *testing.T) {
+	contentType := "text/html"
+	body := `<html><body>502 Bad Gateway</body></html>`
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(body))
+	})
+	defer node.Close()
+
+	sink := &countingSink{counts: make(map[string]int)}
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.metrics = sink
+	nc.fallbacks = map[string]fallbackChain{
+		"eth_gasPrice": parseFallbackChain("proxy|stale", logger.Default()),
+	}
+	request := `{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice"}`
+
+	// nothing to fall back to
+	_, err = nc.HandleRequest(newTestRequest(request))
+	assert.True(t, errors.Is(err, ErrNonJSONResponse))
+	assert.Equal(t, 1, sink.counts["upstream_non_json_total"])
+	assert.Equal(t, 1, sink.counts["upstream_errors_total"])
+
+	// stale value is served instead of the error page
+	nc.SetCacheResponse("eth_gasPrice", JSONRPCResponse{Version: "2.0", Result: "0x2"})
+	resp, err := nc.HandleRequest(newTestRequest(request))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusStale, resp.CacheStatus)
+
+	// JSON body with a wrong content type is only rejected when content type is checked
+	body = `{"jsonrpc":"2.0","id":1,"result":"0x1"}`
+	nc.fallbacks = nil
+	resp, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, body, string(resp.Body))
+	nc.responseCheck = ResponseCheckContentType
+	_, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+	assert.True(t, errors.Is(err, ErrNonJSONResponse))
+	contentType = "application/json; charset=utf-8"
+	_, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+	assert.Nil(t, err)
+}
+
+func TestMaxStaleAge(t *testing.T) {
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	defer node.Close()
+
+	os.Setenv("MAX_STALE_AGE", "eth_gasPrice:120")
+	defer os.Unsetenv("MAX_STALE_AGE")
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.fallbacks = map[string]fallbackChain{
+		"eth_gasPrice": parseFallbackChain("cache|proxy|stale", logger.Default()),
+	}
+	setAge := func(method string, age time.Duration) {
+		nc.SetCacheResponse(method, JSONRPCResponse{Version: "2.0", Result: "0x2"})
+		nc.mu.Lock()
+		entry := nc.cacheResponse[nc.keyHash(method)]
+		entry.updatedAt = time.Now().Add(-age)
+		nc.cacheResponse[nc.keyHash(method)] = entry
+		nc.mu.Unlock()
+	}
+
+	// fallback chain
+	setAge("eth_gasPrice", time.Minute)
+	resp, err := nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusStale, resp.CacheStatus)
+	setAge("eth_gasPrice", 3*time.Minute)
+	_, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice"}`))
+	assert.NotNil(t, err)
+
+	// methods without chain use the default max stale age
+	setAge("eth_blockNumber", 3*time.Minute)
+	resp, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusStale, resp.CacheStatus)
+	setAge("eth_blockNumber", time.Hour)
+	_, err = nc.GetCacheResponse(JSONRPCMessage{Method: "eth_blockNumber"})
+	assert.Equal(t, ErrStaleTooOld, err)
+	_, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+	assert.NotNil(t, err)
+}
+
+func TestUpstreamErrorLog(t *testing.T) {
+	l := newUpstreamErrorLog(2)
+	assert.Empty(t, l.recent())
+	l.add("eth_call", &UpstreamError{category: CategoryServerError, err: errors.New("a")})
+	l.add("eth_call", &UpstreamError{category: CategoryServerError, err: errors.New("b")})
+	l.add("eth_call", &UpstreamError{category: CategoryServerError, err: errors.New("c")})
+	recent := l.recent()
+	assert.Len(t, recent, 2)
+	assert.Equal(t, "b", recent[0].Error)
+	assert.Equal(t, "c", recent[1].Error)
+}
+
+func TestBundle(t *testing.T) {
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.intervals["eth_gasPrice"] = 10 * time.Second
+	nc.fallbacks = map[string]fallbackChain{"eth_gasPrice": parseFallbackChain("proxy|cache|stale", logger.Default())}
+	nc.SetCacheResponse("eth_gasPrice", JSONRPCResponse{Version: "2.0", Result: "0x2"})
+	nc.refreshMethod("eth_blockNumber")
+
+	assert.Equal(t,
+		MethodStatus{Method: "eth_gasPrice", IntervalSeconds: 10, Cached: true, CacheStatus: CacheStatusHit, Fallback: "cache|proxy|stale", MaxStaleSeconds: 600},
+		nc.methodStatus("eth_gasPrice"),
+	)
+	assert.Equal(t,
+		MethodStatus{Method: "eth_blockNumber", IntervalSeconds: 10, CacheStatus: CacheStatusMiss, MaxStaleSeconds: 600},
+		nc.methodStatus("eth_blockNumber"),
+	)
+
+	bundle := nc.Bundle()
+	assert.Equal(t, KeyHashXXHash, bundle.Config.KeyHash)
+	assert.Equal(t, VersionModeLenient, bundle.Config.VersionMode)
+	assert.Empty(t, bundle.Methods)
+	assert.Len(t, bundle.UpstreamErrors, 1)
+	assert.Equal(t, "eth_blockNumber", bundle.UpstreamErrors[0].Method)
+	assert.Equal(t, "Status code is 503", bundle.UpstreamErrors[0].Error)
+	assert.Nil(t, bundle.NodeInfo.ClientVersion)
+}
+
+func TestCallMethodErrorCategory(t *testing.T) {
+	status := http.StatusOK
+	body := `{"jsonrpc":"2.0","id":1,"result":"0x1"}`
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	category := func() ErrorCategory {
+		_, err := nc.fetchMethod("eth_gasPrice")
+		if err == nil {
+			return ""
+		}
+		return err.(*UpstreamError).Category()
+	}
+
+	assert.Equal(t, ErrorCategory(""), category())
+	status = http.StatusTooManyRequests
+	assert.Equal(t, CategoryRateLimited, category())
+	status = http.StatusBadGateway
+	assert.Equal(t, CategoryServerError, category())
+	status = http.StatusNotFound
+	assert.Equal(t, CategoryBadResponse, category())
+	status = http.StatusOK
+	body = `<html></html>`
+	assert.Equal(t, CategoryBadResponse, category())
+	body = `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"execution reverted"}}`
+	assert.Equal(t, CategoryRPCError, category())
+
+	// JSON-RPC errors are still answered to the client
+	resp, err := nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, body, string(resp.Body))
+	_, err = nc.GetCacheResponse(JSONRPCMessage{Method: "eth_call"})
+	assert.NotNil(t, err)
+
+	// httptest only closes idle connections of http.DefaultTransport, the pooled one
+	// would fail on the closed connection instead of dialing
+	nc.client.Transport.(*http.Transport).CloseIdleConnections()
+	node.Close()
+	assert.Equal(t, CategoryConnRefused, category())
+}
+
+func TestColdStartThrottle(t *testing.T) {
+	now := time.Now()
+	os.Setenv("COLD_START_WINDOW", "60")
+	os.Setenv("COLD_START_PROXY_RATE", "2")
+	defer os.Unsetenv("COLD_START_WINDOW")
+	defer os.Unsetenv("COLD_START_PROXY_RATE")
+	throttle := newColdStartThrottleFromEnv(now)
+
+	assert.True(t, throttle.allow(now, false))
+	assert.True(t, throttle.allow(now, false))
+	assert.False(t, throttle.allow(now, false))
+	// not throttled once warm
+	assert.True(t, throttle.allow(now, true))
+	// tokens refill at rate
+	assert.True(t, throttle.allow(now.Add(500*time.Millisecond), false))
+	assert.False(t, throttle.allow(now.Add(500*time.Millisecond), false))
+	// not throttled after the window
+	assert.True(t, throttle.allow(now.Add(time.Minute), false))
+
+	var disabled *coldStartThrottle
+	assert.True(t, disabled.allow(now, false))
+}
+
+func TestHandleNodeRequestProductionBatch(t *testing.T) {
+	calls := 0
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`[{"jsonrpc":"2.0","id":1,"result":"0x1"},{"jsonrpc":"2.0","id":2,"result":"0x2"}]`))
+	})
+	defer node.Close()
+
+	os.Setenv("KYBER_ENV", "production")
+	defer os.Unsetenv("KYBER_ENV")
+	defer func(methods []string) { banMethod = methods }(banMethod)
+	banMethod = []string{"eth_getBlockByNumber"}
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+	n := &NodeMiddleware{nodeCache: nc}
+	serve := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = newTestRequest(body)
+		c.Request.Header.Set("Origin", "https://kyberswap.com")
+		n.HandleNodeRequest(c)
+		return w
+	}
+
+	w := serve(`[{"jsonrpc":"2.0","id":1,"method":"eth_getCode","params":["0x1","latest"]},{"jsonrpc":"2.0","id":2,"method":"eth_getCode","params":["0x2","latest"]}]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"jsonrpc":"2.0","id":1,"result":"0x1"},{"jsonrpc":"2.0","id":2,"result":"0x2"}]`, w.Body.String())
+	assert.Equal(t, 1, calls)
+
+	// a banned method is rejected alone or as a member of a batch
+	w = serve(`[{"jsonrpc":"2.0","id":1,"method":"eth_getCode","params":["0x1","latest"]},{"jsonrpc":"2.0","id":2,"method":"eth_getBlockByNumber","params":["latest",false]}]`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"err":"Method is not allowed"}`, w.Body.String())
+	w = serve(`{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["latest",false]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 1, calls)
+
+	// malformed bodies get the JSON-RPC parse error
+	w = serve(`[{"jsonrpc":"2.0","id":1,"method":`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"request body is not valid JSON"}}`, w.Body.String())
+	assert.Equal(t, 1, calls)
+}
+
+// countingReader count the bytes read from r
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestHandleNodeRequestProductionTooLarge(t *testing.T) {
+	calls := 0
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	})
+	defer node.Close()
+
+	os.Setenv("KYBER_ENV", "production")
+	defer os.Unsetenv("KYBER_ENV")
+	os.Setenv("MAX_REQUEST_BYTES", "100")
+	defer os.Unsetenv("MAX_REQUEST_BYTES")
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+	n := &NodeMiddleware{nodeCache: nc}
+
+	// the filter stops reading at the limit
+	body := &countingReader{r: strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"eth_call","params":["` + strings.Repeat("0", 1<<20) + `"]}`)}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newTestRequest("")
+	c.Request.Body = ioutil.NopCloser(body)
+	c.Request.Header.Set("Origin", "https://kyberswap.com")
+	n.HandleNodeRequest(c)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"request body is too large"}}`, w.Body.String())
+	assert.True(t, body.read <= 101+bytes.MinRead, body.read)
+	assert.Equal(t, 0, calls)
+}
+
+func TestHandleNodeRequestMalformed(t *testing.T) {
+	calls := 0
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x"}`))
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+	n := &NodeMiddleware{nodeCache: nc}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newTestRequest(`{"jsonrpc":"2.0","id":1,"method":`)
+	n.HandleNodeRequest(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"request body is not valid JSON"}}`, w.Body.String())
+	assert.Equal(t, 0, calls)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_getCode","params":["0x1","latest"]}`)
+	n.HandleNodeRequest(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":"0x"}`, w.Body.String())
+}
+
+func TestHandleRequestColdStartThrottled(t *testing.T) {
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.warmup = newWarmup([]methodConfig{{method: "eth_gasPrice"}})
+	nc.coldStart = &coldStartThrottle{until: time.Now().Add(time.Minute), rate: 1, tokens: 1, last: time.Now()}
+	nc.fallbacks = map[string]fallbackChain{"eth_gasPrice": parseFallbackChain("proxy|static", logger.Default())}
+	nc.staticDefaults = map[string]json.RawMessage{"eth_gasPrice": json.RawMessage(`"0x3b9aca00"`)}
+
+	_, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+	assert.Nil(t, err)
+	_, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+	assert.Equal(t, ErrColdStartThrottled, err)
+
+	// the fallback chain goes on when the proxy step is throttled
+	resp, err := nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusStatic, resp.CacheStatus)
+
+	nc.warmup.done("eth_gasPrice", nil)
+	_, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+	assert.Nil(t, err)
+}
+
+func TestNewNodeCacheWithIntervals(t *testing.T) {
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	})
+	defer node.Close()
+
+	os.Setenv("CACHE_METHODS", "eth_blockNumber,eth_gasPrice:30,net_version")
+	defer os.Unsetenv("CACHE_METHODS")
+	nc, err := NewNodeCacheWithIntervals("", map[string]time.Duration{
+		"net_version":  time.Hour,
+		"eth_getLogs":  time.Minute,
+		"eth_gasPrice": 0,
+	})
+	assert.Nil(t, err)
+	defer nc.Close()
+
+	assert.Equal(t, []methodConfig{
+		{method: "eth_blockNumber", interval: defaultCacheInterval},
+		{method: "eth_gasPrice", interval: 30 * time.Second},
+		{method: "net_version", interval: time.Hour},
+	}, nc.methods)
+	assert.Equal(t, time.Hour, nc.interval("net_version"))
+	// only methods of CACHE_METHODS are cached
+	assert.Equal(t, defaultCacheInterval, nc.interval("eth_getLogs"))
+	assert.Equal(t, []CachedMethod{
+		{Method: "eth_blockNumber", IntervalSeconds: 10},
+		{Method: "eth_gasPrice", IntervalSeconds: 30},
+		{Method: "net_version", IntervalSeconds: 3600},
+	}, nc.CachedMethods())
+}
+
+func TestCacheKeyWithParams(t *testing.T) {
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0xnode"}`))
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	first := JSONRPCMessage{Method: "eth_getBalance", Params: rawParams(`"0xaaa"`, `"latest"`)}
+	second := JSONRPCMessage{Method: "eth_getBalance", Params: rawParams(`"0xbbb"`, `"latest"`)}
+	assert.Equal(t, `eth_getBalance["0xaaa","latest"]`, cacheKey(first))
+	assert.NotEqual(t, cacheKey(first), cacheKey(second))
+	assert.Equal(t, "eth_gasPrice", cacheKey(JSONRPCMessage{Method: "eth_gasPrice"}))
+
+	nc.SetCacheMessageResponse(first, JSONRPCResponse{Version: "2.0", Result: "0x1"})
+	nc.SetCacheMessageResponse(second, JSONRPCResponse{Version: "2.0", Result: "0x2"})
+	assert.Len(t, nc.cacheResponse, 2)
+
+	resp, err := nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":["0xAAA","latest"]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusHit, resp.CacheStatus)
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":"0x1"}`, string(resp.Body))
+	resp, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":["0xbbb","latest"]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":"0x2"}`, string(resp.Body))
+
+	// the entry of a method without params is not served for calls with params
+	nc.SetCacheResponse("eth_getBalance", JSONRPCResponse{Version: "2.0", Result: "0x3"})
+	resp, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":["0xccc","latest"]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusMiss, resp.CacheStatus)
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":"0xnode"}`, string(resp.Body))
+}
+
+func TestJSONRPCErrorNotCached(t *testing.T) {
+	errorBody := `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"header not found","data":"0x"}}`
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(errorBody))
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	assert.NotNil(t, nc.refreshMethod("eth_gasPrice"))
+	nc.SetCacheResponse("eth_gasPrice", JSONRPCResponse{Version: "2.0", Error: &JSONRPCError{Code: -32000, Message: "header not found"}})
+	assert.Len(t, nc.cacheResponse, 0)
+
+	resp, err := nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusMiss, resp.CacheStatus)
+	assert.Equal(t, errorBody, string(resp.Body))
+}
+
+func TestNodeTimeout(t *testing.T) {
+	release := make(chan struct{})
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+	})
+	defer node.Close()
+	defer close(release)
+
+	nc, err := NewNodeCache("", WithTimeout(50*time.Millisecond))
+	assert.Nil(t, err)
+	start := time.Now()
+	_, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_getCode","params":["0xabc","latest"]}`))
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	upstreamErr, ok := err.(*UpstreamError)
+	assert.True(t, ok)
+	assert.Equal(t, CategoryTimeout, upstreamErr.Category())
+}
+
+func TestForwardHeaders(t *testing.T) {
+	var upstream http.Header
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		upstream = r.Header
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x"}`))
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+
+	req := newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_getCode","params":["0x1","latest"]}`)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Api-Key", "key")
+	req.Header.Set("Cookie", "session=1")
+	req = req.WithContext(WithRequestID(req.Context(), "req-1"))
+	_, err = nc.HandleRequest(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "req-1", upstream.Get(RequestIDHeader))
+	assert.Equal(t, "Bearer secret", upstream.Get("Authorization"))
+	assert.Equal(t, "key", upstream.Get("X-Api-Key"))
+	assert.Equal(t, "", upstream.Get("Cookie"))
+	assert.Equal(t, defaultUserAgent, upstream.Get("User-Agent"))
+
+	req = newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_getCode","params":["0x1","latest"]}`)
+	req.Header.Set("User-Agent", "web3.js")
+	nc.forwardHeaders = []string{}
+	req.Header.Set("Authorization", "Bearer secret")
+	_, err = nc.HandleRequest(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "", upstream.Get("Authorization"))
+	assert.Equal(t, "web3.js", upstream.Get("User-Agent"))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(2, time.Minute)
+	assert.True(t, b.allow(now))
+	assert.False(t, b.done(now, false, true))
+	assert.Equal(t, CircuitClosed, b.State())
+	// cancelled calls do not count
+	assert.False(t, b.done(now, false, false))
+	assert.True(t, b.done(now, false, true))
+	assert.Equal(t, CircuitOpen, b.State())
+	assert.False(t, b.allow(now.Add(time.Second)))
+	assert.Equal(t, 59*time.Second, b.retryAfter(now.Add(time.Second)))
+
+	// a single probe after the cooldown, failing opens again
+	assert.True(t, b.allow(now.Add(time.Minute)))
+	assert.Equal(t, CircuitHalfOpen, b.State())
+	assert.False(t, b.allow(now.Add(time.Minute)))
+	assert.True(t, b.done(now.Add(time.Minute), false, true))
+	assert.Equal(t, CircuitOpen, b.State())
+
+	assert.True(t, b.allow(now.Add(2*time.Minute)))
+	b.done(now.Add(2*time.Minute), true, false)
+	assert.Equal(t, CircuitClosed, b.State())
+	assert.True(t, b.allow(now.Add(2*time.Minute)))
+
+	var disabled *circuitBreaker
+	assert.True(t, disabled.allow(now))
+	assert.Equal(t, CircuitDisabled, disabled.State())
+}
+
+func TestHandleRequestCircuitOpen(t *testing.T) {
+	calls := 0
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+	nc.breaker = newCircuitBreaker(2, time.Minute)
+	request := `{"jsonrpc":"2.0","id":1,"method":"eth_getCode","params":["0x1","latest"]}`
+	for i := 0; i < 2; i++ {
+		_, err = nc.HandleRequest(newTestRequest(request))
+		assert.NotNil(t, err)
+	}
+	assert.Equal(t, CircuitOpen, nc.CircuitBreakerState())
+
+	n := &NodeMiddleware{nodeCache: nc}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newTestRequest(request)
+	n.HandleNodeRequest(c)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, 2, calls)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	b := newRetryBackoff(time.Second, 10*time.Second)
+	for _, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		d := b.next()
+		assert.True(t, d >= max/2 && d <= max, "%s not within %s", d, max)
+	}
+	b.reset()
+	assert.True(t, b.next() <= time.Second)
+
+	// interval shorter than the first backoff
+	b = newRetryBackoff(time.Second, 200*time.Millisecond)
+	assert.True(t, b.next() <= 200*time.Millisecond)
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x9"}`))
+	})
+	defer node.Close()
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.intervals["eth_gasPrice"] = 10 * time.Second
+	nc.SetCacheResponse("eth_gasPrice", JSONRPCResponse{Version: "2.0", Result: "0x2"})
+	nc.mu.Lock()
+	entry := nc.cacheResponse[nc.keyHash("eth_gasPrice")]
+	entry.updatedAt = entry.updatedAt.Add(-time.Minute)
+	nc.cacheResponse[nc.keyHash("eth_gasPrice")] = entry
+	nc.mu.Unlock()
+
+	// stale value is served right away and refreshed in background
+	resp, err := nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusStale, resp.CacheStatus)
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":"0x2"}`, string(resp.Body))
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		resp, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice"}`))
+		if err == nil && resp.CacheStatus == CacheStatusHit {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, CacheStatusHit, resp.CacheStatus)
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":"0x9"}`, string(resp.Body))
+}
+
+func TestCloseWaitsForRevalidation(t *testing.T) {
+	var calls int32
+	called := make(chan struct{}, 1)
+	release := make(chan struct{})
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		ioutil.ReadAll(r.Body)
+		called <- struct{}{}
+		<-release
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x9"}`))
+	})
+	defer node.Close()
+	defer close(release)
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	nc.intervals["eth_gasPrice"] = 10 * time.Second
+	nc.revalidate(JSONRPCMessage{Method: "eth_gasPrice"})
+	<-called
+
+	// the refresh has returned when Close does, and no other one starts after it
+	nc.Close()
+	nc.revalidator.mu.Lock()
+	assert.Empty(t, nc.revalidator.inFlight)
+	nc.revalidator.mu.Unlock()
+	assert.False(t, nc.revalidator.start("eth_gasPrice", &nc.wg))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestNodeFailover(t *testing.T) {
+	var downCalls int64
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&downCalls, 1)
+		ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer up.Close()
+
+	nc, err := NewNodeCache(down.URL + "," + up.URL)
+	assert.Nil(t, err)
+	request := `{"jsonrpc":"2.0","id":1,"method":"eth_getCode","params":["0xabc","latest"]}`
+	for i := 0; i < 2; i++ {
+		resp, err := nc.HandleRequest(newTestRequest(request))
+		assert.Nil(t, err)
+		assert.Equal(t, request, string(resp.Body))
+	}
+	// the failed node is skipped during its cooldown
+	assert.Equal(t, int64(1), atomic.LoadInt64(&downCalls))
+}
+
+func TestHandleRequestWebSocket(t *testing.T) {
+	var connections int32
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		atomic.AddInt32(&connections, 1)
+		for {
+			message := JSONRPCMessage{}
+			if err := websocket.JSON.Receive(ws, &message); err != nil {
+				return
+			}
+			// answer with the params of the call so responses can be told apart
+			go websocket.JSON.Send(ws, map[string]interface{}{"jsonrpc": "2.0", "id": message.ID, "result": message.Params[0]})
+		}
+	}))
+	defer server.Close()
+	os.Setenv("NODE_ENDPOINT", "ws://"+strings.TrimPrefix(server.URL, "http://"))
+	defer os.Unsetenv("NODE_ENDPOINT")
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			address := "0x" + strings.Repeat(string('a'+byte(i)), 40)
+			resp, err := nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":7,"method":"eth_getCode","params":["` + address + `","latest"]}`))
+			assert.Nil(t, err)
+			assert.JSONEq(t, `{"jsonrpc":"2.0","id":7,"result":"`+address+`"}`, string(resp.Body))
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&connections))
+}
+
+func TestHandleRequestNoCache(t *testing.T) {
+	calls := 0
+	authorizations := []string{}
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x3"}`))
+	})
+	defer node.Close()
+
+	os.Setenv("ADMIN_TOKEN", "secret")
+	defer os.Unsetenv("ADMIN_TOKEN")
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+	nc.SetCacheResponse("eth_gasPrice", JSONRPCResponse{Version: "2.0", Result: "0x2"})
+
+	sendMethod := func(method, cacheControl, token string) *ProxyResponse {
+		req := newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"` + method + `"}`)
+		req.Header.Set("Cache-Control", cacheControl)
+		req.Header.Set("Authorization", "Bearer client")
+		if token != "" {
+			req.Header.Set(adminTokenHeader, token)
+		}
+		resp, err := nc.HandleRequest(req)
+		assert.Nil(t, err)
+		return resp
+	}
+	send := func(cacheControl, token string) *ProxyResponse {
+		return sendMethod("eth_gasPrice", cacheControl, token)
+	}
+
+	// the header is ignored without the admin token
+	for _, token := range []string{"", "wrong"} {
+		resp := send("no-cache", token)
+		assert.Equal(t, CacheStatusHit, resp.CacheStatus)
+		assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"0x2"}`, string(resp.Body))
+	}
+	assert.Equal(t, 0, calls)
+
+	resp := send("max-age=60, no-cache", "secret")
+	assert.Equal(t, CacheStatusBypass, resp.CacheStatus)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"0x3"}`, string(resp.Body))
+	assert.Equal(t, 1, calls)
+
+	// the entry is refreshed without the headers of the client and the next request gets it
+	assert.Equal(t, []string{""}, authorizations)
+	resp = send("", "")
+	assert.Equal(t, CacheStatusHit, resp.CacheStatus)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"0x3"}`, string(resp.Body))
+	assert.Equal(t, 1, calls)
+
+	// max-age only bypasses responses older than it
+	resp = send("max-age=60", "secret")
+	assert.Equal(t, CacheStatusHit, resp.CacheStatus)
+	assert.Equal(t, 1, calls)
+	resp = send("max-age=0", "secret")
+	assert.Equal(t, CacheStatusBypass, resp.CacheStatus)
+	assert.Equal(t, 2, calls)
+
+	// messages which are not cached are proxied with the client headers and stay uncached
+	resp = sendMethod("eth_chainId", "no-cache", "secret")
+	assert.Equal(t, CacheStatusBypass, resp.CacheStatus)
+	assert.Equal(t, []string{"", "", "Bearer client"}, authorizations)
+	_, err = nc.getCachedResponse(JSONRPCMessage{Method: "eth_chainId"})
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, calls)
+
+	// nobody can bypass the cache without ADMIN_TOKEN
+	nc.adminToken = ""
+	resp = send("no-cache", "")
+	assert.Equal(t, CacheStatusHit, resp.CacheStatus)
+	assert.Equal(t, 3, calls)
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	tests := []struct {
+		value  string
+		ok     bool
+		maxAge time.Duration
+	}{
+		{"", false, 0},
+		{"no-store", false, 0},
+		{"no-cache", true, 0},
+		{"No-Cache", true, 0},
+		{"max-age=30", true, 30 * time.Second},
+		{"MAX-AGE=30", true, 30 * time.Second},
+		{"max-age=30, max-age=10", true, 10 * time.Second},
+		{"max-age=30, no-cache", true, 0},
+		{"max-age=abc", false, 0},
+		{"max-age=-1", false, 0},
+		{"max-age=", false, 0},
+	}
+	for _, test := range tests {
+		header := http.Header{}
+		if test.value != "" {
+			header.Set("Cache-Control", test.value)
+		}
+		maxAge, ok := cacheMaxAge(header)
+		assert.Equal(t, test.ok, ok, test.value)
+		assert.Equal(t, test.maxAge, maxAge, test.value)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	var gasPrice int32
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if bytes.Contains(body, []byte("net_version")) {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x` + strconv.Itoa(int(atomic.AddInt32(&gasPrice, 1))) + `"}`))
+	})
+	defer node.Close()
+
+	os.Setenv("CACHE_METHODS", "eth_gasPrice,net_version")
+	defer os.Unsetenv("CACHE_METHODS")
+	// workers do not run during the test
+	os.Setenv("NODE_CACHE_STARTUP_DELAY", "60")
+	defer os.Unsetenv("NODE_CACHE_STARTUP_DELAY")
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+
+	result, err := nc.Refresh("eth_gasPrice")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"eth_gasPrice"}, result.Refreshed)
+	assert.Empty(t, result.Failed)
+	resp, err := nc.GetCacheResponse(JSONRPCMessage{Method: "eth_gasPrice", ID: 1})
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"0x1"}`, string(resp))
+
+	result, err = nc.Refresh("")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"eth_gasPrice"}, result.Refreshed)
+	assert.Contains(t, result.Failed, "net_version")
+
+	_, err = nc.Refresh("eth_chainId")
+	assert.Equal(t, ErrMethodNotCached, err)
+}
+
+func TestHandleRequestBodyLimits(t *testing.T) {
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x` + strings.Repeat("0", 100) + `"}`))
+	})
+	defer node.Close()
+
+	os.Setenv("MAX_REQUEST_BYTES", "100")
+	defer os.Unsetenv("MAX_REQUEST_BYTES")
+	os.Setenv("MAX_RESPONSE_BYTES", "100")
+	defer os.Unsetenv("MAX_RESPONSE_BYTES")
+	sink := &countingSink{counts: make(map[string]int)}
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+	nc.metrics = sink
+
+	_, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_getCode","params":["0x` + strings.Repeat("a", 100) + `","latest"]}`))
+	assert.Equal(t, ErrRequestTooLarge, err)
+
+	_, err = nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_getCode","params":["0x1","latest"]}`))
+	assert.True(t, errors.Is(err, ErrResponseTooLarge))
+	assert.Equal(t, 1, sink.counts["upstream_response_too_large_total"])
+
+	n := &NodeMiddleware{nodeCache: nc}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_getCode","params":["0x` + strings.Repeat("a", 100) + `","latest"]}`)
+	n.HandleNodeRequest(c)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestNodeCacheTransport(t *testing.T) {
+	var connections int32
+	node := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	node.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	node.Start()
+	defer node.Close()
+	os.Setenv("NODE_ENDPOINT", node.URL)
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+	for i := 0; i < 5; i++ {
+		_, err := nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_getCode","params":["0x1","latest"]}`))
+		assert.Nil(t, err)
+	}
+	// calls reuse the kept-alive connection
+	assert.Equal(t, int32(1), atomic.LoadInt32(&connections))
+
+	nc, err = NewNodeCache("", WithTransport(TransportConfig{MaxIdleConns: 10, MaxIdleConnsPerHost: 5, IdleConnTimeout: time.Minute}))
+	assert.Nil(t, err)
+	defer nc.Close()
+	transport := nc.client.Transport.(*http.Transport)
+	assert.Equal(t, 10, transport.MaxIdleConns)
+	assert.Equal(t, 5, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+}
+
+func TestHandleRequestDeduplicate(t *testing.T) {
+	var calls int32
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		atomic.AddInt32(&calls, 1)
+		started <- struct{}{}
+		<-release
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x60"}`))
+	})
+	defer node.Close()
+
+	sink := &countingSink{counts: make(map[string]int)}
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+	nc.metrics = sink
+
+	request := func(id int) string {
+		return `{"jsonrpc":"2.0","id":` + strconv.Itoa(id) + `,"method":"eth_getCode","params":["0x1","latest"]}`
+	}
+	var wg sync.WaitGroup
+	call := func(id int) {
+		defer wg.Done()
+		resp, err := nc.HandleRequest(newTestRequest(request(id)))
+		assert.Nil(t, err)
+		assert.JSONEq(t, `{"jsonrpc":"2.0","id":`+strconv.Itoa(id)+`,"result":"0x60"}`, string(resp.Body))
+	}
+	wg.Add(1)
+	go call(1)
+	<-started
+	for id := 2; id <= 4; id++ {
+		wg.Add(1)
+		go call(id)
+	}
+	// let the others join the call in flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	sink.mu.Lock()
+	assert.Equal(t, 3, sink.counts["upstream_deduplicated_total"])
+	sink.mu.Unlock()
+
+	// other credentials do not share the call
+	req := newTestRequest(request(5))
+	req.Header.Set("Authorization", "Bearer other")
+	assert.NotEqual(t, nc.dedupKey(newTestRequest(request(5)), JSONRPCMessage{Method: "eth_getCode"}), nc.dedupKey(req, JSONRPCMessage{Method: "eth_getCode"}))
+}
+
+func TestCloseStopsGoroutines(t *testing.T) {
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	})
+	defer node.Close()
+	os.Setenv("CACHE_METHODS", "eth_gasPrice,eth_blockNumber")
+	defer os.Unsetenv("CACHE_METHODS")
+	os.Setenv("PROXY_AUDIT", "true")
+	defer os.Unsetenv("PROXY_AUDIT")
+	os.Setenv("PROXY_AUDIT_LOG_INTERVAL", "60")
+	defer os.Unsetenv("PROXY_AUDIT_LOG_INTERVAL")
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		nc, err := NewNodeCache("")
+		assert.Nil(t, err)
+		assert.Nil(t, nc.WaitReady(context.Background()))
+		nc.Close()
+	}
+	// connections to the fake node are closed asynchronously
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, runtime.NumGoroutine() <= before, "%d goroutines left, %d before", runtime.NumGoroutine(), before)
+}
+
+func TestProxyAuditBounded(t *testing.T) {
+	audit := newProxyAudit(3, 2)
+	for _, method := range []string{"eth_call", "eth_getCode", "eth_getLogs", "eth_getStorageAt", "eth_call"} {
+		audit.Record(method, nil)
+	}
+	for _, param := range []string{`"0x1"`, `"0x2"`, `"0x3"`} {
+		audit.Record("eth_getCode", rawParams(param))
+	}
+	// methods past the limit are counted together, params hashes stop growing at the limit
+	assert.Equal(t, []ProxyAuditEntry{
+		{Method: "eth_getCode", Count: 4, UniqueParams: 2},
+		{Method: "_other", Count: 2, UniqueParams: 1},
+		{Method: "eth_call", Count: 2, UniqueParams: 1},
+	}, audit.Snapshot())
+}
+
+func TestFeeHistory(t *testing.T) {
+	var calls int32
+	var fail int32
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !strings.Contains(string(body), feeHistoryMethod) {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+			return
+		}
+		atomic.AddInt32(&calls, 1)
+		assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"method":"eth_feeHistory","params":["0xa","latest",[10,50,90]]}`, string(body))
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"baseFeePerGas":["0x3b9aca00","0x77359400"],"reward":[["0x1","0x2","0x3"]]}}`))
+	})
+	defer node.Close()
+	os.Setenv("CACHE_METHODS", "eth_gasPrice")
+	defer os.Unsetenv("CACHE_METHODS")
+	sink := &countingSink{counts: map[string]int{}}
+
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+	nc.metrics = sink
+
+	for i := 0; i < 2; i++ {
+		feeHistory, err := nc.FeeHistory(10, []float64{10, 50, 90})
+		assert.Nil(t, err)
+		assert.Equal(t, "2000000000", feeHistory.BaseFeePerGas[1].String())
+		assert.Equal(t, "3", feeHistory.Reward[0][2].String())
+	}
+	// the second one is served from cache
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	sink.mu.Lock()
+	assert.Equal(t, 1, sink.counts["cache_hits_total"])
+	assert.Equal(t, 1, sink.counts["cache_misses_total"])
+	sink.mu.Unlock()
+
+	// past the interval node is called again, and the cached value is served when it fails
+	nc.mu.Lock()
+	for key, entry := range nc.feeHistories {
+		entry.updatedAt = entry.updatedAt.Add(-time.Minute)
+		nc.feeHistories[key] = entry
+	}
+	nc.mu.Unlock()
+	atomic.StoreInt32(&fail, 1)
+	feeHistory, err := nc.FeeHistory(10, []float64{10, 50, 90})
+	assert.Nil(t, err)
+	assert.Equal(t, "2000000000", feeHistory.BaseFeePerGas[1].String())
+	assert.True(t, atomic.LoadInt32(&calls) > 1)
+
+	nc.defaultMaxStaleAge = time.Millisecond
+	_, err = nc.FeeHistory(10, []float64{10, 50, 90})
+	assert.NotNil(t, err)
+}
+
+func TestFeeHistoryNullValues(t *testing.T) {
+	result := ""
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + result + `}`))
+	})
+	defer node.Close()
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+
+	for _, result = range []string{
+		`{"baseFeePerGas":["0x1",null],"reward":[["0x1","0x2","0x3"]]}`,
+		`{"baseFeePerGas":["0x1","0x2"],"reward":[["0x1",null,"0x3"]]}`,
+	} {
+		_, err := nc.fetchFeeHistory([]byte(`{"jsonrpc":"2.0","id":1,"method":"eth_feeHistory"}`))
+		assert.NotNil(t, err, result)
+	}
+}
+
+func TestResponseSizeGuard(t *testing.T) {
+	os.Setenv("RESPONSE_SIZE_THRESHOLD", "100")
+	defer os.Unsetenv("RESPONSE_SIZE_THRESHOLD")
+	os.Setenv("RESPONSE_SIZE_THRESHOLDS", "eth_call:50,eth_getCode:abc")
+	defer os.Unsetenv("RESPONSE_SIZE_THRESHOLDS")
+
+	tests := []struct {
+		name      string
+		reject    bool
+		method    string
+		size      int
+		oversized bool
+	}{
+		{name: "global threshold", method: "eth_gasPrice", size: 100},
+		{name: "over global threshold", method: "eth_gasPrice", size: 101, oversized: true},
+		{name: "over method threshold", method: "eth_call", size: 51, oversized: true},
+		{name: "default method threshold", method: "eth_getLogs", size: 1 << 20},
+		{name: "invalid method threshold uses the global one", method: "eth_getCode", size: 101, oversized: true},
+		{name: "rejected", reject: true, method: "eth_gasPrice", size: 101, oversized: true},
+		{name: "not rejected under threshold", reject: true, method: "eth_call", size: 50},
+	}
+	for _, test := range tests {
+		if test.reject {
+			os.Setenv("RESPONSE_SIZE_REJECT", "true")
+		} else {
+			os.Unsetenv("RESPONSE_SIZE_REJECT")
+		}
+		sink := &countingSink{counts: map[string]int{}}
+		buf := &bytes.Buffer{}
+		guard := newResponseSizeGuardFromEnv(sink, logger.NewJSONLogger(buf))
+		// the invalid threshold is logged when the guard is created
+		assert.Contains(t, buf.String(), `"threshold":"abc"`, test.name)
+		buf.Reset()
+
+		err := guard.check(test.method, test.size)
+		assert.Equal(t, test.oversized && test.reject, err != nil, test.name)
+		if !test.oversized {
+			assert.Equal(t, 0, sink.counts["cache_response_oversized_total"], test.name)
+			assert.Empty(t, buf.String(), test.name)
+			continue
+		}
+		assert.Equal(t, 1, sink.counts["cache_response_oversized_total"], test.name)
+		assert.Contains(t, buf.String(), `"msg":"response is over size threshold"`, test.name)
+		assert.Contains(t, buf.String(), `"method":"`+test.method+`"`, test.name)
+	}
+	os.Unsetenv("RESPONSE_SIZE_REJECT")
+}
+
+func TestRefreshOversizedResponse(t *testing.T) {
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1234567890"}`))
+	})
+	defer node.Close()
+	os.Setenv("CACHE_METHODS", "eth_gasPrice:3600")
+	defer os.Unsetenv("CACHE_METHODS")
+	os.Setenv("RESPONSE_SIZE_THRESHOLD", "10")
+	defer os.Unsetenv("RESPONSE_SIZE_THRESHOLD")
+
+	// oversized responses are still cached, unless rejecting is enabled
+	for _, reject := range []bool{false, true} {
+		os.Setenv("RESPONSE_SIZE_REJECT", strconv.FormatBool(reject))
+		nc, err := NewNodeCache("", WithLogger(logger.NewJSONLogger(ioutil.Discard)))
+		assert.Nil(t, err)
+		err = nc.refreshMethod("eth_gasPrice")
+		assert.Equal(t, reject, err != nil)
+		_, err = nc.getCachedResponse(JSONRPCMessage{Method: "eth_gasPrice"})
+		assert.Equal(t, reject, err != nil)
+		nc.Close()
+	}
+	os.Unsetenv("RESPONSE_SIZE_REJECT")
+}
+
+func TestStartupDelay(t *testing.T) {
+	var calls int32
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	})
+	defer node.Close()
+
+	os.Setenv("CACHE_METHODS", "eth_gasPrice")
+	defer os.Unsetenv("CACHE_METHODS")
+	os.Setenv("NODE_CACHE_STARTUP_DELAY", "1")
+	defer os.Unsetenv("NODE_CACHE_STARTUP_DELAY")
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+	assert.False(t, nc.WarmupProgress().Ready)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	assert.Nil(t, nc.WaitReady(ctx))
+	assert.True(t, atomic.LoadInt32(&calls) > 0)
+}
+
+func TestStartupDelayClose(t *testing.T) {
+	var calls int32
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	})
+	defer node.Close()
+
+	os.Setenv("CACHE_METHODS", "eth_gasPrice")
+	defer os.Unsetenv("CACHE_METHODS")
+	os.Setenv("NODE_CACHE_STARTUP_DELAY", "60")
+	defer os.Unsetenv("NODE_CACHE_STARTUP_DELAY")
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+
+	start := time.Now()
+	nc.Close()
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
+
+func TestFallbackLogsThroughLogger(t *testing.T) {
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	defer node.Close()
+
+	buf := &bytes.Buffer{}
+	nc, err := NewNodeCache("", WithLogger(logger.NewJSONLogger(buf)))
+	assert.Nil(t, err)
+	defer nc.Close()
+	nc.fallbacks = map[string]fallbackChain{"eth_gasPrice": parseFallbackChain("proxy|stale", nc.logger)}
+	nc.SetCacheResponse("eth_gasPrice", JSONRPCResponse{Version: "2.0", Result: "0x2"})
+
+	resp, err := nc.HandleRequest(newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStatusStale, resp.CacheStatus)
+	assert.Contains(t, buf.String(), `"msg":"proxy failed, falling back"`)
+	assert.Contains(t, buf.String(), `"method":"eth_gasPrice"`)
+}
+
+func TestParamCache(t *testing.T) {
+	var calls int32
+	node := newTestNode(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case bytes.Contains(body, []byte("0xdead")):
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":3,"message":"execution reverted"}}`))
+		case bytes.Contains(body, []byte("eth_getTransactionReceipt")):
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":null}`))
+		default:
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x01"}`))
+		}
+	})
+	defer node.Close()
+
+	os.Setenv("CACHE_PARAM_METHODS", "eth_call:60,eth_getBlockByNumber,eth_getTransactionReceipt")
+	defer os.Unsetenv("CACHE_PARAM_METHODS")
+	nc, err := NewNodeCache("")
+	assert.Nil(t, err)
+	defer nc.Close()
+	send := func(body string) *ProxyResponse {
+		resp, err := nc.HandleRequest(newTestRequest(body))
+		assert.Nil(t, err)
+		return resp
+	}
+
+	// calls which only differ in the form of their params share an entry
+	resp := send(`{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"to":"0xABC","data":"0xA9059CBB"},"latest"]}`)
+	assert.Equal(t, CacheStatusMiss, resp.CacheStatus)
+	resp = send(`{"jsonrpc":"2.0","id":2,"method":"eth_call","params":[{"data":"0xa9059cbb", "to":"0xabc"},"Latest"]}`)
+	assert.Equal(t, CacheStatusHit, resp.CacheStatus)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":2,"result":"0x01"}`, string(resp.Body))
+	send(`{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["latest",false]}`)
+	resp = send(`{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["LATEST",false]}`)
+	assert.Equal(t, CacheStatusHit, resp.CacheStatus)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// errors, null results, calls without params or with forwarded headers are not cached
+	for i := 0; i < 2; i++ {
+		send(`{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"to":"0xdead"},"latest"]}`)
+		send(`{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionReceipt","params":["0x1"]}`)
+		send(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`)
+		req := newTestRequest(`{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"to":"0x1"},"latest"]}`)
+		req.Header.Set("Authorization", "Bearer client")
+		_, err = nc.HandleRequest(req)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int32(10), atomic.LoadInt32(&calls))
+
+	// expired entries are fetched again
+	message := JSONRPCMessage{Method: "eth_getBlockByNumber", Params: rawParams(`"latest"`, `false`)}
+	nc.mu.Lock()
+	entry := nc.cacheResponse[nc.entryKey(message)]
+	assert.Equal(t, defaultCacheInterval, entry.expires.Sub(entry.updatedAt))
+	entry.expires = time.Now()
+	nc.cacheResponse[nc.entryKey(message)] = entry
+	nc.mu.Unlock()
+	resp = send(`{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["latest",false]}`)
+	assert.Equal(t, CacheStatusMiss, resp.CacheStatus)
+	assert.Equal(t, int32(11), atomic.LoadInt32(&calls))
+
+	// a full cache drops expired entries, at most once per second, before storing more
+	nc.mu.Lock()
+	nc.paramMaxEntries = len(nc.cacheResponse)
+	entry = nc.cacheResponse[nc.entryKey(message)]
+	entry.expires = time.Now()
+	nc.cacheResponse[nc.entryKey(message)] = entry
+	nc.mu.Unlock()
+	send(`{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"to":"0x2"},"latest"]}`)
+	send(`{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"to":"0x3"},"latest"]}`)
+	resp = send(`{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"to":"0x2"},"latest"]}`)
+	assert.Equal(t, CacheStatusHit, resp.CacheStatus)
+	resp = send(`{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"to":"0x3"},"latest"]}`)
+	assert.Equal(t, CacheStatusMiss, resp.CacheStatus)
+	assert.Equal(t, nc.paramMaxEntries, len(nc.cacheResponse))
+
+	os.Setenv("CACHE_PARAM_METHODS", "eth_call:abc")
+	_, err = NewNodeCache("")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,60 @@
+package node
+
+import (
+	"time"
+)
+
+const defaultFetchOnceInterval = time.Hour
+
+// fetchOnceMethods methods which only change on node upgrade, they are fetched on
+// startup then refreshed rarely, and served from cache like other cached methods
+var fetchOnceMethods = []string{"web3_clientVersion", "eth_chainId", "net_version"}
+
+// NodeInfo software and network of the node
+type NodeInfo struct {
+	ClientVersion interface{} `json:"clientVersion"`
+	ChainID       interface{} `json:"chainId"`
+	NetworkID     interface{} `json:"networkId"`
+}
+
+// fetchOnceWorker refresh fetch-once methods
+func (nc *NodeCache) fetchOnceWorker(interval time.Duration) {
+	defer nc.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, method := range fetchOnceMethods {
+			nc.refreshMethod(method)
+		}
+		if !nc.sleep(ticker) {
+			return
+		}
+	}
+}
+
+// NodeInfo Get node version, chain id and network id, missing values are fetched from node
+func (nc *NodeCache) NodeInfo() NodeInfo {
+	for _, method := range fetchOnceMethods {
+		if _, err := nc.getCachedResponse(JSONRPCMessage{Method: method}); err != nil {
+			nc.refreshMethod(method)
+		}
+	}
+	return nc.cachedNodeInfo()
+}
+
+// cachedNodeInfo node info from cache only, missing values are nil
+func (nc *NodeCache) cachedNodeInfo() NodeInfo {
+	results := make([]interface{}, len(fetchOnceMethods))
+	nc.mu.RLock()
+	defer nc.mu.RUnlock()
+	for i, method := range fetchOnceMethods {
+		if entry, ok := nc.cacheResponse[nc.entryKey(JSONRPCMessage{Method: method})]; ok {
+			results[i] = entry.response.Result
+		}
+	}
+	return NodeInfo{
+		ClientVersion: results[0],
+		ChainID:       results[1],
+		NetworkID:     results[2],
+	}
+}
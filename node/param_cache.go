@@ -0,0 +1,92 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/KyberNetwork/cache/logger"
+)
+
+const defaultParamCacheMaxEntries = 10000
+
+// paramMethodsFromEnv read CACHE_PARAM_METHODS, methods whose responses to calls with params
+// are cached under their canonical key, in form of "method:seconds,method" where seconds is
+// the TTL of a response. CACHE_PARAM_MAX_ENTRIES bounds the cache (default 10000)
+func paramMethodsFromEnv(l logger.Logger) (map[string]time.Duration, int, error) {
+	methods, err := parseCacheMethods(os.Getenv("CACHE_PARAM_METHODS"), duplicatePolicyError, l)
+	if err != nil {
+		return nil, 0, err
+	}
+	ttls := make(map[string]time.Duration)
+	for _, config := range methods {
+		ttls[config.method] = config.interval
+	}
+	maxEntries := defaultParamCacheMaxEntries
+	if value, err := strconv.Atoi(os.Getenv("CACHE_PARAM_MAX_ENTRIES")); err == nil && value > 0 {
+		maxEntries = value
+	}
+	return ttls, maxEntries, nil
+}
+
+// expired tell if a response to a call with params has outlived its TTL, responses
+// refreshed by workers never expire
+func (entry cacheEntry) expired(now time.Time) bool {
+	return !entry.expires.IsZero() && !now.Before(entry.expires)
+}
+
+// cacheParamResponse cache the response node sent to a call of message with params, see
+// storeParamResponse. Responses to requests carrying forwarded headers are not cached since
+// they may depend on the client
+func (nc *NodeCache) cacheParamResponse(req *http.Request, message JSONRPCMessage, resp *ProxyResponse) {
+	if len(message.Params) == 0 || hasForwardedHeaders(nc.forwardHeaders, req.Header) {
+		return
+	}
+	nc.storeParamResponse(message, resp.Body)
+}
+
+// storeParamResponse cache body, the response of node to message, for the TTL of its method
+// in CACHE_PARAM_METHODS. Errors and null results are not cached
+func (nc *NodeCache) storeParamResponse(message JSONRPCMessage, body []byte) {
+	ttl, ok := nc.paramMethods[message.Method]
+	if !ok || nc.sizeGuard.check(message.Method, len(body)) != nil {
+		return
+	}
+	jsonRPCResponse := JSONRPCResponse{}
+	if err := json.Unmarshal(body, &jsonRPCResponse); err != nil || jsonRPCResponse.Error != nil || jsonRPCResponse.Result == nil {
+		return
+	}
+	now := time.Now()
+	entry := cacheEntry{
+		response:    jsonRPCResponse,
+		blockNumber: nc.LatestBlock(),
+		updatedAt:   now,
+		hash:        contentHash(jsonRPCResponse.Result),
+		expires:     now.Add(ttl),
+	}
+	key := nc.entryKey(message)
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if _, cached := nc.cacheResponse[key]; !cached && len(nc.cacheResponse) >= nc.paramMaxEntries && !nc.sweepParamEntries(now) {
+		nc.metrics.Incr("cache_param_full_total", map[string]string{"method": nc.metricMethod(message.Method)})
+		return
+	}
+	nc.cacheResponse[key] = entry
+}
+
+// sweepParamEntries delete expired responses to calls with params once the cache is full,
+// at most once per second, and tell if there is room for another one. nc.mu must be held
+func (nc *NodeCache) sweepParamEntries(now time.Time) bool {
+	if now.Sub(nc.paramSweptAt) < time.Second {
+		return false
+	}
+	nc.paramSweptAt = now
+	for key, entry := range nc.cacheResponse {
+		if entry.expired(now) {
+			delete(nc.cacheResponse, key)
+		}
+	}
+	return len(nc.cacheResponse) < nc.paramMaxEntries
+}
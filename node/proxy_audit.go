@@ -0,0 +1,138 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KyberNetwork/cache/logger"
+)
+
+const (
+	auditOtherMethod   = "_other"
+	auditInvalidMethod = "_invalid"
+	auditBatchMethod   = "_batch"
+
+	defaultAuditMaxMethods = 200
+	defaultAuditMaxParams  = 1000
+)
+
+// ProxyAuditEntry aggregated count of a proxied method
+type ProxyAuditEntry struct {
+	Method       string `json:"method"`
+	Count        int64  `json:"count"`
+	UniqueParams int    `json:"uniqueParams"`
+}
+
+type methodAudit struct {
+	count  int64
+	mu     sync.Mutex
+	params map[uint64]struct{}
+}
+
+// proxyAudit count cache-miss methods which are proxied to node,
+// number of tracked methods and params hashes is bounded
+type proxyAudit struct {
+	mu         sync.RWMutex
+	methods    map[string]*methodAudit
+	maxMethods int
+	maxParams  int
+}
+
+func newProxyAudit(maxMethods, maxParams int) *proxyAudit {
+	return &proxyAudit{
+		methods:    make(map[string]*methodAudit),
+		maxMethods: maxMethods,
+		maxParams:  maxParams,
+	}
+}
+
+func (pa *proxyAudit) getMethod(method string) *methodAudit {
+	pa.mu.RLock()
+	ma, ok := pa.methods[method]
+	pa.mu.RUnlock()
+	if ok {
+		return ma
+	}
+
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	if ma, ok := pa.methods[method]; ok {
+		return ma
+	}
+	// keep one slot for the overflow bucket
+	if len(pa.methods) >= pa.maxMethods-1 && method != auditOtherMethod {
+		if ma, ok := pa.methods[auditOtherMethod]; ok {
+			return ma
+		}
+		method = auditOtherMethod
+	}
+	ma = &methodAudit{params: make(map[uint64]struct{})}
+	pa.methods[method] = ma
+	return ma
+}
+
+// Record count a proxied method with its params
+func (pa *proxyAudit) Record(method string, params []json.RawMessage) {
+	ma := pa.getMethod(method)
+	atomic.AddInt64(&ma.count, 1)
+
+	paramBytes, err := json.Marshal(params)
+	if err != nil {
+		return
+	}
+	h := fnv.New64a()
+	h.Write(paramBytes)
+	sum := h.Sum64()
+
+	ma.mu.Lock()
+	if len(ma.params) < pa.maxParams {
+		ma.params[sum] = struct{}{}
+	}
+	ma.mu.Unlock()
+}
+
+// Snapshot return proxied methods sorted by count
+func (pa *proxyAudit) Snapshot() []ProxyAuditEntry {
+	pa.mu.RLock()
+	defer pa.mu.RUnlock()
+
+	result := make([]ProxyAuditEntry, 0, len(pa.methods))
+	for method, ma := range pa.methods {
+		ma.mu.Lock()
+		uniqueParams := len(ma.params)
+		ma.mu.Unlock()
+		result = append(result, ProxyAuditEntry{
+			Method:       method,
+			Count:        atomic.LoadInt64(&ma.count),
+			UniqueParams: uniqueParams,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count == result[j].Count {
+			return result[i].Method < result[j].Method
+		}
+		return result[i].Count > result[j].Count
+	})
+	return result
+}
+
+// logLoop dump the audit to log every interval until ctx is done
+func (pa *proxyAudit) logLoop(ctx context.Context, interval time.Duration, l logger.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, entry := range pa.Snapshot() {
+			l.Info("proxy audit", logger.Fields{"method": entry.Method, "count": entry.Count, "uniqueParams": entry.UniqueParams})
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package node
+
+import (
+	"errors"
+)
+
+// ErrMethodNotCached returned when a refresh is asked for a method which is not in CACHE_METHODS
+var ErrMethodNotCached = errors.New("method is not cached")
+
+// RefreshResult cached methods refreshed on demand, Failed is the error of each method
+// which could not be refreshed
+type RefreshResult struct {
+	Refreshed []string          `json:"refreshed"`
+	Failed    map[string]string `json:"failed"`
+}
+
+// Refresh fetch method, or every cached method when it is empty, from node now and
+// wait for the result. Workers keep their schedule
+func (nc *NodeCache) Refresh(method string) (RefreshResult, error) {
+	methods := []string{}
+	for _, config := range nc.methods {
+		if method == "" || config.method == method {
+			methods = append(methods, config.method)
+		}
+	}
+	if method != "" && len(methods) == 0 {
+		return RefreshResult{}, ErrMethodNotCached
+	}
+
+	result := RefreshResult{Refreshed: []string{}, Failed: make(map[string]string)}
+	for _, m := range methods {
+		err := nc.refreshMethod(m)
+		nc.warmup.done(m, err)
+		if err != nil {
+			result.Failed[m] = err.Error()
+			continue
+		}
+		nc.metrics.Incr("cache_forced_refreshes_total", map[string]string{"method": nc.metricMethod(m)})
+		result.Refreshed = append(result.Refreshed, m)
+	}
+	return result, nil
+}
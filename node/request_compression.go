@@ -0,0 +1,44 @@
+package node
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"strconv"
+)
+
+const defaultGzipMinSize = 1024
+
+// requestCompression gzip bodies sent to node from minSize bytes, disabled when nil
+// since not every node accepts compressed requests
+type requestCompression struct {
+	minSize int
+}
+
+// newRequestCompressionFromEnv read UPSTREAM_GZIP_REQUESTS and UPSTREAM_GZIP_MIN_SIZE
+func newRequestCompressionFromEnv() *requestCompression {
+	if os.Getenv("UPSTREAM_GZIP_REQUESTS") != "true" {
+		return nil
+	}
+	rc := &requestCompression{minSize: defaultGzipMinSize}
+	if minSize, err := strconv.Atoi(os.Getenv("UPSTREAM_GZIP_MIN_SIZE")); err == nil && minSize >= 0 {
+		rc.minSize = minSize
+	}
+	return rc
+}
+
+// compress return gzipped body and true, or body as is when it is too small to be worth it
+func (rc *requestCompression) compress(body []byte) ([]byte, bool) {
+	if rc == nil || len(body) < rc.minSize {
+		return body, false
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(body); err != nil {
+		return body, false
+	}
+	if err := gz.Close(); err != nil {
+		return body, false
+	}
+	return buf.Bytes(), true
+}
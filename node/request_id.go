@@ -0,0 +1,31 @@
+package node
+
+import (
+	"context"
+
+	"github.com/KyberNetwork/cache/logger"
+)
+
+// RequestIDHeader header carrying the id of a client request, it is echoed back in the response
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID return a copy of ctx carrying the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID id of the client request of ctx, empty for calls made by the cache itself
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logFields add the request id of ctx to fields of a log line
+func logFields(ctx context.Context, fields logger.Fields) logger.Fields {
+	if id := RequestID(ctx); id != "" {
+		fields["requestId"] = id
+	}
+	return fields
+}
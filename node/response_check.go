@@ -0,0 +1,57 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	// ResponseCheckBody node responses must be valid JSON
+	ResponseCheckBody = "body"
+	// ResponseCheckContentType node responses must also have a JSON Content-Type
+	ResponseCheckContentType = "content-type"
+	// ResponseCheckOff node responses are returned as is
+	ResponseCheckOff = "off"
+)
+
+// ErrNonJSONResponse returned when node answers something else than JSON,
+// e.g. the error page of a proxy in front of it
+var ErrNonJSONResponse = errors.New("node response is not JSON")
+
+// responseCheckFromEnv read UPSTREAM_RESPONSE_CHECK, default is body
+func responseCheckFromEnv() string {
+	switch mode := os.Getenv("UPSTREAM_RESPONSE_CHECK"); mode {
+	case ResponseCheckContentType, ResponseCheckOff:
+		return mode
+	}
+	return ResponseCheckBody
+}
+
+// isJSONContentType accept application/json and +json media types
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// checkResponse validate a node response according to mode
+func checkResponse(mode string, header http.Header, body []byte) error {
+	switch mode {
+	case ResponseCheckOff:
+		return nil
+	case ResponseCheckContentType:
+		if !isJSONContentType(header.Get("Content-Type")) {
+			return ErrNonJSONResponse
+		}
+	}
+	if !json.Valid(body) {
+		return ErrNonJSONResponse
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package node
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/KyberNetwork/cache/logger"
+	"github.com/KyberNetwork/cache/metrics"
+)
+
+const defaultResponseSizeThreshold = 1 << 20 // 1MB
+
+// default thresholds of methods which are expected to return big responses
+var defaultMethodSizeThresholds = map[string]int{
+	"eth_getLogs":          8 << 20,
+	"eth_getBlockByNumber": 4 << 20,
+	"eth_getBlockByHash":   4 << 20,
+}
+
+// responseSizeGuard warn when a fetched response is bigger than its method threshold
+type responseSizeGuard struct {
+	globalThreshold  int
+	methodThresholds map[string]int
+	reject           bool
+	metrics          metrics.MetricsSink
+	logger           logger.Logger
+}
+
+// newResponseSizeGuardFromEnv read RESPONSE_SIZE_THRESHOLD (global, bytes),
+// RESPONSE_SIZE_THRESHOLDS (method:bytes,...) and RESPONSE_SIZE_REJECT
+func newResponseSizeGuardFromEnv(sink metrics.MetricsSink, l logger.Logger) *responseSizeGuard {
+	guard := &responseSizeGuard{
+		globalThreshold:  defaultResponseSizeThreshold,
+		methodThresholds: make(map[string]int),
+		reject:           os.Getenv("RESPONSE_SIZE_REJECT") == "true",
+		metrics:          sink,
+		logger:           l,
+	}
+	if threshold, err := strconv.Atoi(os.Getenv("RESPONSE_SIZE_THRESHOLD")); err == nil && threshold > 0 {
+		guard.globalThreshold = threshold
+	}
+	for method, threshold := range defaultMethodSizeThresholds {
+		guard.methodThresholds[method] = threshold
+	}
+	for method, value := range parseMethodConfig(os.Getenv("RESPONSE_SIZE_THRESHOLDS")) {
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold <= 0 {
+			l.Error("invalid response size threshold", logger.Fields{"method": method, "threshold": value})
+			continue
+		}
+		guard.methodThresholds[method] = threshold
+	}
+	return guard
+}
+
+func (g *responseSizeGuard) threshold(method string) int {
+	if threshold, ok := g.methodThresholds[method]; ok {
+		return threshold
+	}
+	return g.globalThreshold
+}
+
+// check return an error only when the response is oversized and rejecting is enabled
+func (g *responseSizeGuard) check(method string, size int) error {
+	threshold := g.threshold(method)
+	if size <= threshold {
+		return nil
+	}
+	g.metrics.Incr("cache_response_oversized_total", map[string]string{"method": method})
+
+	g.logger.Error("response is over size threshold", logger.Fields{"method": method, "size": size, "threshold": threshold, "rejected": g.reject})
+	if g.reject {
+		return fmt.Errorf("response of method %s is over size threshold", method)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package node
+
+import (
+	"sync"
+
+	"github.com/KyberNetwork/cache/logger"
+)
+
+// revalidator refresh stale cached methods in background when they are served,
+// at most one refresh per method at a time
+type revalidator struct {
+	mu       sync.Mutex
+	inFlight map[string]bool
+	closed   bool
+}
+
+func newRevalidator() *revalidator {
+	return &revalidator{inFlight: make(map[string]bool)}
+}
+
+// start mark method as being refreshed and add the refresh to wg, false if it already
+// is or the revalidator is closed
+func (rv *revalidator) start(method string, wg *sync.WaitGroup) bool {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	if rv.closed || rv.inFlight[method] {
+		return false
+	}
+	rv.inFlight[method] = true
+	wg.Add(1)
+	return true
+}
+
+// close stop starting refreshes, the ones in flight are still in their wait group
+func (rv *revalidator) close() {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	rv.closed = true
+}
+
+func (rv *revalidator) done(method string) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	delete(rv.inFlight, method)
+}
+
+// revalidate refresh a method whose stale cached value was just served, so the next
+// request gets a fresh one without waiting for the worker. Methods called with params
+// are not refreshed by the cache
+func (nc *NodeCache) revalidate(message JSONRPCMessage) {
+	if len(message.Params) > 0 || nc.ctx.Err() != nil {
+		return
+	}
+	if _, ok := nc.intervals[message.Method]; !ok {
+		return
+	}
+	if !nc.revalidator.start(message.Method, &nc.wg) {
+		return
+	}
+	go func() {
+		defer nc.wg.Done()
+		defer nc.revalidator.done(message.Method)
+		if err := nc.refreshMethod(message.Method); err != nil {
+			nc.logger.Error("revalidating cached response failed", logger.Fields{"method": message.Method, "error": err})
+			return
+		}
+		nc.metrics.Incr("cache_revalidations_total", map[string]string{"method": nc.metricMethod(message.Method)})
+	}()
+}
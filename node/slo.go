@@ -0,0 +1,35 @@
+package node
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/KyberNetwork/cache/logger"
+)
+
+// staleSLOsFromEnv read max age of cached values per method from STALE_SLO,
+// in form of "method:seconds,method:seconds"
+func staleSLOsFromEnv(l logger.Logger) map[string]time.Duration {
+	result := make(map[string]time.Duration)
+	for method, value := range parseMethodConfig(os.Getenv("STALE_SLO")) {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			l.Error("invalid stale SLO", logger.Fields{"method": method, "value": value})
+			continue
+		}
+		result[method] = time.Duration(seconds) * time.Second
+	}
+	return result
+}
+
+// checkStaleSLO flag a cached response older than the stale SLO of its method
+func (nc *NodeCache) checkStaleSLO(method string, resp *ProxyResponse) {
+	slo, ok := nc.staleSLOs[method]
+	if !ok || resp.Age <= slo {
+		return
+	}
+	resp.SLOViolated = true
+	nc.logger.Error("stale SLO violated", logger.Fields{"method": method, "age": resp.Age.String(), "slo": slo.String()})
+	nc.metrics.Incr("cache_stale_slo_violations_total", map[string]string{"method": nc.metricMethod(method)})
+}
@@ -0,0 +1,70 @@
+package node
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// defaults for a single node, http.DefaultTransport keeps only 2 idle connections per host
+// so most calls under load open a new one
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 100
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+// TransportConfig connection pooling of the HTTP client calling node
+type TransportConfig struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	DisableKeepAlives   bool
+}
+
+// WithTransport pool connections to node with config instead of the NODE_* settings
+func WithTransport(config TransportConfig) Option {
+	return func(nc *NodeCache) {
+		nc.transport = config
+	}
+}
+
+// transportConfigFromEnv read NODE_MAX_IDLE_CONNS, NODE_MAX_IDLE_CONNS_PER_HOST,
+// NODE_IDLE_CONN_TIMEOUT (seconds) and NODE_DISABLE_KEEP_ALIVES
+func transportConfigFromEnv() TransportConfig {
+	config := TransportConfig{
+		MaxIdleConns:        defaultMaxIdleConns,
+		MaxIdleConnsPerHost: defaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     defaultIdleConnTimeout,
+		DisableKeepAlives:   os.Getenv("NODE_DISABLE_KEEP_ALIVES") == "true",
+	}
+	if conns, err := strconv.Atoi(os.Getenv("NODE_MAX_IDLE_CONNS")); err == nil && conns > 0 {
+		config.MaxIdleConns = conns
+	}
+	if conns, err := strconv.Atoi(os.Getenv("NODE_MAX_IDLE_CONNS_PER_HOST")); err == nil && conns > 0 {
+		config.MaxIdleConnsPerHost = conns
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("NODE_IDLE_CONN_TIMEOUT")); err == nil && seconds > 0 {
+		config.IdleConnTimeout = time.Duration(seconds) * time.Second
+	}
+	return config
+}
+
+// newTransport HTTP transport to node, the other settings are those of http.DefaultTransport
+func newTransport(config TransportConfig) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          config.MaxIdleConns,
+		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+		IdleConnTimeout:       config.IdleConnTimeout,
+		DisableKeepAlives:     config.DisableKeepAlives,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
@@ -0,0 +1,91 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// ErrorCategory kind of failure of a call to node, alerting and retries depend on it
+type ErrorCategory string
+
+const (
+	CategoryTimeout     ErrorCategory = "timeout"
+	CategoryConnRefused ErrorCategory = "conn_refused"
+	CategoryServerError ErrorCategory = "server_error"
+	CategoryRateLimited ErrorCategory = "rate_limited"
+	// CategoryRPCError node answered a JSON-RPC error object
+	CategoryRPCError ErrorCategory = "rpc_error"
+	// CategoryBadResponse unexpected status code or a body which is not JSON
+	CategoryBadResponse ErrorCategory = "bad_response"
+	// CategoryOther any other transport error, e.g. DNS failure or cancelled call
+	CategoryOther ErrorCategory = "other"
+)
+
+// UpstreamError a failed call to node with its category
+type UpstreamError struct {
+	category ErrorCategory
+	err      error
+}
+
+func (e *UpstreamError) Error() string {
+	return e.err.Error()
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.err
+}
+
+// Category kind of failure
+func (e *UpstreamError) Category() ErrorCategory {
+	return e.category
+}
+
+// transportError categorize an error of http.Client.Do
+func transportError(err error) *UpstreamError {
+	category := CategoryOther
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		category = CategoryTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		category = CategoryTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		category = CategoryConnRefused
+	}
+	return &UpstreamError{category: category, err: err}
+}
+
+// statusError categorize a response with a status code other than 200
+func statusError(statusCode int) *UpstreamError {
+	category := CategoryBadResponse
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		category = CategoryRateLimited
+	case statusCode >= 500:
+		category = CategoryServerError
+	}
+	return &UpstreamError{category: category, err: errors.New(fmt.Sprintf("Status code is %d", statusCode))}
+}
+
+// rpcError return an error when body is a single JSON-RPC response with an error object
+func rpcError(body []byte) *UpstreamError {
+	if isBatchBody(body) {
+		return nil
+	}
+	// only the error, id may be of any type
+	resp := struct {
+		Error *JSONRPCError `json:"error"`
+	}{}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Error == nil {
+		return nil
+	}
+	return &UpstreamError{
+		category: CategoryRPCError,
+		err:      fmt.Errorf("JSON-RPC error %d: %s", resp.Error.Code, resp.Error.Message),
+	}
+}
@@ -0,0 +1,48 @@
+package node
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultUpstreamErrorLogSize = 50
+
+// UpstreamErrorEntry a failed call to node, kept in the recent errors
+type UpstreamErrorEntry struct {
+	Time     time.Time     `json:"time"`
+	Method   string        `json:"method"`
+	Category ErrorCategory `json:"category"`
+	Error    string        `json:"error"`
+}
+
+// upstreamErrorLog ring buffer of the most recent upstream errors
+type upstreamErrorLog struct {
+	mu      sync.Mutex
+	entries []UpstreamErrorEntry
+	next    int
+	full    bool
+}
+
+func newUpstreamErrorLog(size int) *upstreamErrorLog {
+	return &upstreamErrorLog{entries: make([]UpstreamErrorEntry, size)}
+}
+
+func (l *upstreamErrorLog) add(method string, err *UpstreamError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[l.next] = UpstreamErrorEntry{Time: time.Now(), Method: method, Category: err.Category(), Error: err.Error()}
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// recent return errors from the oldest to the newest
+func (l *upstreamErrorLog) recent() []UpstreamErrorEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]UpstreamErrorEntry{}, l.entries[:l.next]...)
+	}
+	return append(append([]UpstreamErrorEntry{}, l.entries[l.next:]...), l.entries[:l.next]...)
+}
@@ -1,6 +1,9 @@
 package node
 
-import "strings"
+import (
+	"bytes"
+	"strings"
+)
 
 func InListSubstring(x string, arr []string) bool {
 	for _, y := range arr {
@@ -19,3 +22,26 @@ func InList(x string, arr []string) bool {
 	}
 	return false
 }
+
+// isBatchBody check if a request body is a JSON-RPC batch (array)
+func isBatchBody(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// parseMethodConfig parse per method config in form of "method:value,method:value"
+func parseMethodConfig(value string) map[string]string {
+	result := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		sep := strings.LastIndex(item, ":")
+		if sep <= 0 {
+			continue
+		}
+		result[strings.TrimSpace(item[:sep])] = strings.TrimSpace(item[sep+1:])
+	}
+	return result
+}
@@ -0,0 +1,55 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+const (
+	jsonRPCVersion = "2.0"
+
+	// VersionModeStrict reject requests which are not JSON-RPC 2.0
+	VersionModeStrict = "strict"
+	// VersionModeLenient send requests to node as JSON-RPC 2.0 and answer with the client version
+	VersionModeLenient = "lenient"
+)
+
+// ErrInvalidVersion returned in strict mode when jsonrpc is not "2.0"
+var ErrInvalidVersion = errors.New(`jsonrpc must be "2.0"`)
+
+// ErrInvalidRequest returned when a message is not a JSON object with a method, it is not sent to node
+var ErrInvalidRequest = errors.New("method must be a non-empty string")
+
+// validateMessage check a single message has a method, the other fields are checked by node
+func validateMessage(raw []byte) error {
+	envelope := struct {
+		Method interface{} `json:"method"`
+	}{}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return ErrInvalidRequest
+	}
+	if method, ok := envelope.Method.(string); !ok || method == "" {
+		return ErrInvalidRequest
+	}
+	return nil
+}
+
+// withJSONRPCVersion set jsonrpc field of a single message, the field is removed when
+// version is empty. Body is returned as is if it is not a JSON object
+func withJSONRPCVersion(body []byte, version string) []byte {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+	if version == "" {
+		delete(fields, "jsonrpc")
+	} else {
+		encoded, _ := json.Marshal(version)
+		fields["jsonrpc"] = encoded
+	}
+	result, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return result
+}
@@ -0,0 +1,96 @@
+package node
+
+import (
+	"context"
+	"sync"
+)
+
+type warmState int
+
+const (
+	warmInProgress warmState = iota
+	warmWarmed
+	warmFailed
+)
+
+// WarmupProgress progress of the first refresh of cached methods, a failed method
+// is retried with backoff and counts as warmed once it succeeds
+type WarmupProgress struct {
+	Total           int     `json:"total"`
+	Warmed          int     `json:"warmed"`
+	Failed          int     `json:"failed"`
+	InProgress      int     `json:"inProgress"`
+	PercentComplete float64 `json:"percentComplete"`
+	Ready           bool    `json:"ready"`
+}
+
+// warmup track whether each cached method has been fetched once
+type warmup struct {
+	mu     sync.Mutex
+	states map[string]warmState
+	warmed int
+	ready  chan struct{} // closed once every method is warmed
+}
+
+func newWarmup(methods []methodConfig) *warmup {
+	states := make(map[string]warmState, len(methods))
+	for _, config := range methods {
+		states[config.method] = warmInProgress
+	}
+	w := &warmup{states: states, ready: make(chan struct{})}
+	if len(states) == 0 {
+		close(w.ready)
+	}
+	return w
+}
+
+// done record the result of a refresh, warmed methods stay warmed
+func (w *warmup) done(method string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	state, ok := w.states[method]
+	if !ok || state == warmWarmed {
+		return
+	}
+	if err != nil {
+		w.states[method] = warmFailed
+		return
+	}
+	w.states[method] = warmWarmed
+	w.warmed++
+	if w.warmed == len(w.states) {
+		close(w.ready)
+	}
+}
+
+// wait block until every method is warmed or ctx is done
+func (w *warmup) wait(ctx context.Context) error {
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *warmup) progress() WarmupProgress {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	result := WarmupProgress{Total: len(w.states)}
+	for _, state := range w.states {
+		switch state {
+		case warmWarmed:
+			result.Warmed++
+		case warmFailed:
+			result.Failed++
+		default:
+			result.InProgress++
+		}
+	}
+	result.PercentComplete = 100
+	if result.Total > 0 {
+		result.PercentComplete = float64(result.Warmed) * 100 / float64(result.Total)
+	}
+	result.Ready = result.Warmed == result.Total
+	return result
+}
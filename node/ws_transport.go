@@ -0,0 +1,365 @@
+package node
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/KyberNetwork/cache/logger"
+	"golang.org/x/net/websocket"
+)
+
+// errWebSocketClosed returned to calls in flight when the connection to node drops
+var errWebSocketClosed = errors.New("websocket connection to node closed")
+
+// isWebSocket tell if a node endpoint is called over a websocket
+func isWebSocket(u *url.URL) bool {
+	return u.Scheme == "ws" || u.Scheme == "wss"
+}
+
+type wsResult struct {
+	body []byte
+	err  error
+}
+
+// wsCall a message sent to node, ids are the ids given to its members
+type wsCall struct {
+	ids    []uint64
+	result chan wsResult
+}
+
+// wsTransport one persistent websocket connection to a node, dialed on the first call and
+// again after it drops. Ids of messages are replaced by ids unique to the connection so
+// the responses of concurrent calls are matched, then set back to the ids of the client
+type wsTransport struct {
+	endpoint   *url.URL
+	timeout    time.Duration
+	maxPayload int64
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	nextID  uint64
+	pending map[uint64]*wsCall
+	closed  bool
+
+	writeMu sync.Mutex
+}
+
+func newWSTransport(endpoint *url.URL, timeout time.Duration, maxPayload int64) *wsTransport {
+	return &wsTransport{endpoint: endpoint, timeout: timeout, maxPayload: maxPayload, pending: make(map[uint64]*wsCall)}
+}
+
+// newWSTransports one transport per websocket node of pool, http nodes have none.
+// Messages of node over maxPayload bytes are not read
+func newWSTransports(pool *endpointPool, timeout time.Duration, maxPayload int64) map[*url.URL]*wsTransport {
+	transports := make(map[*url.URL]*wsTransport)
+	for _, endpoint := range pool.endpoints {
+		if isWebSocket(endpoint.url) {
+			transports[endpoint.url] = newWSTransport(endpoint.url, timeout, maxPayload)
+		}
+	}
+	return transports
+}
+
+// connect return the connection, dialing it when there is none
+func (t *wsTransport) connect() (*websocket.Conn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, errWebSocketClosed
+	}
+	if t.conn != nil {
+		return t.conn, nil
+	}
+	origin := url.URL{Scheme: "http", Host: t.endpoint.Host}
+	if t.endpoint.Scheme == "wss" {
+		origin.Scheme = "https"
+	}
+	config, err := websocket.NewConfig(t.endpoint.String(), origin.String())
+	if err != nil {
+		return nil, err
+	}
+	config.Dialer = &net.Dialer{Timeout: t.timeout}
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	conn.MaxPayloadBytes = int(t.maxPayload)
+	t.conn = conn
+	go t.readLoop(conn)
+	return conn, nil
+}
+
+// readLoop deliver responses to the calls waiting for them until the connection fails,
+// messages without a known id, e.g. subscription notifications, are dropped. A message
+// over maxPayload drops the connection since its call cannot be told
+func (t *wsTransport) readLoop(conn *websocket.Conn) {
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(conn, &data); err != nil {
+			if err == websocket.ErrFrameTooLarge {
+				t.drop(conn, ErrResponseTooLarge)
+			} else {
+				t.drop(conn, errWebSocketClosed)
+			}
+			return
+		}
+		id, ok := wsResponseID(data)
+		if !ok {
+			continue
+		}
+		t.mu.Lock()
+		call, ok := t.pending[id]
+		if ok {
+			for _, callID := range call.ids {
+				delete(t.pending, callID)
+			}
+		}
+		t.mu.Unlock()
+		if ok {
+			call.result <- wsResult{body: data}
+		}
+	}
+}
+
+// drop forget a failed connection and fail the calls sent on it with err
+func (t *wsTransport) drop(conn *websocket.Conn, err error) {
+	t.mu.Lock()
+	if t.conn != conn {
+		t.mu.Unlock()
+		return
+	}
+	t.conn = nil
+	pending := t.pending
+	t.pending = make(map[uint64]*wsCall)
+	t.mu.Unlock()
+	conn.Close()
+	failed := make(map[*wsCall]bool)
+	for _, call := range pending {
+		if !failed[call] {
+			failed[call] = true
+			call.result <- wsResult{err: err}
+		}
+	}
+}
+
+// call send body, a message or a batch, and wait for its response. Messages without an
+// id are notifications, node does not answer them and nil is returned
+func (t *wsTransport) call(ctx context.Context, body []byte) ([]byte, error) {
+	conn, err := t.connect()
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	message, call, original, err := t.assignIDs(body)
+	if err == nil && len(call.ids) > 0 {
+		for _, id := range call.ids {
+			t.pending[id] = call
+		}
+	}
+	t.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	t.writeMu.Lock()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+	}
+	err = websocket.Message.Send(conn, string(message))
+	t.writeMu.Unlock()
+	if err != nil {
+		t.drop(conn, err)
+		t.forget(call)
+		return nil, err
+	}
+	if len(call.ids) == 0 {
+		return nil, nil
+	}
+
+	select {
+	case result := <-call.result:
+		if result.err != nil {
+			return nil, result.err
+		}
+		return restoreIDs(result.body, original), nil
+	case <-ctx.Done():
+		t.forget(call)
+		return nil, ctx.Err()
+	}
+}
+
+// forget stop waiting for the response of call
+func (t *wsTransport) forget(call *wsCall) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, id := range call.ids {
+		delete(t.pending, id)
+	}
+}
+
+// assignIDs replace ids of members of body by ids of the connection, return the new body
+// and the ids of the client by new id. It must be called with mu held
+func (t *wsTransport) assignIDs(body []byte) ([]byte, *wsCall, map[uint64]json.RawMessage, error) {
+	batch := isBatchBody(body)
+	members := []map[string]json.RawMessage{}
+	if batch {
+		if err := json.Unmarshal(body, &members); err != nil {
+			return nil, nil, nil, err
+		}
+	} else {
+		member := map[string]json.RawMessage{}
+		if err := json.Unmarshal(body, &member); err != nil {
+			return nil, nil, nil, err
+		}
+		members = append(members, member)
+	}
+
+	call := &wsCall{result: make(chan wsResult, 1)}
+	original := make(map[uint64]json.RawMessage)
+	for _, member := range members {
+		clientID, ok := member["id"]
+		if !ok || string(clientID) == "null" {
+			continue
+		}
+		t.nextID++
+		id := t.nextID
+		member["id"] = json.RawMessage(strconv.FormatUint(id, 10))
+		original[id] = clientID
+		call.ids = append(call.ids, id)
+	}
+
+	var message []byte
+	var err error
+	if batch {
+		message, err = json.Marshal(members)
+	} else {
+		message, err = json.Marshal(members[0])
+	}
+	return message, call, original, err
+}
+
+// close the connection, later calls fail
+func (t *wsTransport) close() {
+	t.mu.Lock()
+	t.closed = true
+	conn := t.conn
+	t.mu.Unlock()
+	if conn != nil {
+		t.drop(conn, errWebSocketClosed)
+	}
+}
+
+// wsResponseID id of a response or of the first member of a batch response with one
+func wsResponseID(data []byte) (uint64, bool) {
+	members := []json.RawMessage{data}
+	if isBatchBody(data) {
+		if err := json.Unmarshal(data, &members); err != nil {
+			return 0, false
+		}
+	}
+	for _, member := range members {
+		envelope := struct {
+			ID json.RawMessage `json:"id"`
+		}{}
+		if err := json.Unmarshal(member, &envelope); err != nil {
+			continue
+		}
+		if id, err := strconv.ParseUint(string(envelope.ID), 10, 64); err == nil {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// restoreIDs set the ids of the client back in a response
+func restoreIDs(data []byte, original map[uint64]json.RawMessage) []byte {
+	restore := func(member map[string]json.RawMessage) {
+		id, err := strconv.ParseUint(string(member["id"]), 10, 64)
+		if err != nil {
+			return
+		}
+		if clientID, ok := original[id]; ok {
+			member["id"] = clientID
+		}
+	}
+	var result []byte
+	var err error
+	if isBatchBody(data) {
+		members := []map[string]json.RawMessage{}
+		if err := json.Unmarshal(data, &members); err != nil {
+			return data
+		}
+		for _, member := range members {
+			restore(member)
+		}
+		result, err = json.Marshal(members)
+	} else {
+		member := map[string]json.RawMessage{}
+		if err := json.Unmarshal(data, &member); err != nil {
+			return data
+		}
+		restore(member)
+		result, err = json.Marshal(member)
+	}
+	if err != nil {
+		return data
+	}
+	return result
+}
+
+// callWebSocket send req to a websocket node, failures are returned as *UpstreamError
+// like callEndpoint
+func (nc *NodeCache) callWebSocket(ctx context.Context, method string, transport *wsTransport, req *http.Request) ([]byte, error) {
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := transport.call(ctx, body)
+	nc.metrics.Timing("upstream_request_duration_seconds", time.Since(start), map[string]string{"method": nc.metricMethod(method)})
+	if err == ErrResponseTooLarge {
+		return nil, nc.responseTooLarge(ctx, method, req)
+	}
+	if err != nil {
+		nc.logger.Error("call to node failed", logFields(ctx, logger.Fields{"method": method, "endpoint": req.URL.Host, "error": err}))
+		return nil, nc.upstreamError(method, transportError(err))
+	}
+	if resp == nil {
+		return []byte{}, nil
+	}
+	if nc.responseCheck != ResponseCheckOff && !json.Valid(resp) {
+		nc.logger.Error("node answered a non JSON response", logFields(ctx, logger.Fields{"method": method, "endpoint": req.URL.Host, "error": ErrNonJSONResponse}))
+		nc.metrics.Incr("upstream_non_json_total", map[string]string{"method": nc.metricMethod(method)})
+		return nil, nc.upstreamError(method, &UpstreamError{category: CategoryBadResponse, err: ErrNonJSONResponse})
+	}
+	if rpcErr := rpcError(resp); rpcErr != nil {
+		return resp, nc.upstreamError(method, rpcErr)
+	}
+	return resp, nil
+}
+
+// requestBody read the body of a request to node, gunzipped when it was compressed
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return []byte{}, nil
+	}
+	defer req.Body.Close()
+	if req.Header.Get("Content-Encoding") != "gzip" {
+		return ioutil.ReadAll(req.Body)
+	}
+	gz, err := gzip.NewReader(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return ioutil.ReadAll(gz)
+}
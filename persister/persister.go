@@ -29,15 +29,29 @@ type RateUSD struct {
 	PriceUsd string `json:"price_usd"`
 }
 
+// RatesCombined rates and rates USD read at the same time
+type RatesCombined struct {
+	Rates           []ethereum.Rate
+	RatesUSD        []RateUSD
+	IsNewRate       bool
+	IsNewRateUSD    bool
+	UpdateAt        int64 // time rates were updated
+	USDBaseUpdateAt int64 // updateAt of the rates which rates USD were calculated from
+}
+
 type Persister interface {
 	GetRate() []ethereum.Rate
+	GetRateByTokens(symbols []string) ([]ethereum.Rate, []string)
 	GetIsNewRate() bool
 	SetIsNewRate(bool)
 	GetTimeUpdateRate() int64
+	GetRateTimestamp() int64
+	GetRateHistory(source, dest string, from, to int64) []RatePoint
 
 	SaveRate([]ethereum.Rate, int64)
 
 	GetLatestBlock() string
+	GetTimeUpdateLatestBlock() int64
 	GetIsNewLatestBlock() bool
 	SaveLatestBlock(string) error
 	SetNewLatestBlock(bool)
@@ -45,9 +59,12 @@ type Persister interface {
 	GetRateUSD() []RateUSD
 	GetRateETH() string
 	GetIsNewRateUSD() bool
+	GetRateUSDTimestamp() int64
 	SaveRateUSD(string) error
 	SetNewRateUSD(bool)
 
+	GetRatesCombined() RatesCombined
+
 	SaveKyberEnabled(bool)
 	SetNewKyberEnabled(bool)
 	GetKyberEnabled() bool
@@ -63,6 +80,11 @@ type Persister interface {
 	GetGasPrice() *ethereum.GasPrice
 	GetNewGasPrice() bool
 
+	SaveEIP1559GasPrice(*ethereum.EIP1559GasPrice)
+	SetNewEIP1559GasPrice(bool)
+	GetEIP1559GasPrice() *ethereum.EIP1559GasPrice
+	GetNewEIP1559GasPrice() bool
+
 	GetTimeVersion() string
 }
 
@@ -32,16 +32,21 @@ type RamPersister struct {
 	kyberEnabled      bool
 	isNewKyberEnabled bool
 
-	rates     []ethereum.Rate
-	isNewRate bool
-	updatedAt int64
-
-	latestBlock      string
-	isNewLatestBlock bool
-
-	rateUSD      []RateUSD
-	rateETH      string
-	isNewRateUsd bool
+	rates         []ethereum.Rate
+	isNewRate     bool
+	updatedAt     int64
+	rateTimestamp int64 // unix millis of the last SaveRate
+	rateHistory   *rateHistory
+
+	latestBlock          string
+	isNewLatestBlock     bool
+	latestBlockUpdatedAt int64
+
+	rateUSD           []RateUSD
+	rateETH           string
+	isNewRateUsd      bool
+	rateUSDBaseUpdate int64
+	rateUSDTimestamp  int64 // unix millis of the last successful SaveRateUSD
 
 	events     []ethereum.EventHistory
 	isNewEvent bool
@@ -51,10 +56,12 @@ type RamPersister struct {
 
 	gasPrice      *ethereum.GasPrice
 	isNewGasPrice bool
+
+	eip1559GasPrice      *ethereum.EIP1559GasPrice
+	isNewEIP1559GasPrice bool
 }
 
 func NewRamPersister() (*RamPersister, error) {
-	var mu sync.RWMutex
 	location, _ := time.LoadLocation("Asia/Bangkok")
 	tNow := time.Now().In(location)
 	timeRun := fmt.Sprintf("%02d:%02d:%02d %02d-%02d-%d", tNow.Hour(), tNow.Minute(), tNow.Second(), tNow.Day(), tNow.Month(), tNow.Year())
@@ -82,13 +89,13 @@ func NewRamPersister() (*RamPersister, error) {
 	isNewGasPrice := true
 
 	persister := &RamPersister{
-		mu:                mu,
 		timeRun:           timeRun,
 		kyberEnabled:      kyberEnabled,
 		isNewKyberEnabled: isNewKyberEnabled,
 		rates:             rates,
 		isNewRate:         isNewRate,
 		updatedAt:         0,
+		rateHistory:       newRateHistoryFromEnv(),
 		latestBlock:       latestBlock,
 		isNewLatestBlock:  isNewLatestBlock,
 		rateUSD:           rateUSD,
@@ -100,6 +107,8 @@ func NewRamPersister() (*RamPersister, error) {
 		isNewMaxGasPrice:  isNewMaxGasPrice,
 		gasPrice:          &gasPrice,
 		isNewGasPrice:     isNewGasPrice,
+
+		isNewEIP1559GasPrice: false,
 	}
 	return persister, nil
 }
@@ -108,7 +117,44 @@ func NewRamPersister() (*RamPersister, error) {
 func (self *RamPersister) GetRate() []ethereum.Rate {
 	self.mu.RLock()
 	defer self.mu.RUnlock()
-	return self.rates
+	return copyRates(self.rates)
+}
+
+// copyRates copy of rates returned to handlers, so they can change it without locking
+func copyRates(rates []ethereum.Rate) []ethereum.Rate {
+	return append([]ethereum.Rate{}, rates...)
+}
+
+// GetRateByTokens rates of pairs with a source or dest in symbols, along with
+// the symbols which are in no pair
+func (self *RamPersister) GetRateByTokens(symbols []string) ([]ethereum.Rate, []string) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	wanted := make(map[string]bool, len(symbols))
+	for _, symbol := range symbols {
+		wanted[symbol] = false
+	}
+	rates := []ethereum.Rate{}
+	for _, rate := range self.rates {
+		_, source := wanted[rate.Source]
+		_, dest := wanted[rate.Dest]
+		if source {
+			wanted[rate.Source] = true
+		}
+		if dest {
+			wanted[rate.Dest] = true
+		}
+		if source || dest {
+			rates = append(rates, rate)
+		}
+	}
+	unknown := []string{}
+	for _, symbol := range symbols {
+		if !wanted[symbol] {
+			unknown = append(unknown, symbol)
+		}
+	}
+	return rates, unknown
 }
 
 func (self *RamPersister) GetTimeUpdateRate() int64 {
@@ -118,9 +164,8 @@ func (self *RamPersister) GetTimeUpdateRate() int64 {
 }
 
 func (self *RamPersister) SetIsNewRate(isNewRate bool) {
-	self.mu.RLock()
-	defer self.mu.RUnlock()
-	// return self.rates
+	self.mu.Lock()
+	defer self.mu.Unlock()
 	self.isNewRate = isNewRate
 }
 
@@ -133,10 +178,29 @@ func (self *RamPersister) GetIsNewRate() bool {
 func (self *RamPersister) SaveRate(rates []ethereum.Rate, timestamp int64) {
 	self.mu.Lock()
 	defer self.mu.Unlock()
+	// the fetcher may reuse its slice
+	rates = copyRates(rates)
 	self.rates = rates
 	if timestamp != 0 {
 		self.updatedAt = timestamp
 	}
+	self.rateTimestamp = nowMillis()
+	self.rateHistory.add(self.rateTimestamp, rates)
+}
+
+// GetRateHistory rates of source to dest saved between from and to (unix millis,
+// to is ignored when 0), oldest first
+func (self *RamPersister) GetRateHistory(source, dest string, from, to int64) []RatePoint {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.rateHistory.points(source, dest, from, to)
+}
+
+// GetRateTimestamp unix millis rates were last saved, 0 if never
+func (self *RamPersister) GetRateTimestamp() int64 {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.rateTimestamp
 }
 
 //--------------------------------------------------------
@@ -201,6 +265,9 @@ func (self *RamPersister) GetNewMaxGasPrice() bool {
 func (self *RamPersister) SaveGasPrice(gasPrice *ethereum.GasPrice) {
 	self.mu.Lock()
 	defer self.mu.Unlock()
+	if gasPrice != nil {
+		gasPrice = copyGasPrice(gasPrice)
+	}
 	self.gasPrice = gasPrice
 	self.isNewGasPrice = true
 }
@@ -212,7 +279,15 @@ func (self *RamPersister) SetNewGasPrice(isNew bool) {
 func (self *RamPersister) GetGasPrice() *ethereum.GasPrice {
 	self.mu.Lock()
 	defer self.mu.Unlock()
-	return self.gasPrice
+	if self.gasPrice == nil {
+		return nil
+	}
+	return copyGasPrice(self.gasPrice)
+}
+
+func copyGasPrice(gasPrice *ethereum.GasPrice) *ethereum.GasPrice {
+	copied := *gasPrice
+	return &copied
 }
 func (self *RamPersister) GetNewGasPrice() bool {
 	self.mu.Lock()
@@ -220,12 +295,45 @@ func (self *RamPersister) GetNewGasPrice() bool {
 	return self.isNewGasPrice
 }
 
+func (self *RamPersister) SaveEIP1559GasPrice(gasPrice *ethereum.EIP1559GasPrice) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if gasPrice != nil {
+		gasPrice = copyEIP1559GasPrice(gasPrice)
+	}
+	self.eip1559GasPrice = gasPrice
+	self.isNewEIP1559GasPrice = true
+}
+func (self *RamPersister) SetNewEIP1559GasPrice(isNew bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.isNewEIP1559GasPrice = isNew
+}
+func (self *RamPersister) GetEIP1559GasPrice() *ethereum.EIP1559GasPrice {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	if self.eip1559GasPrice == nil {
+		return nil
+	}
+	return copyEIP1559GasPrice(self.eip1559GasPrice)
+}
+
+func copyEIP1559GasPrice(gasPrice *ethereum.EIP1559GasPrice) *ethereum.EIP1559GasPrice {
+	copied := *gasPrice
+	return &copied
+}
+func (self *RamPersister) GetNewEIP1559GasPrice() bool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.isNewEIP1559GasPrice
+}
+
 //-----------------------------------------------------------
 
 func (self *RamPersister) GetRateUSD() []RateUSD {
 	self.mu.RLock()
 	defer self.mu.RUnlock()
-	return self.rateUSD
+	return append([]RateUSD{}, self.rateUSD...)
 }
 
 func (self *RamPersister) GetRateETH() string {
@@ -268,10 +376,36 @@ func (self *RamPersister) SaveRateUSD(rateUSDEth string) error {
 	self.rateUSD = rates
 	self.rateETH = rateUSDEth
 	self.isNewRateUsd = true
+	self.rateUSDBaseUpdate = self.updatedAt
+	self.rateUSDTimestamp = nowMillis()
 
 	return nil
 }
 
+// GetRateUSDTimestamp unix millis rates USD were last saved, 0 if never
+func (self *RamPersister) GetRateUSDTimestamp() int64 {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.rateUSDTimestamp
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+func (self *RamPersister) GetRatesCombined() RatesCombined {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return RatesCombined{
+		Rates:           copyRates(self.rates),
+		RatesUSD:        append([]RateUSD{}, self.rateUSD...),
+		IsNewRate:       self.isNewRate,
+		IsNewRateUSD:    self.isNewRateUsd,
+		UpdateAt:        self.updatedAt,
+		USDBaseUpdateAt: self.rateUSDBaseUpdate,
+	}
+}
+
 func CalculateRateUSD(rateEther string, rateUSD string) (string, error) {
 	//func (z *Int) SetString(s string, base int) (*Int, bool)
 
@@ -311,9 +445,17 @@ func (self *RamPersister) SaveLatestBlock(blockNumber string) error {
 	defer self.mu.Unlock()
 	self.latestBlock = blockNumber
 	self.isNewLatestBlock = true
+	self.latestBlockUpdatedAt = time.Now().UTC().Unix()
 	return nil
 }
 
+// GetTimeUpdateLatestBlock unix time latest block was saved, 0 if never
+func (self *RamPersister) GetTimeUpdateLatestBlock() int64 {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.latestBlockUpdatedAt
+}
+
 func (self *RamPersister) GetIsNewLatestBlock() bool {
 	self.mu.RLock()
 	defer self.mu.RUnlock()
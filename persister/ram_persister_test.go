@@ -0,0 +1,72 @@
+package persister
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/KyberNetwork/cache/ethereum"
+	"github.com/stretchr/testify/assert"
+)
+
+// run with -race, getters used by handlers while the fetcher saves new values
+func TestRamPersisterConcurrentAccess(t *testing.T) {
+	ramPersister, err := NewRamPersister()
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			rate := strconv.Itoa(i)
+			ramPersister.SaveRate([]ethereum.Rate{{Source: "KNC", Dest: "ETH", Rate: rate, Minrate: rate}}, int64(i))
+			ramPersister.SetIsNewRate(i%2 == 0)
+			ramPersister.SaveRateUSD("400")
+			ramPersister.SaveLatestBlock(rate)
+			ramPersister.SaveGasPrice(&ethereum.GasPrice{Fast: rate})
+			ramPersister.SaveEIP1559GasPrice(&ethereum.EIP1559GasPrice{BaseFee: rate})
+		}
+	}()
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				for j := range ramPersister.GetRate() {
+					_ = ramPersister.GetRate()[j].Rate
+				}
+				ramPersister.GetIsNewRate()
+				ramPersister.GetRateUSD()
+				ramPersister.GetRatesCombined()
+				ramPersister.GetRateHistory("KNC", "ETH", 0, 0)
+				ramPersister.GetLatestBlock()
+				if gasPrice := ramPersister.GetGasPrice(); gasPrice != nil {
+					_ = gasPrice.Fast
+				}
+				if gasPrice := ramPersister.GetEIP1559GasPrice(); gasPrice != nil {
+					_ = gasPrice.BaseFee
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRamPersisterDefensiveCopies(t *testing.T) {
+	ramPersister, err := NewRamPersister()
+	assert.Nil(t, err)
+	rates := []ethereum.Rate{{Source: "KNC", Dest: "ETH", Rate: "1", Minrate: "1"}}
+	ramPersister.SaveRate(rates, 1)
+	rates[0].Rate = "changed by fetcher"
+	got := ramPersister.GetRate()
+	got[0].Rate = "changed by handler"
+	assert.Equal(t, "1", ramPersister.GetRate()[0].Rate)
+	assert.Equal(t, "1", ramPersister.GetRatesCombined().Rates[0].Rate)
+
+	gasPrice := &ethereum.GasPrice{Fast: "10"}
+	ramPersister.SaveGasPrice(gasPrice)
+	gasPrice.Fast = "20"
+	ramPersister.GetGasPrice().Fast = "30"
+	assert.Equal(t, "10", ramPersister.GetGasPrice().Fast)
+}
@@ -0,0 +1,89 @@
+package persister
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/KyberNetwork/cache/ethereum"
+)
+
+const (
+	defaultRateHistoryRetention = time.Hour
+	defaultRateHistoryMaxPoints = 720
+)
+
+// RatePoint rate of a pair at timestamp, in unix millis
+type RatePoint struct {
+	Timestamp int64  `json:"timestamp"`
+	Rate      string `json:"rate"`
+}
+
+type rateSnapshot struct {
+	timestamp int64
+	rates     []ethereum.Rate
+}
+
+// rateHistory ring buffer of the last saved rates, bounded by a number of snapshots and
+// a retention. The oldest snapshot is overwritten once it is full
+type rateHistory struct {
+	snapshots []rateSnapshot
+	start     int
+	size      int
+	retention int64 // millis
+}
+
+// newRateHistoryFromEnv read RATE_HISTORY_RETENTION (seconds, default 1 hour) and
+// RATE_HISTORY_MAX_POINTS (default 720)
+func newRateHistoryFromEnv() *rateHistory {
+	retention := defaultRateHistoryRetention
+	if seconds, err := strconv.Atoi(os.Getenv("RATE_HISTORY_RETENTION")); err == nil && seconds > 0 {
+		retention = time.Duration(seconds) * time.Second
+	}
+	maxPoints := defaultRateHistoryMaxPoints
+	if points, err := strconv.Atoi(os.Getenv("RATE_HISTORY_MAX_POINTS")); err == nil && points > 0 {
+		maxPoints = points
+	}
+	return newRateHistory(maxPoints, retention)
+}
+
+func newRateHistory(maxPoints int, retention time.Duration) *rateHistory {
+	return &rateHistory{
+		snapshots: make([]rateSnapshot, maxPoints),
+		retention: int64(retention / time.Millisecond),
+	}
+}
+
+// add keep rates saved at timestamp and evict snapshots older than the retention
+func (h *rateHistory) add(timestamp int64, rates []ethereum.Rate) {
+	if h.size == len(h.snapshots) {
+		h.start = (h.start + 1) % len(h.snapshots)
+		h.size--
+	}
+	h.snapshots[(h.start+h.size)%len(h.snapshots)] = rateSnapshot{timestamp: timestamp, rates: rates}
+	h.size++
+	for h.size > 0 && h.snapshots[h.start].timestamp < timestamp-h.retention {
+		h.snapshots[h.start] = rateSnapshot{}
+		h.start = (h.start + 1) % len(h.snapshots)
+		h.size--
+	}
+}
+
+// points rates of source to dest saved between from and to included, oldest first.
+// to is ignored when it is 0
+func (h *rateHistory) points(source, dest string, from, to int64) []RatePoint {
+	result := []RatePoint{}
+	for i := 0; i < h.size; i++ {
+		snapshot := h.snapshots[(h.start+i)%len(h.snapshots)]
+		if snapshot.timestamp < from || (to > 0 && snapshot.timestamp > to) {
+			continue
+		}
+		for _, rate := range snapshot.rates {
+			if rate.Source == source && rate.Dest == dest {
+				result = append(result, RatePoint{Timestamp: snapshot.timestamp, Rate: rate.Rate})
+				break
+			}
+		}
+	}
+	return result
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"math/big"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/KyberNetwork/cache/libs/contracts"
@@ -18,7 +19,9 @@ type RefFetcher struct {
 }
 
 func NewRefFetcher() *RefFetcher {
-	clientIns, err := ethclient.Dial(os.Getenv("NODE_ENDPOINT"))
+	// NODE_ENDPOINT may list fallback nodes of the node cache, use the first one
+	endpoint := strings.TrimSpace(strings.Split(os.Getenv("NODE_ENDPOINT"), ",")[0])
+	clientIns, err := ethclient.Dial(endpoint)
 	if err != nil {
 		log.Fatal(err)
 	}
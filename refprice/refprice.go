@@ -7,6 +7,9 @@ import (
 	"time"
 )
 
+// ErrContractNotFound returned when there is no chainlink contract of a pair
+var ErrContractNotFound = errors.New("Cannot get chainlink contract")
+
 type CachePrice struct {
 	Base      string
 	Quote     string
@@ -42,7 +45,7 @@ func (r *RefPrice) GetRefPrice(base string, quote string) (string, error) {
 	// fetch from chain link
 	contract := r.storage.GetContract(base, quote)
 	if contract.Address == "" {
-		return "", errors.New("Cannot get chainlink contract")
+		return "", ErrContractNotFound
 	}
 
 	// get refprice from blockchain